@@ -0,0 +1,178 @@
+package npmblame
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/gosuri/uitable"
+)
+
+// Waste is the blame of a group of installed packages
+type Waste struct {
+	// Packages counts the blamed packages, by name and version
+	Packages int                  `json:"packages"`
+	Errors   map[PackageError]int `json:"errors,omitempty"`
+	Bytes    int64                `json:"bytes"`
+}
+
+func (w *Waste) add(o Waste) {
+	if w.Errors == nil {
+		w.Errors = make(map[PackageError]int)
+	}
+	w.Packages += o.Packages
+	for err, count := range o.Errors {
+		w.Errors[err] += count
+	}
+	w.Bytes += o.Bytes
+}
+
+// Total returns the count of all the package errors
+func (w Waste) Total() int {
+	var total int
+	for _, count := range w.Errors {
+		total += count
+	}
+	return total
+}
+
+// Attribution is the waste brought in by a direct dependency
+type Attribution struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Exclusive is the waste only this dependency brings in
+	Exclusive Waste `json:"exclusive"`
+	// Shared is the waste other direct dependencies bring in as well
+	Shared Waste `json:"shared"`
+}
+
+// Attributions is the waste of a scan rolled up to the direct
+// dependencies of the project
+type Attributions struct {
+	Dependencies []Attribution `json:"dependencies"`
+	// Unattributed is the waste of packages missing from the lockfile
+	Unattributed Waste `json:"unattributed"`
+}
+
+// Attribute rolls the blame of a scan result up to the direct
+// dependencies of a dependency graph. Packages are matched by name and
+// version, so all the installed copies of a package count.
+func Attribute(g *DependencyGraph, r *Result) *Attributions {
+	blamed := make(map[string]Waste)
+	for _, i := range r.Instances {
+		if len(i.Errors) == 0 && len(i.Files) == 0 {
+			continue
+		}
+		key := i.Name + "@" + i.Version
+		w := blamed[key]
+		if w.Packages == 0 {
+			w.Packages = 1
+		}
+		w.add(Waste{Errors: i.Errors, Bytes: i.BlamedBytes()})
+		blamed[key] = w
+	}
+
+	roots := make([]string, 0, len(g.Roots))
+	for name := range g.Roots {
+		roots = append(roots, name)
+	}
+	sort.Strings(roots)
+
+	reached := make(map[string][]string)
+	owners := make(map[string]int)
+	for _, name := range roots {
+		keys := g.reachable(g.Roots[name])
+		reached[name] = keys
+		for _, key := range keys {
+			owners[key]++
+		}
+	}
+
+	a := &Attributions{}
+	for _, name := range roots {
+		dep := Attribution{Name: name, Version: g.Nodes[g.Roots[name]].Version}
+		for _, key := range reached[name] {
+			w, ok := blamed[key]
+			switch {
+			case !ok:
+			case owners[key] == 1:
+				dep.Exclusive.add(w)
+			default:
+				dep.Shared.add(w)
+			}
+		}
+		a.Dependencies = append(a.Dependencies, dep)
+	}
+	for key, w := range blamed {
+		if owners[key] == 0 {
+			a.Unattributed.add(w)
+		}
+	}
+
+	sort.SliceStable(a.Dependencies, func(i, j int) bool {
+		di, dj := a.Dependencies[i], a.Dependencies[j]
+		if di.Exclusive.Bytes != dj.Exclusive.Bytes {
+			return di.Exclusive.Bytes > dj.Exclusive.Bytes
+		}
+		return di.Shared.Bytes > dj.Shared.Bytes
+	})
+	return a
+}
+
+// reachable returns the name@version of the packages a node depends on,
+// directly or not, including itself
+func (g *DependencyGraph) reachable(id string) []string {
+	seen := map[string]bool{id: true}
+	keys := make(map[string]bool)
+	queue := []string{id}
+	for len(queue) > 0 {
+		n := g.Nodes[queue[0]]
+		queue = queue[1:]
+		if n == nil {
+			continue
+		}
+		keys[n.Name+"@"+n.Version] = true
+		for _, dep := range n.Dependencies {
+			if !seen[dep] {
+				seen[dep] = true
+				queue = append(queue, dep)
+			}
+		}
+	}
+	list := make([]string, 0, len(keys))
+	for key := range keys {
+		list = append(list, key)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// WriteJSON writes the machine-readable representation of the Attributions
+func (a *Attributions) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(a)
+}
+
+// String returns the printable representation of the Attributions
+func (a *Attributions) String() string {
+	buf := &bytes.Buffer{}
+	table := uitable.New()
+	table.MaxColWidth = 50
+	table.AddRow("DEPENDENCY", "VERSION",
+		"EXCLUSIVE_PACKAGES", "EXCLUSIVE_ERRORS", "EXCLUSIVE_BYTES",
+		"SHARED_PACKAGES", "SHARED_ERRORS", "SHARED_BYTES")
+	for _, d := range a.Dependencies {
+		table.AddRow(d.Name, d.Version,
+			d.Exclusive.Packages, d.Exclusive.Total(), formatBytes(d.Exclusive.Bytes),
+			d.Shared.Packages, d.Shared.Total(), formatBytes(d.Shared.Bytes))
+	}
+	fmt.Fprintln(buf, table)
+	if a.Unattributed.Packages > 0 {
+		fmt.Fprintf(buf, "\n%d blamed packages, %d errors and %s, are not in the lockfile.\n",
+			a.Unattributed.Packages, a.Unattributed.Total(), formatBytes(a.Unattributed.Bytes))
+	}
+	return buf.String()
+}
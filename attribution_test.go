@@ -0,0 +1,58 @@
+package npmblame
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAttribute(t *testing.T) {
+	g := &DependencyGraph{
+		Roots: map[string]string{"a": "a", "b": "b", "clean": "clean"},
+		Nodes: map[string]*DependencyNode{
+			"a":      {Name: "a", Version: "1.0.0", Dependencies: []string{"x", "shared"}},
+			"b":      {Name: "b", Version: "2.0.0", Dependencies: []string{"shared"}},
+			"clean":  {Name: "clean", Version: "1.0.0"},
+			"x":      {Name: "x", Version: "1.0.0", Dependencies: []string{"a"}},
+			"shared": {Name: "shared", Version: "3.0.0"},
+		},
+	}
+	r := NewResult()
+	r.Instances = []*Instance{
+		{Name: "a", Version: "1.0.0", Path: "/a", Errors: map[PackageError]int{TestError: 1},
+			Files: []BlamedFile{{Path: "test.js", Size: 10, Errors: []PackageError{TestError}}}},
+		{Name: "clean", Version: "1.0.0", Path: "/clean"},
+		{Name: "x", Version: "1.0.0", Path: "/x", Errors: map[PackageError]int{ImageError: 2},
+			Files: []BlamedFile{{Path: "a.png", Size: 100, Errors: []PackageError{ImageError}}}},
+		{Name: "shared", Version: "3.0.0", Path: "/shared", Errors: map[PackageError]int{DotfileError: 1},
+			Files: []BlamedFile{{Path: ".eslintrc", Size: 5, Errors: []PackageError{DotfileError}}}},
+		{Name: "shared", Version: "3.0.0", Path: "/b/node_modules/shared", Errors: map[PackageError]int{DotfileError: 1},
+			Files: []BlamedFile{{Path: ".eslintrc", Size: 5, Errors: []PackageError{DotfileError}}}},
+		{Name: "orphan", Version: "1.0.0", Path: "/orphan", Errors: map[PackageError]int{ExecError: 1}},
+	}
+
+	a := Attribute(g, r)
+	if len(a.Dependencies) != 3 {
+		t.Fatalf("Expected 3 dependencies got %+v", a.Dependencies)
+	}
+	first := a.Dependencies[0]
+	if first.Name != "a" || first.Version != "1.0.0" ||
+		first.Exclusive.Packages != 2 || first.Exclusive.Total() != 3 || first.Exclusive.Bytes != 110 ||
+		first.Shared.Packages != 1 || first.Shared.Errors[DotfileError] != 2 || first.Shared.Bytes != 10 {
+		t.Errorf("Wrong attribution of a: %+v", first)
+	}
+	second := a.Dependencies[1]
+	if second.Name != "b" || second.Exclusive.Packages != 0 || second.Shared.Bytes != 10 {
+		t.Errorf("Wrong attribution of b: %+v", second)
+	}
+	if last := a.Dependencies[2]; last.Name != "clean" || last.Exclusive.Packages != 0 || last.Shared.Packages != 0 {
+		t.Errorf("Wrong attribution of clean: %+v", last)
+	}
+	if a.Unattributed.Packages != 1 || a.Unattributed.Errors[ExecError] != 1 {
+		t.Errorf("Wrong unattributed waste: %+v", a.Unattributed)
+	}
+
+	s := a.String()
+	if !strings.Contains(s, "EXCLUSIVE_BYTES") || !strings.Contains(s, "1 blamed packages, 1 errors and 0 B, are not in the lockfile.") {
+		t.Errorf("Wrong attribution output:\n%s", s)
+	}
+}
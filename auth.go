@@ -0,0 +1,328 @@
+package npmblame
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/spf13/afero"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+)
+
+// GitHubAuth configures the GitHub clients of NewGitHubClient
+type GitHubAuth struct {
+	// Host is github.com, by default, or a GitHub Enterprise host
+	Host string
+	// BaseURL and UploadURL are the API URLs, by default those of the
+	// host: https://host/api/v3/ and https://host/api/uploads/ for
+	// GitHub Enterprise
+	BaseURL   string
+	UploadURL string
+	// Token is a personal access or OAuth token
+	Token string
+	// App authenticates as a GitHub App installation, instead of Token
+	App *GitHubApp
+	// HTTPClient is used by the client, http.DefaultClient by default
+	HTTPClient *http.Client
+}
+
+// GitHubApp identifies a GitHub App installation
+type GitHubApp struct {
+	ID             int64
+	InstallationID int64
+	// PrivateKey is the PEM encoded RSA key of the app
+	PrivateKey []byte
+}
+
+// NewGitHubClient returns a GitHub client for the host, API URLs and
+// credentials of auth. Without credentials the client is anonymous.
+func NewGitHubClient(auth GitHubAuth) (*github.Client, error) {
+	host := auth.Host
+	if host == "" {
+		host = "github.com"
+	}
+	baseURL, uploadURL := auth.BaseURL, auth.UploadURL
+	if host != "github.com" {
+		if baseURL == "" {
+			baseURL = "https://" + host + "/api/v3/"
+		}
+		if uploadURL == "" {
+			uploadURL = "https://" + host + "/api/uploads/"
+		}
+	}
+	if baseURL != "" && !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	if uploadURL != "" && !strings.HasSuffix(uploadURL, "/") {
+		uploadURL += "/"
+	}
+
+	httpClient := auth.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	ctx := context.WithValue(oauth2.NoContext, oauth2.HTTPClient, httpClient)
+	var ts oauth2.TokenSource
+	switch {
+	case auth.App != nil:
+		key, err := parseRSAKey(auth.App.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		apiURL := baseURL
+		if apiURL == "" {
+			apiURL = "https://api.github.com/"
+		}
+		ts = &appTokenSource{app: auth.App, key: key, baseURL: apiURL, client: httpClient}
+	case auth.Token != "":
+		ts = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: auth.Token})
+	}
+	if ts != nil {
+		httpClient = oauth2.NewClient(ctx, ts)
+	}
+
+	client := github.NewClient(httpClient)
+	client.UserAgent = "npm-blame"
+	for _, u := range []struct {
+		raw    string
+		target **url.URL
+	}{{baseURL, &client.BaseURL}, {uploadURL, &client.UploadURL}} {
+		if u.raw == "" {
+			continue
+		}
+		parsed, err := url.Parse(u.raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GitHub API URL %q: %v", u.raw, err)
+		}
+		*u.target = parsed
+	}
+	return client, nil
+}
+
+// parseRSAKey parses a PKCS #1 or PKCS #8 PEM encoded RSA private key
+func parseRSAKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("invalid GitHub App private key: no PEM block")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub App private key: %v", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("invalid GitHub App private key: not an RSA key")
+	}
+	return key, nil
+}
+
+// appTokenSource exchanges a JSON Web Token signed by a GitHub App for
+// the access tokens of its installation
+type appTokenSource struct {
+	app     *GitHubApp
+	key     *rsa.PrivateKey
+	baseURL string
+	client  *http.Client
+}
+
+// jwt returns the JSON Web Token authenticating the app
+func (s *appTokenSource) jwt() (string, error) {
+	// Backdated against clock drift
+	issued := time.Now().Add(-time.Minute)
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]int64{
+		"iat": issued.Unix(),
+		// GitHub accepts 10 minutes at most
+		"exp": issued.Add(9 * time.Minute).Unix(),
+		"iss": s.app.ID,
+	})
+	enc := base64.RawURLEncoding
+	signed := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + enc.EncodeToString(signature), nil
+}
+
+// Token implements oauth2.TokenSource
+func (s *appTokenSource) Token() (*oauth2.Token, error) {
+	jwt, err := s.jwt()
+	if err != nil {
+		return nil, err
+	}
+	u := fmt.Sprintf("%sapp/installations/%d/access_tokens", s.baseURL, s.app.InstallationID)
+	req, err := http.NewRequest("POST", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github.machine-man-preview+json")
+	req.Header.Set("User-Agent", "npm-blame")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return nil, newTrackerError(resp, fmt.Sprintf("POST %s: %s", u, strings.TrimSpace(string(body))))
+	}
+	var token struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{AccessToken: token.Token, TokenType: "token", Expiry: token.ExpiresAt}, nil
+}
+
+// LookupGitHubToken returns the token of a GitHub host, and where it was
+// found, from the environment, ~/.netrc or the gh CLI hosts file. The
+// GITHUB_TOKEN and GH_TOKEN variables are read for github.com, and
+// GH_ENTERPRISE_TOKEN and GITHUB_ENTERPRISE_TOKEN for other hosts.
+// An empty token is returned when none is found.
+func LookupGitHubToken(fs afero.Fs, host string) (string, string, error) {
+	// Without home folder only the environment is read
+	home, _ := os.UserHomeDir()
+	return lookupGitHubToken(fs, host, os.Getenv, home)
+}
+
+func lookupGitHubToken(fs afero.Fs, host string, getenv func(string) string, home string) (string, string, error) {
+	if host == "" {
+		host = "github.com"
+	}
+	variables := []string{"GITHUB_TOKEN", "GH_TOKEN"}
+	if host != "github.com" {
+		variables = []string{"GH_ENTERPRISE_TOKEN", "GITHUB_ENTERPRISE_TOKEN"}
+	}
+	for _, v := range variables {
+		if token := getenv(v); token != "" {
+			return token, "$" + v, nil
+		}
+	}
+
+	netrc := getenv("NETRC")
+	if netrc == "" && home != "" {
+		netrc = filepath.Join(home, ".netrc")
+	}
+	if netrc != "" {
+		token, err := netrcPassword(fs, netrc, host)
+		if err != nil {
+			return "", "", err
+		}
+		if token != "" {
+			return token, netrc, nil
+		}
+	}
+
+	config := getenv("GH_CONFIG_DIR")
+	if config == "" && getenv("XDG_CONFIG_HOME") != "" {
+		config = filepath.Join(getenv("XDG_CONFIG_HOME"), "gh")
+	}
+	if config == "" && home != "" {
+		config = filepath.Join(home, ".config", "gh")
+	}
+	if config != "" {
+		hosts := filepath.Join(config, "hosts.yml")
+		token, err := ghHostsToken(fs, hosts, host)
+		if err != nil {
+			return "", "", err
+		}
+		if token != "" {
+			return token, hosts, nil
+		}
+	}
+	return "", "", nil
+}
+
+// netrcPassword returns the password of a host, or of its API host, in
+// a netrc file. Missing files give an empty password.
+func netrcPassword(fs afero.Fs, path, host string) (string, error) {
+	data, err := afero.ReadFile(fs, path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var fields []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields = append(fields, strings.Fields(line)...)
+	}
+
+	// The default entry holds no GitHub token, only machines are read
+	var machine string
+	passwords := make(map[string]string)
+	for i := 0; i+1 < len(fields); i++ {
+		switch fields[i] {
+		case "machine":
+			i++
+			machine = fields[i]
+		case "default":
+			machine = ""
+		case "password":
+			i++
+			if _, ok := passwords[machine]; !ok && machine != "" {
+				passwords[machine] = fields[i]
+			}
+		case "macdef":
+			// Macros end the machine definitions
+			i = len(fields)
+		}
+	}
+	for _, m := range []string{host, "api." + host} {
+		if p, ok := passwords[m]; ok {
+			return p, nil
+		}
+	}
+	return "", nil
+}
+
+// ghHostsToken returns the OAuth token of a host in a gh CLI hosts file.
+// Missing files, and tokens kept in the system keyring, give an empty
+// token.
+func ghHostsToken(fs afero.Fs, path, host string) (string, error) {
+	data, err := afero.ReadFile(fs, path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	hosts, err := parseYAML(data)
+	if err != nil {
+		return "", fmt.Errorf("invalid gh hosts file %s: %v", path, err)
+	}
+	return yamlString(yamlMap(yamlMap(hosts)[host])["oauth_token"]), nil
+}
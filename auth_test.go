@@ -0,0 +1,160 @@
+package npmblame
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestNewGitHubClient(t *testing.T) {
+	for _, tc := range []struct {
+		auth              GitHubAuth
+		base, upload      string
+		expectedAnonymous bool
+	}{
+		{GitHubAuth{}, "https://api.github.com/", "https://uploads.github.com/", true},
+		{GitHubAuth{Host: "github.example.com", Token: "t"}, "https://github.example.com/api/v3/", "https://github.example.com/api/uploads/", false},
+		{GitHubAuth{Host: "github.example.com", BaseURL: "https://api.example.com", UploadURL: "https://uploads.example.com/"}, "https://api.example.com/", "https://uploads.example.com/", true},
+	} {
+		client, err := NewGitHubClient(tc.auth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if client.BaseURL.String() != tc.base || client.UploadURL.String() != tc.upload {
+			t.Errorf("%+v: got %s and %s", tc.auth, client.BaseURL, client.UploadURL)
+		}
+		if client.UserAgent != "npm-blame" {
+			t.Errorf("Wrong UserAgent %s", client.UserAgent)
+		}
+	}
+
+	if _, err := NewGitHubClient(GitHubAuth{App: &GitHubApp{ID: 1, PrivateKey: []byte("not a key")}}); err == nil {
+		t.Error("Expected an invalid key error")
+	}
+}
+
+func TestNewGitHubClientToken(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.Write([]byte(`{"name": "repo"}`))
+	}))
+	defer server.Close()
+
+	client, _ := NewGitHubClient(GitHubAuth{Host: "github.example.com", BaseURL: server.URL, Token: "secret"})
+	if _, _, err := client.Repositories.Get("owner", "repo"); err != nil {
+		t.Fatal(err)
+	}
+	if authorization != "Bearer secret" {
+		t.Errorf("Wrong authorization %q", authorization)
+	}
+}
+
+func TestNewGitHubClientApp(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	var exchanges int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/app/installations/42/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		exchanges++
+		parts := strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), ".")
+		if len(parts) != 3 {
+			t.Fatalf("Invalid JWT %q", r.Header.Get("Authorization"))
+		}
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, sum[:], signature); err != nil {
+			t.Errorf("Invalid JWT signature: %v", err)
+		}
+		data, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		var claims map[string]int64
+		json.Unmarshal(data, &claims)
+		if claims["iss"] != 7 || claims["exp"]-claims["iat"] > 600 {
+			t.Errorf("Wrong claims %v", claims)
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"token": "installation", "expires_at": "2099-01-01T00:00:00Z"}`))
+	})
+	var authorizations []string
+	mux.HandleFunc("/repos/owner/repo", func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		w.Write([]byte(`{"name": "repo"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := NewGitHubClient(GitHubAuth{
+		BaseURL: server.URL,
+		App:     &GitHubApp{ID: 7, InstallationID: 42, PrivateKey: pemKey},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n < 2; n++ {
+		if _, _, err := client.Repositories.Get("owner", "repo"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if exchanges != 1 || len(authorizations) != 2 || authorizations[0] != "token installation" {
+		t.Errorf("Expected a single token exchange got %d, %v", exchanges, authorizations)
+	}
+}
+
+func TestLookupGitHubToken(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/home/.netrc", []byte(`# Tokens
+machine example.com login me password other
+machine api.github.com
+  login me
+  password netrc-token
+default login anonymous password default
+`), 0644)
+	afero.WriteFile(fs, "/home/.config/gh/hosts.yml", []byte(`github.com:
+    user: me
+    oauth_token: gh-token
+    git_protocol: https
+github.example.com:
+    user: me
+    oauth_token: enterprise-token
+`), 0644)
+
+	for _, tc := range []struct {
+		name   string
+		host   string
+		env    map[string]string
+		token  string
+		source string
+	}{
+		{"GITHUB_TOKEN", "github.com", map[string]string{"GITHUB_TOKEN": "env-token", "GH_TOKEN": "gh"}, "env-token", "$GITHUB_TOKEN"},
+		{"Enterprise variable", "github.example.com", map[string]string{"GITHUB_TOKEN": "env-token", "GH_ENTERPRISE_TOKEN": "ghe"}, "ghe", "$GH_ENTERPRISE_TOKEN"},
+		{"netrc", "github.com", nil, "netrc-token", "/home/.netrc"},
+		{"gh hosts", "github.example.com", nil, "enterprise-token", "/home/.config/gh/hosts.yml"},
+		{"NETRC and GH_CONFIG_DIR", "github.com", map[string]string{"NETRC": "/missing", "GH_CONFIG_DIR": "/home/.config/gh"}, "gh-token", "/home/.config/gh/hosts.yml"},
+		{"None", "unknown.example.com", nil, "", ""},
+	} {
+		getenv := func(k string) string { return tc.env[k] }
+		token, source, err := lookupGitHubToken(fs, tc.host, getenv, "/home")
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if token != tc.token || source != tc.source {
+			t.Errorf("%s: expected %q from %q got %q from %q", tc.name, tc.token, tc.source, token, source)
+		}
+	}
+}
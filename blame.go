@@ -12,6 +12,10 @@ import (
 	"github.com/gosuri/uitable"
 )
 
+// Version is the npm-blame release, set at build time with
+// -ldflags "-X github.com/talend-glorieux/npm-blame.Version=..."
+var Version = "0.1.0"
+
 // PackageError represents common npm packages errors
 type PackageError int
 
@@ -28,8 +32,76 @@ const (
 	CIError
 	// DotfileError marks a package lint files
 	DotfileError
+	// SecretError marks a package containing credentials or private keys
+	SecretError
+	// VCSError marks a package containing version control folders
+	VCSError
 )
 
+var packageErrorNames = map[PackageError]string{
+	ExecError:    "exec",
+	TestError:    "test",
+	BenchError:   "bench",
+	ImageError:   "image",
+	CIError:      "ci",
+	DotfileError: "dotfile",
+	SecretError:  "secret",
+	VCSError:     "vcs",
+}
+
+// String returns the name of the package error
+func (pe PackageError) String() string {
+	if name, ok := packageErrorNames[pe]; ok {
+		return name
+	}
+	return fmt.Sprintf("PackageError(%d)", int(pe))
+}
+
+// MarshalText encodes the package error as its name
+func (pe PackageError) MarshalText() ([]byte, error) {
+	if _, ok := packageErrorNames[pe]; !ok {
+		return nil, fmt.Errorf("unknown package error %d", int(pe))
+	}
+	return []byte(pe.String()), nil
+}
+
+// UnmarshalText decodes a package error from its name
+func (pe *PackageError) UnmarshalText(text []byte) error {
+	for err, name := range packageErrorNames {
+		if name == string(text) {
+			*pe = err
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown package error %q", text)
+}
+
+// PackageErrors lists every package error in display order
+var PackageErrors = []PackageError{
+	ExecError, TestError, BenchError, ImageError, CIError, DotfileError,
+	SecretError, VCSError,
+}
+
+var packageErrorTitles = map[PackageError]string{
+	ExecError:    "EXECUTABLE FILE",
+	TestError:    "TESTS",
+	BenchError:   "BENCH",
+	ImageError:   "IMAGES",
+	CIError:      "TRAVIS_FILES",
+	DotfileError: "EDITOR_LINT_FILES",
+	SecretError:  "SECRETS",
+	VCSError:     "VCS_FILES",
+}
+
+// packageErrorColumns returns the table titles of the package errors
+func packageErrorColumns() []interface{} {
+	columns := make([]interface{}, len(PackageErrors))
+	for i, err := range PackageErrors {
+		columns[i] = packageErrorTitles[err]
+	}
+	return columns
+}
+
 // NpmPackage represents a npm package
 type NpmPackage struct {
 	BugsURL  string
@@ -45,24 +117,29 @@ func NewNpmPackages() NpmPackages {
 	return make(NpmPackages)
 }
 
-// ExtractPackageName returns the npm package name from a given path
-// TODO improve to handle nested dependencies
+// ExtractPackageName returns the npm package name from a given path.
+// Scoped packages are named after both their scope and name.
 func (np NpmPackages) ExtractPackageName(path string) string {
 	dir := filepath.Dir(path)
-	//fmt.Println("HAS_NODEMODULES", strings.Contains(dir, "node_modules"), strings.LastIndex(dir, "node_modules"))
 	subPkgIndex := strings.LastIndex(dir, "node_modules")
-	var module []string
 	if subPkgIndex != -1 {
-		module = strings.Split(dir[subPkgIndex:], "/")
-		if len(module) > 1 {
-			return module[1]
-		}
+		return packageName(strings.Split(dir[subPkgIndex:], "/")[1:])
+	}
+	return packageName(strings.Split(strings.TrimPrefix(dir, "/"), "/"))
+}
+
+// packageName returns the package name found at the start of a split path
+func packageName(module []string) string {
+	if len(module) == 0 {
+		return ""
 	}
-	module = strings.Split(dir, "/")
-	if len(module[0]) > 0 {
-		return module[0]
+	if strings.HasPrefix(module[0], "@") {
+		if len(module) < 2 {
+			return ""
+		}
+		return module[0] + "/" + module[1]
 	}
-	return module[1]
+	return module[0]
 }
 
 //ExtractPackageInformations extracts the package information from its package.json
@@ -78,39 +155,6 @@ func (np NpmPackages) AppendError(pkgName string, err PackageError) {
 	np[pkgName][err] = np[pkgName][err] + 1
 }
 
-func (np NpmPackages) checkTests(path string, pkg string) {
-	if strings.Contains(path, "test") ||
-		strings.Contains(path, "tests") ||
-		strings.Contains(path, ".zuul.yml") ||
-		strings.Contains(path, "coverage") ||
-		strings.Contains(path, ".coveralls.yml") {
-		np.AppendError(pkg, TestError)
-	}
-}
-
-func (np NpmPackages) checkDotFiles(path string, pkg string) {
-	if strings.Contains(path, ".editorconfig") ||
-		strings.Contains(path, ".eslintrc") ||
-		strings.Contains(path, ".sass-lint.yml") ||
-		strings.Contains(path, ".jshintrc") {
-		np.AppendError(pkg, DotfileError)
-	}
-}
-
-func (np NpmPackages) checkExecutables(info os.FileInfo, pkg string) {
-	if !info.Mode().IsDir() && (info.Mode()&0111) != 0 {
-		np.AppendError(pkg, ExecError)
-	}
-}
-
-func (np NpmPackages) checkImages(path string, pkg string) {
-	if filepath.Ext(path) == ".png" ||
-		filepath.Ext(path) == ".jpg" ||
-		filepath.Ext(path) == ".ico" {
-		np.AppendError(pkg, ImageError)
-	}
-}
-
 // Blame reports on error for a given npm package
 func (np NpmPackages) Blame(path string, info os.FileInfo, err error) error {
 	if err != nil {
@@ -121,25 +165,39 @@ func (np NpmPackages) Blame(path string, info os.FileInfo, err error) error {
 	if pkg == "" || pkg == ".bin" {
 		return nil
 	}
-	if np[pkg] == nil {
+	// Rules match the path inside the package, not the package name
+	np.blame(packagePath(path, pkg), info, pkg)
+	return nil
+}
 
-		np[pkg] = make(map[PackageError]int)
+// packagePath returns the path of a file relative to the folder of its
+// package, found after the last node_modules folder of the path like its
+// name, or at the start of a path without one
+func packagePath(path, pkg string) string {
+	rel := strings.TrimPrefix(path, "/")
+	if i := strings.LastIndex(filepath.Dir(path), "node_modules"); i != -1 {
+		rel = path[i+len("node_modules/"):]
 	}
-
-	np.checkExecutables(info, pkg)
-	np.checkTests(path, pkg)
-	np.checkDotFiles(path, pkg)
-	np.checkImages(path, pkg)
-
-	if strings.Contains(path, "bench") {
-		np.AppendError(pkg, BenchError)
+	parts := strings.Split(rel, "/")
+	if n := strings.Count(pkg, "/") + 1; len(parts) > n {
+		return strings.Join(parts[n:], "/")
 	}
+	return ""
+}
 
-	if strings.Contains(path, ".travis.yml") {
-		np.AppendError(pkg, CIError)
+// blame runs every check on a file already attributed to a package,
+// given by its path relative to the package folder, and returns the
+// errors found
+func (np NpmPackages) blame(path string, info os.FileInfo, pkg string) []PackageError {
+	if np[pkg] == nil {
+		np[pkg] = make(map[PackageError]int)
 	}
 
-	return nil
+	errs := Detect(path, info)
+	for _, err := range errs {
+		np.AppendError(pkg, err)
+	}
+	return errs
 }
 
 // TotalErrors return the total amount of errors
@@ -165,17 +223,18 @@ func (np NpmPackages) String() string {
 	table := uitable.New()
 	table.MaxColWidth = 50
 
-	table.AddRow("PACKAGE", "ERRORS", "EXECUTABLE FILE", "TESTS", "BENCH",
-		"IMAGES", "TRAVIS_FILES", "EDITOR_LINT_FILES")
+	table.AddRow(append([]interface{}{"PACKAGE", "ERRORS"}, packageErrorColumns()...)...)
 	for _, name := range keys {
 		errors := np[name]
 
 		if len(errors) > 0 {
 			pkgErr := np.TotalErrors(name)
 			totalErr++
-			table.AddRow(name, pkgErr, errors[ExecError], errors[TestError],
-				errors[BenchError], errors[ImageError], errors[CIError],
-				errors[DotfileError])
+			row := []interface{}{name, pkgErr}
+			for _, err := range PackageErrors {
+				row = append(row, errors[err])
+			}
+			table.AddRow(row...)
 		}
 	}
 
@@ -1,7 +1,9 @@
 package npmblame
 
 import (
+	"encoding/json"
 	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/spf13/afero"
@@ -15,6 +17,34 @@ func TestNewNpmPackages(t *testing.T) {
 	}
 }
 
+func TestPackageErrorText(t *testing.T) {
+	if ImageError.String() != "image" {
+		t.Errorf("Wrong name: expected image got %s", ImageError)
+	}
+
+	errors := map[PackageError]int{ExecError: 1, DotfileError: 2}
+	data, err := json.Marshal(errors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"dotfile":2,"exec":1}` {
+		t.Errorf("Wrong encoding: %s", data)
+	}
+
+	decoded := map[PackageError]int{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, errors) {
+		t.Errorf("Decoded %v, want %v", decoded, errors)
+	}
+
+	var pe PackageError
+	if err := pe.UnmarshalText([]byte("unknown")); err == nil {
+		t.Error("Expected an unknown package error")
+	}
+}
+
 func TestExtractPackageName(t *testing.T) {
 	np := NewNpmPackages()
 
@@ -44,6 +74,21 @@ func TestExtractPackageName(t *testing.T) {
 			t.Error("Wrong package name", p)
 		}
 	})
+
+	t.Run("scoped package", func(t *testing.T) {
+		if p := np.ExtractPackageName("/@scope/pkg/path/file"); p != "@scope/pkg" {
+			t.Error("Wrong package name", p)
+		}
+		if p := np.ExtractPackageName("/test/node_modules/@scope/nested/file"); p != "@scope/nested" {
+			t.Error("Wrong package name", p)
+		}
+	})
+
+	t.Run("node_modules file", func(t *testing.T) {
+		if p := np.ExtractPackageName("/test/node_modules/.yarn-integrity"); p != "" {
+			t.Errorf("Expected an empty string got %s", p)
+		}
+	})
 }
 
 func BenchmarkExtractPackageName(b *testing.B) {
@@ -110,9 +155,34 @@ func createNodeModulesFolder() (fs afero.Fs, err error) {
 	fs.Create("/pkg/.eslintrc")
 	fs.Create("/pkg/.sass-lint.yml")
 	fs.Create("/pkg/.jshintrc")
+
+	// SecretError
+	fs.Create("/pkg/.npmrc")
+	fs.Create("/pkg/server.pem")
+
+	// VCSError
+	fs.Mkdir("/pkg/.git", 0600)
+	fs.Create("/pkg/.git/HEAD")
 	return
 }
 
+func TestPackagePath(t *testing.T) {
+	for _, tc := range []struct {
+		path, pkg, expected string
+	}{
+		{"/node_modules/pkg/test/a.js", "pkg", "test/a.js"},
+		{"lodash/test/x.js", "lodash", "test/x.js"},
+		{"/node_modules/pkg/test/pkg/index.js", "pkg", "test/pkg/index.js"},
+		{"/node_modules/@scope/pkg/lib/a.js", "@scope/pkg", "lib/a.js"},
+		{"/node_modules/a/node_modules/b/b.test.js", "b", "b.test.js"},
+		{"/node_modules/pkg", "pkg", ""},
+	} {
+		if path := packagePath(tc.path, tc.pkg); path != tc.expected {
+			t.Errorf("%s: expected %q got %q", tc.path, tc.expected, path)
+		}
+	}
+}
+
 func TestBlame(t *testing.T) {
 	fs, err := createNodeModulesFolder()
 	if err != nil {
@@ -177,6 +247,18 @@ func TestBlame(t *testing.T) {
 			t.Error("No DotfileError", np)
 		}
 	})
+
+	t.Run("SecretError", func(t *testing.T) {
+		if np["pkg"][SecretError] != 2 {
+			t.Error("No SecretError", np)
+		}
+	})
+
+	t.Run("VCSError", func(t *testing.T) {
+		if np["pkg"][VCSError] != 2 {
+			t.Error("No VCSError", np)
+		}
+	})
 }
 
 func BenchmarkBlame(b *testing.B) {
@@ -0,0 +1,253 @@
+package npmblame
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// Cacache reads the content addressable cache where npm keeps the
+// registry responses, usually ~/.npm/_cacache
+type Cacache struct {
+	fs  afero.Fs
+	dir string
+}
+
+// NewCacache returns the reader of a cacache folder
+func NewCacache(fs afero.Fs, dir string) *Cacache {
+	return &Cacache{fs: fs, dir: dir}
+}
+
+// DefaultCacacheDir returns the cacache folder of npm: _cacache in
+// $npm_config_cache, or in the default npm cache folder
+func DefaultCacacheDir() string {
+	cache := os.Getenv("npm_config_cache")
+	if cache == "" {
+		cache = os.Getenv("NPM_CONFIG_CACHE")
+	}
+	if cache == "" {
+		if runtime.GOOS == "windows" && os.Getenv("LOCALAPPDATA") != "" {
+			cache = filepath.Join(os.Getenv("LOCALAPPDATA"), "npm-cache")
+		} else if home, err := os.UserHomeDir(); err == nil {
+			cache = filepath.Join(home, ".npm")
+		}
+	}
+	return filepath.Join(cache, "_cacache")
+}
+
+// CacacheEntry is an entry of the cacache index
+type CacacheEntry struct {
+	Key string `json:"key"`
+	// Integrity is the subresource integrity of the content, empty for
+	// deleted entries
+	Integrity string          `json:"integrity"`
+	Time      int64           `json:"time"`
+	Size      int64           `json:"size"`
+	Metadata  json.RawMessage `json:"metadata,omitempty"`
+}
+
+// bucketPath returns the index bucket of a key
+func (c *Cacache) bucketPath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	h := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, "index-v5", h[:2], h[2:4], h[4:])
+}
+
+// Entry returns the index entry of a key, nil when it is not cached.
+// Buckets are append only, the last valid entry wins and corrupted lines
+// are skipped as cacache does.
+func (c *Cacache) Entry(key string) (*CacacheEntry, error) {
+	data, err := afero.ReadFile(c.fs, c.bucketPath(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entry *CacacheEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		// Lines are the hex sha1 of their JSON, a tab and the JSON
+		parts := strings.SplitN(scanner.Text(), "\t", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		sum := sha1.Sum([]byte(parts[1]))
+		if hex.EncodeToString(sum[:]) != parts[0] {
+			continue
+		}
+		e := new(CacacheEntry)
+		if err := json.Unmarshal([]byte(parts[1]), e); err != nil || e.Key != key {
+			continue
+		}
+		entry = e
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if entry == nil || entry.Integrity == "" {
+		return nil, nil
+	}
+	return entry, nil
+}
+
+// integrityHashes are the supported integrity algorithms, strongest first
+var integrityHashes = []struct {
+	name string
+	new  func() hash.Hash
+}{
+	{"sha512", sha512.New},
+	{"sha256", sha256.New},
+	{"sha1", sha1.New},
+}
+
+// Content returns the verified content of a subresource integrity, nil
+// when it is not cached. The strongest supported hash is used.
+func (c *Cacache) Content(integrity string) ([]byte, error) {
+	hashes := make(map[string]string)
+	for _, h := range strings.Fields(integrity) {
+		parts := strings.SplitN(h, "-", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		// Options follow a question mark
+		hashes[parts[0]] = strings.SplitN(parts[1], "?", 2)[0]
+	}
+	for _, algo := range integrityHashes {
+		digest, ok := hashes[algo.name]
+		if !ok {
+			continue
+		}
+		sum, err := base64.StdEncoding.DecodeString(digest)
+		if err != nil || len(sum) == 0 {
+			return nil, fmt.Errorf("invalid integrity %q", integrity)
+		}
+		h := hex.EncodeToString(sum)
+		data, err := afero.ReadFile(c.fs, filepath.Join(c.dir, "content-v2", algo.name, h[:2], h[2:4], h[4:]))
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		hasher := algo.new()
+		hasher.Write(data)
+		if !bytes.Equal(hasher.Sum(nil), sum) {
+			return nil, fmt.Errorf("corrupted cache content %s-%s", algo.name, digest)
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("unsupported integrity %q", integrity)
+}
+
+// packumentKeys returns the index keys of a packument. npm escapes the
+// slash of scoped names in lower case.
+func packumentKeys(registry, name string) []string {
+	const prefix = "make-fetch-happen:request-cache:"
+	lower, escaped := strings.Replace(name, "/", "%2f", 1), url.PathEscape(name)
+	if lower == escaped {
+		return []string{prefix + registry + lower}
+	}
+	return []string{prefix + registry + lower, prefix + registry + escaped}
+}
+
+// Packument returns the cached packument of a package from a registry,
+// nil when npm did not cache it. Packuments installed with the
+// abbreviated format lack the publish times and maintainers.
+func (c *Cacache) Packument(r *Registry, name string) (*Packument, error) {
+	for _, key := range packumentKeys(r.registryURL(name), name) {
+		entry, err := c.Entry(key)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			continue
+		}
+		data, err := c.Content(entry.Integrity)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			continue
+		}
+		p := new(Packument)
+		if err := json.Unmarshal(data, p); err != nil {
+			return nil, fmt.Errorf("invalid cached packument of %s: %v", name, err)
+		}
+		return p, nil
+	}
+	return nil, nil
+}
+
+// PackageMetadata is the registry metadata of a package version
+type PackageMetadata struct {
+	// Deprecated is the deprecation message of the version
+	Deprecated string `json:"deprecated,omitempty"`
+	// Published is the publish time of the version, when known
+	Published   *time.Time `json:"published,omitempty"`
+	Maintainers []string   `json:"maintainers,omitempty"`
+	// UnpackedSize is the size of the published files, when known
+	UnpackedSize int64 `json:"unpacked_size,omitempty"`
+}
+
+// Metadata returns the metadata of a version of the packument, nil when
+// it is not published
+func (p *Packument) Metadata(version string) *PackageMetadata {
+	v, ok := p.Versions[version]
+	if !ok {
+		return nil
+	}
+	m := &PackageMetadata{Deprecated: v.Deprecated, UnpackedSize: v.Dist.UnpackedSize}
+	if t, ok := p.Time[version]; ok {
+		m.Published = &t
+	}
+	maintainers := v.Maintainers
+	if len(maintainers) == 0 {
+		maintainers = p.Maintainers
+	}
+	for _, u := range maintainers {
+		m.Maintainers = append(m.Maintainers, u.Name)
+	}
+	return m
+}
+
+// Enrich sets the metadata of the installed packages found in the cache,
+// without network access. The packages missing from the cache are left
+// as is, and cache errors are returned once every package is read.
+func (c *Cacache) Enrich(r *Registry, result *Result) error {
+	packuments := make(map[string]*Packument)
+	var errs []string
+	for _, i := range result.Instances {
+		p, ok := packuments[i.Name]
+		if !ok {
+			var err error
+			if p, err = c.Packument(r, i.Name); err != nil {
+				errs = append(errs, err.Error())
+			}
+			packuments[i.Name] = p
+		}
+		if p != nil {
+			i.Metadata = p.Metadata(i.Version)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, ", "))
+	}
+	return nil
+}
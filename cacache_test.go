@@ -0,0 +1,153 @@
+package npmblame
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// writeCacache caches contents by key the way npm does, returning their
+// integrity by key
+func writeCacache(t *testing.T, fs afero.Fs, dir string, contents map[string]string) map[string]string {
+	integrities := make(map[string]string)
+	for key, content := range contents {
+		sum := sha512.Sum512([]byte(content))
+		h := hex.EncodeToString(sum[:])
+		if err := afero.WriteFile(fs, filepath.Join(dir, "content-v2", "sha512", h[:2], h[2:4], h[4:]), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		integrity := "sha512-" + base64.StdEncoding.EncodeToString(sum[:])
+		appendCacacheEntry(t, fs, dir, CacacheEntry{Key: key, Integrity: integrity, Size: int64(len(content))})
+		integrities[key] = integrity
+	}
+	return integrities
+}
+
+// appendCacacheEntry appends an entry to the index bucket of its key
+func appendCacacheEntry(t *testing.T, fs afero.Fs, dir string, e CacacheEntry) {
+	data, _ := json.Marshal(e)
+	sum := sha1.Sum(data)
+	appendCacacheLine(t, fs, dir, e.Key, hex.EncodeToString(sum[:])+"\t"+string(data))
+}
+
+func appendCacacheLine(t *testing.T, fs afero.Fs, dir, key, line string) {
+	sum := sha256.Sum256([]byte(key))
+	h := hex.EncodeToString(sum[:])
+	p := filepath.Join(dir, "index-v5", h[:2], h[2:4], h[4:])
+	data, _ := afero.ReadFile(fs, p)
+	if err := afero.WriteFile(fs, p, append(data, "\n"+line...), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacacheEntry(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	integrities := writeCacache(t, fs, "/cache", map[string]string{"a": "first", "b": "second"})
+	c := NewCacache(fs, "/cache")
+
+	appendCacacheLine(t, fs, "/cache", "a", "0000\t{\"key\":\"a\",\"integrity\":\"sha1-corrupted\"}")
+	appendCacacheLine(t, fs, "/cache", "a", "truncated line")
+	entry, err := c.Entry("a")
+	if err != nil || entry == nil || entry.Integrity != integrities["a"] {
+		t.Fatalf("Expected the last valid entry of a got %+v %v", entry, err)
+	}
+	data, err := c.Content(entry.Integrity)
+	if err != nil || string(data) != "first" {
+		t.Errorf("Wrong content %q %v", data, err)
+	}
+
+	appendCacacheEntry(t, fs, "/cache", CacacheEntry{Key: "b"})
+	if entry, err := c.Entry("b"); entry != nil || err != nil {
+		t.Errorf("Expected the deleted entry to be missing got %+v %v", entry, err)
+	}
+	if entry, err := c.Entry("missing"); entry != nil || err != nil {
+		t.Errorf("Expected no entry got %+v %v", entry, err)
+	}
+}
+
+func TestCacacheContent(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	integrity := writeCacache(t, fs, "/cache", map[string]string{"a": "content"})["a"]
+	c := NewCacache(fs, "/cache")
+
+	if data, err := c.Content("md5-xyz " + integrity + "?opt"); err != nil || string(data) != "content" {
+		t.Errorf("Wrong content %q %v", data, err)
+	}
+	missing := sha512.Sum512([]byte("missing"))
+	if data, err := c.Content("sha512-" + base64.StdEncoding.EncodeToString(missing[:])); data != nil || err != nil {
+		t.Errorf("Expected no content got %q %v", data, err)
+	}
+	if _, err := c.Content("md5-xyz"); err == nil {
+		t.Error("Expected an unsupported integrity error")
+	}
+
+	sum, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(integrity, "sha512-"))
+	h := hex.EncodeToString(sum)
+	afero.WriteFile(fs, filepath.Join("/cache", "content-v2", "sha512", h[:2], h[2:4], h[4:]), []byte("tampered"), 0644)
+	if _, err := c.Content(integrity); err == nil || !strings.Contains(err.Error(), "corrupted") {
+		t.Errorf("Expected a corrupted content error got %v", err)
+	}
+}
+
+func TestCacacheEnrich(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	const prefix = "make-fetch-happen:request-cache:https://registry.npmjs.org/"
+	writeCacache(t, fs, "/cache", map[string]string{
+		prefix + "left-pad": `{
+			"name": "left-pad",
+			"maintainers": ["stevemao <steve@example.com>", {"name": "azer"}],
+			"time": {"created": "2014-03-14T00:00:00.000Z", "1.3.0": "2018-04-09T00:00:00.000Z"},
+			"versions": {"1.3.0": {"name": "left-pad", "version": "1.3.0", "deprecated": "use String.prototype.padStart()",
+				"dist": {"tarball": "https://registry.npmjs.org/left-pad/-/left-pad-1.3.0.tgz", "unpackedSize": 12345}}}
+		}`,
+		prefix + "@org%2fpkg": `{
+			"name": "@org/pkg",
+			"time": {"unpublished": {"time": "2020-01-01T00:00:00.000Z"}},
+			"versions": {"1.0.0": {"name": "@org/pkg", "version": "1.0.0", "maintainers": [{"name": "owner", "email": "o@example.com"}]}}
+		}`,
+		prefix + "broken": `{"versions": []}`,
+	})
+
+	result := NewResult()
+	result.Instances = []*Instance{
+		{Name: "left-pad", Version: "1.3.0", Path: "/left-pad"},
+		{Name: "left-pad", Version: "1.3.0", Path: "/a/node_modules/left-pad"},
+		{Name: "@org/pkg", Version: "1.0.0", Path: "/@org/pkg"},
+		{Name: "@org/pkg", Version: "2.0.0", Path: "/b/node_modules/@org/pkg"},
+		{Name: "uncached", Version: "1.0.0", Path: "/uncached"},
+		{Name: "broken", Version: "1.0.0", Path: "/broken"},
+	}
+	err := NewCacache(fs, "/cache").Enrich(NewRegistry(DefaultRegistry), result)
+	if err == nil || !strings.Contains(err.Error(), "invalid cached packument of broken") {
+		t.Errorf("Expected the broken packument error got %v", err)
+	}
+
+	m := result.Instances[0].Metadata
+	published := time.Date(2018, 4, 9, 0, 0, 0, 0, time.UTC)
+	if m == nil || m.Deprecated == "" || m.UnpackedSize != 12345 || m.Published == nil || !m.Published.Equal(published) ||
+		strings.Join(m.Maintainers, ",") != "stevemao,azer" {
+		t.Errorf("Wrong left-pad metadata %+v", m)
+	}
+	if m := result.Instances[2].Metadata; m == nil || m.Published != nil || strings.Join(m.Maintainers, ",") != "owner" {
+		t.Errorf("Wrong @org/pkg metadata %+v", m)
+	}
+	for _, n := range []int{3, 4, 5} {
+		if m := result.Instances[n].Metadata; m != nil {
+			t.Errorf("Expected no metadata for %s got %+v", result.Instances[n].Path, m)
+		}
+	}
+
+	expected := "\n1 installed packages are deprecated:\n  left-pad@1.3.0: use String.prototype.padStart()\n"
+	if !strings.Contains(result.String(), expected) {
+		t.Errorf("Expected %q in:\n%s", expected, result)
+	}
+}
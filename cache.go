@@ -0,0 +1,168 @@
+package npmblame
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/spf13/afero"
+)
+
+// cacheVersion is bumped whenever the cached blame results change shape
+// or the package errors detection changes
+const cacheVersion = 7
+
+// CacheEntry is the cached blame of a single installed package
+type CacheEntry struct {
+	Size   int64                `json:"size"`
+	Errors map[PackageError]int `json:"errors"`
+	Files  []BlamedFile         `json:"files,omitempty"`
+	// Folders are the blamed folders of the package
+	Folders []BlamedFile `json:"folders,omitempty"`
+	// NodeModules lists the node_modules folders published inside the
+	// package files, relative to the package folder. The top level
+	// node_modules depends on the install and is never cached.
+	NodeModules []string `json:"node_modules,omitempty"`
+}
+
+// CacheStats counts the cache lookups of a scan
+type CacheStats struct {
+	Hits   int
+	Misses int
+}
+
+// String returns the printable representation of the CacheStats
+func (cs CacheStats) String() string {
+	return fmt.Sprintf("Cache: %d hits, %d misses", cs.Hits, cs.Misses)
+}
+
+// Cache stores the blame of installed packages on disk.
+// Installed packages are immutable per version so entries are keyed by
+// name, version and integrity, or a folder fingerprint when the
+// integrity is unknown.
+type Cache struct {
+	fs      afero.Fs
+	path    string
+	mu      sync.Mutex
+	entries map[string]CacheEntry
+	stats   CacheStats
+}
+
+type cacheFile struct {
+	Version int                   `json:"version"`
+	Entries map[string]CacheEntry `json:"entries"`
+}
+
+// DefaultCachePath returns the cache location in the user cache folder
+func DefaultCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "npm-blame", "cache.json"), nil
+}
+
+// OpenCache loads the cache stored at path on fs.
+// A missing or outdated cache file gives an empty cache.
+func OpenCache(fs afero.Fs, path string) (*Cache, error) {
+	c := &Cache{
+		fs:      fs,
+		path:    path,
+		entries: make(map[string]CacheEntry),
+	}
+	data, err := afero.ReadFile(fs, path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Entries are only decoded once the version is known to match
+	var file struct {
+		Version int             `json:"version"`
+		Entries json.RawMessage `json:"entries"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid cache %s: %v", path, err)
+	}
+	if file.Version != cacheVersion || file.Entries == nil {
+		return c, nil
+	}
+	if err := json.Unmarshal(file.Entries, &c.entries); err != nil {
+		return nil, fmt.Errorf("invalid cache %s: %v", path, err)
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]CacheEntry)
+	}
+	return c, nil
+}
+
+// CacheKey returns the cache key of an installed package.
+// The integrity is preferred over the folder fingerprint.
+func CacheKey(m *Manifest, fingerprint string) string {
+	if m == nil || m.Name == "" || m.Version == "" {
+		return ""
+	}
+	if m.Integrity != "" {
+		return m.Name + "@" + m.Version + "#" + m.Integrity
+	}
+	return m.Name + "@" + m.Version + "#" + fingerprint
+}
+
+// Get returns the entry stored under key and records the lookup
+func (c *Cache) Get(key string) (CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if ok {
+		c.stats.Hits++
+	} else {
+		c.stats.Misses++
+	}
+	return entry, ok
+}
+
+// Put stores an entry under key
+func (c *Cache) Put(key string, entry CacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = entry
+}
+
+// Clear invalidates every cache entry
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]CacheEntry)
+}
+
+// Len returns the number of cached packages
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Stats returns the lookups recorded since the cache was opened
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// Save writes the cache back to disk
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	data, err := json.Marshal(cacheFile{Version: cacheVersion, Entries: c.entries})
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := c.fs.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	return afero.WriteFile(c.fs, c.path, data, 0644)
+}
@@ -0,0 +1,164 @@
+package npmblame
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestOpenCache(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	t.Run("Missing file", func(t *testing.T) {
+		c, err := OpenCache(fs, "/cache/cache.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Len() != 0 {
+			t.Error("Cache should be empty")
+		}
+	})
+
+	t.Run("Round trip", func(t *testing.T) {
+		c, _ := OpenCache(fs, "/cache/cache.json")
+		c.Put("pkg@1.0.0#sha", CacheEntry{Errors: map[PackageError]int{ImageError: 2}})
+		if err := c.Save(); err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := OpenCache(fs, "/cache/cache.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry, ok := c.Get("pkg@1.0.0#sha")
+		if !ok || entry.Errors[ImageError] != 2 {
+			t.Errorf("Wrong cache entry: %+v", entry)
+		}
+		if stats := c.Stats(); stats.Hits != 1 || stats.Misses != 0 {
+			t.Errorf("Wrong stats: %+v", stats)
+		}
+	})
+
+	t.Run("Outdated version", func(t *testing.T) {
+		afero.WriteFile(fs, "/old.json", []byte(`{"version":1,"entries":{"a@1#b":{"errors":{"1":2}}}}`), 0644)
+		c, err := OpenCache(fs, "/old.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Len() != 0 {
+			t.Error("Outdated cache should be discarded")
+		}
+	})
+
+	t.Run("Invalid file", func(t *testing.T) {
+		afero.WriteFile(fs, "/invalid.json", []byte(`{`), 0644)
+		if _, err := OpenCache(fs, "/invalid.json"); err == nil {
+			t.Error("Expected an invalid cache error")
+		}
+	})
+}
+
+func TestCacheKey(t *testing.T) {
+	tests := []struct {
+		manifest *Manifest
+		want     string
+	}{
+		{nil, ""},
+		{&Manifest{Name: "pkg"}, ""},
+		{&Manifest{Name: "pkg", Version: "1.0.0"}, "pkg@1.0.0#fp"},
+		{&Manifest{Name: "pkg", Version: "1.0.0", Integrity: "sha"}, "pkg@1.0.0#sha"},
+	}
+	for _, test := range tests {
+		if key := CacheKey(test.manifest, "fp"); key != test.want {
+			t.Errorf("CacheKey(%+v) = %s, want %s", test.manifest, key, test.want)
+		}
+	}
+}
+
+func TestClearCache(t *testing.T) {
+	c, _ := OpenCache(afero.NewMemMapFs(), "/cache.json")
+	c.Put("a@1#b", CacheEntry{})
+	c.Clear()
+	if c.Len() != 0 {
+		t.Error("Cache was not cleared")
+	}
+}
+
+func TestScanCache(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	generateNodeModules(fs, 10, 2)
+	// pkg0 is scoped and left without a package.json
+	for i := 1; i < 10; i++ {
+		afero.WriteFile(fs, fmt.Sprintf("/pkg%d/package.json", i),
+			[]byte(fmt.Sprintf(`{"name":"pkg%d","version":"1.0.0"}`, i)), 0644)
+	}
+	res, err := NewScanner(fs, "/", DefaultScanOptions()).Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := res
+
+	cache, _ := OpenCache(afero.NewMemMapFs(), "/cache.json")
+	opts := DefaultScanOptions()
+	opts.Cache = cache
+
+	for _, run := range []string{"Cold", "Warm"} {
+		t.Run(run, func(t *testing.T) {
+			res, err := NewScanner(fs, "/", opts).Scan()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(res.Packages, want.Packages) {
+				t.Errorf("Scan returned %v, want %v", res.Packages, want.Packages)
+			}
+			if !reflect.DeepEqual(res.Instances, want.Instances) {
+				t.Errorf("Scan returned %v, want %v", res.Instances, want.Instances)
+			}
+		})
+	}
+
+	if stats := cache.Stats(); stats.Hits != 9 || stats.Misses != 9 {
+		t.Errorf("Wrong cache stats: %+v", stats)
+	}
+}
+
+func TestScanCacheNestedLayout(t *testing.T) {
+	cache, _ := OpenCache(afero.NewMemMapFs(), "/cache.json")
+	opts := DefaultScanOptions()
+	opts.Cache = cache
+	manifest := []byte(`{"name":"foo","version":"1.0.0","_integrity":"sha512-foo"}`)
+
+	// The same foo release installed without, then with nested packages
+	flat := afero.NewMemMapFs()
+	afero.WriteFile(flat, "/foo/package.json", manifest, 0644)
+	afero.WriteFile(flat, "/bar/index.js", nil, 0644)
+	nested := afero.NewMemMapFs()
+	afero.WriteFile(nested, "/foo/package.json", manifest, 0644)
+	afero.WriteFile(nested, "/foo/node_modules/bar/index.js", nil, 0644)
+
+	for _, tc := range []struct {
+		fs       afero.Fs
+		expected []string
+	}{
+		{flat, []string{"/bar", "/foo"}},
+		{nested, []string{"/foo", "/foo/node_modules/bar"}},
+		{flat, []string{"/bar", "/foo"}},
+	} {
+		res, err := NewScanner(tc.fs, "/", opts).Scan()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var paths []string
+		for _, i := range res.Instances {
+			paths = append(paths, i.Path)
+		}
+		if !reflect.DeepEqual(paths, tc.expected) {
+			t.Errorf("Expected %v got %v", tc.expected, paths)
+		}
+	}
+	if stats := cache.Stats(); stats.Hits != 2 {
+		t.Errorf("Expected foo to be cached, got %+v", stats)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/spf13/afero"
+	npmblame "github.com/talend-glorieux/npm-blame"
+)
+
+// attributeCommand rolls the blame up to the direct dependencies
+func attributeCommand(args []string) {
+	flags := flag.NewFlagSet("npm-blame attribute", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: npm-blame attribute [flags]")
+		fmt.Fprintln(flags.Output(), "Shows the waste each direct dependency brings in, alone or shared with others.")
+		flags.PrintDefaults()
+	}
+	var lockfile = flags.String("lockfile", "", "package-lock.json, yarn.lock or pnpm-lock.yaml (defaults to the one next to the node_modules folder)")
+	var jsonOutput = flags.Bool("json", false, "print the attribution as JSON")
+	sf := addScanFlags(flags)
+	flags.Parse(args)
+
+	fs := afero.NewOsFs()
+	if *lockfile == "" {
+		project, err := projectDir(*sf.root)
+		if err == nil {
+			*lockfile, err = npmblame.FindLockfile(fs, project)
+		}
+		if err != nil {
+			fmt.Println("Lockfile error.", err)
+			os.Exit(-1)
+		}
+	}
+	graph, err := npmblame.ReadLockfile(fs, *lockfile)
+	if err != nil {
+		fmt.Println("Lockfile error.", err)
+		os.Exit(-1)
+	}
+
+	result, err := sf.scan()
+	if err != nil {
+		fmt.Println("Scan error.", err)
+		os.Exit(-1)
+	}
+
+	attributions := npmblame.Attribute(graph, result)
+	if *jsonOutput {
+		if err := attributions.WriteJSON(os.Stdout); err != nil {
+			fmt.Println("JSON encoding error.", err)
+			os.Exit(-1)
+		}
+		return
+	}
+	fmt.Print(attributions)
+}
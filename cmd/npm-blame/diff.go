@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	npmblame "github.com/talend-glorieux/npm-blame"
+)
+
+// diffCommand compares a saved baseline against a saved or live scan
+func diffCommand(args []string) {
+	flags := flag.NewFlagSet("npm-blame diff", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: npm-blame diff [flags] baseline.json [current.json]")
+		fmt.Fprintln(flags.Output(), "Without current.json the node_modules folder is scanned.")
+		flags.PrintDefaults()
+	}
+	var jsonOutput = flags.Bool("json", false, "print the diff as JSON")
+	sf := addScanFlags(flags)
+	flags.Parse(args)
+
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+		os.Exit(-1)
+	}
+
+	baseline, err := readResult(flags.Arg(0))
+	if err != nil {
+		fmt.Println("Baseline reading error.", err)
+		os.Exit(-1)
+	}
+
+	var current *npmblame.Result
+	if flags.NArg() == 2 {
+		current, err = readResult(flags.Arg(1))
+	} else {
+		current, err = sf.scan()
+	}
+	if err != nil {
+		fmt.Println("Scan error.", err)
+		os.Exit(-1)
+	}
+
+	diff := npmblame.NewDiff(baseline, current)
+	if *jsonOutput {
+		if err := diff.WriteJSON(os.Stdout); err != nil {
+			fmt.Println("JSON encoding error.", err)
+			os.Exit(-1)
+		}
+		return
+	}
+	fmt.Print(diff)
+}
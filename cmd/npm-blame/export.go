@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	npmblame "github.com/talend-glorieux/npm-blame"
+)
+
+// exportCommand prints the detection rules in a cleanup tool format
+func exportCommand(args []string) {
+	flags := flag.NewFlagSet("npm-blame export", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: npm-blame export [flags] %s\n", strings.Join(npmblame.ExportFormats, "|"))
+		fmt.Fprintln(flags.Output(), "Prints the detection rules as a .yarnclean file, a find script or a Dockerfile RUN instruction.")
+		flags.PrintDefaults()
+	}
+	var categories = flags.String("categories", "test,bench,image,ci,dotfile,secret,vcs",
+		"comma separated package errors to export")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(-1)
+	}
+
+	var selected []npmblame.PackageError
+	for _, name := range strings.Split(*categories, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		var category npmblame.PackageError
+		if err := category.UnmarshalText([]byte(name)); err != nil {
+			fmt.Println("Category error.", err)
+			os.Exit(-1)
+		}
+		selected = append(selected, category)
+	}
+
+	if err := npmblame.Export(os.Stdout, flags.Arg(0), selected); err != nil {
+		fmt.Println("Export error.", err)
+		os.Exit(-1)
+	}
+}
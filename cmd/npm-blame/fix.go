@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+	npmblame "github.com/talend-glorieux/npm-blame"
+)
+
+// fixCommand opens a pull request keeping the blamed files of a package
+// out of its published tarball
+func fixCommand(args []string) {
+	flags := flag.NewFlagSet("npm-blame fix", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: npm-blame fix [flags] package")
+		fmt.Fprintln(flags.Output(), "Forks the package repository and opens a pull request adding a files field or a .npmignore.")
+		flags.PrintDefaults()
+	}
+	gf := addGitHubFlags(flags)
+	var repo = flags.String("repo", "", "GitHub repository of the package, as owner/repo, by default the repository of its package.json")
+	var dryRun = flags.Bool("dry-run", false, "print the fix computed from the installed package.json instead of opening a pull request")
+	sf := addScanFlags(flags)
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(-1)
+	}
+	auth, err := gf.auth()
+	if err != nil {
+		fmt.Println("GitHub authentication error.", err)
+		os.Exit(-1)
+	}
+	if !*dryRun && !authenticated(auth) {
+		fmt.Println("Please provide a GitHub token in $GITHUB_TOKEN, ~/.netrc, the gh CLI or the -token flag.")
+		os.Exit(-1)
+	}
+
+	result, err := sf.scan()
+	if err != nil {
+		fmt.Println("Scan error.", err)
+		os.Exit(-1)
+	}
+	var instance *npmblame.Instance
+	for _, i := range result.Instances {
+		if i.Name == flags.Arg(0) {
+			instance = i
+			break
+		}
+	}
+	if instance == nil {
+		fmt.Printf("Package error. %s is not installed\n", flags.Arg(0))
+		os.Exit(-1)
+	}
+
+	fs := afero.NewOsFs()
+	dir := filepath.Join(*sf.root, filepath.FromSlash(instance.Path))
+	fixer := func(manifest, npmignore []byte) (*npmblame.Fix, error) {
+		return npmblame.NewFix(fs, dir, instance, manifest, npmignore)
+	}
+
+	if *dryRun {
+		manifest, err := afero.ReadFile(fs, filepath.Join(dir, "package.json"))
+		if err != nil {
+			fmt.Println("Manifest error.", err)
+			os.Exit(-1)
+		}
+		fix, err := fixer(manifest, nil)
+		if err != nil {
+			fmt.Println("Fix error.", err)
+			os.Exit(-1)
+		}
+		fmt.Printf("%s\n\n%s\n%s", fix.Path, fix.Content, fix.Description)
+		return
+	}
+
+	var report *npmblame.Report
+	if *repo != "" {
+		parts := strings.SplitN(*repo, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			flags.Usage()
+			os.Exit(-1)
+		}
+		report = npmblame.NewReport(parts[0], parts[1], nil)
+	} else {
+		m, err := npmblame.ReadManifest(fs, dir)
+		if err != nil {
+			fmt.Println("Manifest error.", err)
+			os.Exit(-1)
+		}
+		source, err := m.SourceRepository()
+		if err != nil {
+			fmt.Printf("Repository error. %s: %v\n", instance.Name, err)
+			os.Exit(-1)
+		}
+		if source.Host != auth.Host {
+			fmt.Printf("Repository error. %s is not a GitHub repository\n", source.URL())
+			os.Exit(-1)
+		}
+		report = npmblame.NewReport(source.Owner, source.Name, nil)
+		report.Directory = source.Directory
+	}
+	client, err := npmblame.NewGitHubClient(auth)
+	if err != nil {
+		fmt.Println("GitHub authentication error.", err)
+		os.Exit(-1)
+	}
+	pr, err := report.OpenPullRequest(client, npmblame.FixBranch(instance), fixer)
+	if err != nil {
+		fmt.Println("Pull request error.", err)
+		os.Exit(-1)
+	}
+	if pr.HTMLURL != nil {
+		fmt.Println("Opened", *pr.HTMLURL)
+	}
+}
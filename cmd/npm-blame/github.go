@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/spf13/afero"
+	npmblame "github.com/talend-glorieux/npm-blame"
+)
+
+// githubFlags are the GitHub authentication flags
+type githubFlags struct {
+	token          *string
+	host           *string
+	apiURL         *string
+	uploadURL      *string
+	appID          *int64
+	installationID *int64
+	appKey         *string
+}
+
+// addGitHubFlags defines the GitHub authentication flags on fs
+func addGitHubFlags(fs *flag.FlagSet) *githubFlags {
+	return &githubFlags{
+		token:          fs.String("token", "", "GitHub token with public repo activated, by default read from $GITHUB_TOKEN, ~/.netrc or the gh CLI hosts file"),
+		host:           fs.String("github-host", "github.com", "GitHub host, such as a GitHub Enterprise server"),
+		apiURL:         fs.String("github-api-url", "", "GitHub API URL, by default https://host/api/v3/ for GitHub Enterprise"),
+		uploadURL:      fs.String("github-upload-url", "", "GitHub upload URL, by default https://host/api/uploads/ for GitHub Enterprise"),
+		appID:          fs.Int64("github-app-id", 0, "authenticate as this GitHub App, with -github-installation-id and -github-app-key"),
+		installationID: fs.Int64("github-installation-id", 0, "GitHub App installation ID"),
+		appKey:         fs.String("github-app-key", "", "GitHub App private key PEM file"),
+	}
+}
+
+// auth returns the GitHub authentication of the flags. Without token nor
+// app flags, the token is looked up in the environment and config files.
+func (gf *githubFlags) auth() (npmblame.GitHubAuth, error) {
+	auth := npmblame.GitHubAuth{
+		Host:      *gf.host,
+		BaseURL:   *gf.apiURL,
+		UploadURL: *gf.uploadURL,
+		Token:     *gf.token,
+	}
+	if *gf.appID != 0 {
+		if *gf.installationID == 0 || *gf.appKey == "" {
+			return auth, fmt.Errorf("-github-app-id needs -github-installation-id and -github-app-key")
+		}
+		key, err := ioutil.ReadFile(*gf.appKey)
+		if err != nil {
+			return auth, err
+		}
+		auth.App = &npmblame.GitHubApp{ID: *gf.appID, InstallationID: *gf.installationID, PrivateKey: key}
+		return auth, nil
+	}
+	if auth.Token == "" {
+		token, _, err := npmblame.LookupGitHubToken(afero.NewOsFs(), auth.Host)
+		if err != nil {
+			return auth, err
+		}
+		auth.Token = token
+	}
+	return auth, nil
+}
+
+// authenticated reports whether the authentication has credentials
+func authenticated(auth npmblame.GitHubAuth) bool {
+	return auth.Token != "" || auth.App != nil
+}
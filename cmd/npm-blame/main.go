@@ -4,44 +4,170 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"path/filepath"
-	"strings"
+	"time"
 
+	"github.com/spf13/afero"
 	npmblame "github.com/talend-glorieux/npm-blame"
 )
 
 func main() {
-	var report = flag.Bool("report", false, `Report the issues to there owner
-	(should always be used with the token flag)`)
-	var token = flag.String("token", "", "GitHub token with public repo activated used for reporting")
-	flag.Parse()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "diff":
+			diffCommand(os.Args[2:])
+			return
+		case "attribute":
+			attributeCommand(os.Args[2:])
+			return
+		case "why":
+			whyCommand(os.Args[2:])
+			return
+		case "prune":
+			pruneCommand(os.Args[2:])
+			return
+		case "export":
+			exportCommand(os.Args[2:])
+			return
+		case "fix":
+			fixCommand(os.Args[2:])
+			return
+		case "status":
+			statusCommand(os.Args[2:])
+			return
+		case "upgrade":
+			upgradeCommand(os.Args[2:])
+			return
+		}
+	}
+	blameCommand(os.Args[1:])
+}
+
+// blameCommand scans the node_modules folder and prints the blamed packages
+func blameCommand(args []string) {
+	flags := flag.NewFlagSet("npm-blame", flag.ExitOnError)
+	var report = flags.Bool("report", false, `Report the issues to there owner
+	(should always be used with a GitHub token)`)
+	gf := addGitHubFlags(flags)
+	var titleTemplate = flags.String("title-template", "", "text/template file of the report titles")
+	var bodyTemplate = flags.String("body-template", "", "text/template file of the report bodies, in markdown")
+	var targetRules = flags.String("target-rules", "", `comma separated actions of the repositories not accepting reports, such as
+	"archived=skip,inactive=report"; the archived, disabled, missing and noissues
+	repositories are reported to the bugs URL, inactive ones skipped, by default`)
+	var inactiveDays = flags.Int("inactive-days", 730, "days without push after which a repository is inactive, 0 for never")
+	var upstream = flags.Bool("upstream", true, "check the default branch of the repositories and skip the packages fixed upstream")
+	var labels = flags.String("labels", "", "comma separated labels of the reports, created when missing if allowed")
+	var milestone = flags.String("milestone", "", "title of the open milestone of the reports")
+	var assignees = flags.String("assignees", "", "comma separated user names assigned to the reports")
+	var outboxPath = flags.String("outbox", "", "file queuing the reports and recording the created issues, in the user config folder by default")
+	var jsonOutput = flags.Bool("json", false, "print the results as JSON")
+	var policyPath = flags.String("policy", "", "JSON policy file; exit with status 1 when it is violated")
+	var verbose = flags.Bool("verbose", false, "list the suppressed errors")
+	var metadata = flags.Bool("metadata", false, "add the deprecation, publish time, maintainers and size of the packages from the npm cache, offline")
+	var npmCache = flags.String("npm-cache", "", "npm cacache folder read by -metadata, ~/.npm/_cacache by default")
+	sf := addScanFlags(flags)
+	flags.Parse(args)
 
-	if *report && *token == "" {
-		fmt.Println("Please provide a token with public access for GitHub reporting by using the -token flag. https://help.github.com/articles/creating-an-access-token-for-command-line-use")
+	var auth npmblame.GitHubAuth
+	if *report {
+		var err error
+		if auth, err = gf.auth(); err != nil {
+			fmt.Println("GitHub authentication error.", err)
+			os.Exit(-1)
+		}
+		if !authenticated(auth) {
+			fmt.Println("Please provide a token with public access for GitHub reporting in $GITHUB_TOKEN, ~/.netrc, the gh CLI or the -token flag. https://help.github.com/articles/creating-an-access-token-for-command-line-use")
+			os.Exit(-1)
+		}
+	}
+	tmpl, err := loadReportTemplate(*titleTemplate, *bodyTemplate)
+	if err != nil {
+		fmt.Println("Template error.", err)
 		os.Exit(-1)
 	}
+	rules, err := npmblame.ParseTargetRules(*targetRules)
+	if err != nil {
+		fmt.Println("Target rules error.", err)
+		os.Exit(-1)
+	}
+	rules.InactiveAfter = time.Duration(*inactiveDays) * 24 * time.Hour
 
-	np := npmblame.NewNpmPackages()
-	if err := filepath.Walk(".", np.Blame); err != nil {
+	var policy *npmblame.Policy
+	if *policyPath != "" {
+		var err error
+		policy, err = npmblame.LoadPolicy(afero.NewOsFs(), *policyPath)
+		if err != nil {
+			fmt.Println("Policy error.", err)
+			os.Exit(-1)
+		}
+	}
+
+	result, err := sf.scan()
+	if err != nil && (result == nil || !result.Partial) {
 		fmt.Println("File system traversing error.", err)
 		os.Exit(-1)
 	}
-	fmt.Print(np)
+	if *metadata {
+		enrichMetadata(result, *sf.root, *npmCache)
+	}
+	if *jsonOutput {
+		if err := result.WriteJSON(os.Stdout); err != nil {
+			fmt.Println("JSON encoding error.", err)
+			os.Exit(-1)
+		}
+	} else {
+		fmt.Print(result)
+		if *verbose && len(result.Suppressed) > 0 {
+			fmt.Println()
+			fmt.Print(result.SuppressedString())
+		}
+		if sf.cache != nil {
+			fmt.Println(sf.cache.Stats())
+		}
+	}
+	if result.Partial {
+		os.Exit(-1)
+	}
+	if policy != nil {
+		if violations := policy.Check(result); len(violations) > 0 {
+			fmt.Fprint(os.Stderr, npmblame.FormatViolations(violations))
+			os.Exit(1)
+		}
+	}
 
 	if *report {
-		fmt.Println("Do you want to report all of those issues? (Y/N)")
-		var yn string
-		fmt.Scanf("%s", &yn)
-		if strings.ToLower(yn) == "y" || strings.ToLower(yn) == "yes" {
-			fmt.Println("Reporting...")
-			// TODO: Generate true report per packages
-			report := npmblame.NewReport("talend-glorieux", "npm-blame", []int{42})
-			issue, err := report.Send(npmblame.DefaultClient(*token))
-			if err != nil {
-				fmt.Println("ERROR", err)
-				os.Exit(-1)
-			}
-			fmt.Printf("Created issue %d", issue.Number)
-		}
+		reportPackages(result, *sf.root, reportOptions{
+			outboxPath: *outboxPath,
+			template:   tmpl,
+			trackers: npmblame.TrackerOptions{
+				GitHub: map[string]npmblame.GitHubAuth{auth.Host: auth},
+			},
+			rules:     rules,
+			upstream:  *upstream,
+			labels:    splitList(*labels),
+			milestone: *milestone,
+			assignees: splitList(*assignees),
+		})
+	}
+}
+
+// enrichMetadata adds the registry metadata of the npm cache to the
+// packages. Cache errors are kept as warnings of the result.
+func enrichMetadata(result *npmblame.Result, root, dir string) {
+	if dir == "" {
+		dir = npmblame.DefaultCacacheDir()
+	}
+	// The packuments are cached by registry URL, read from .npmrc
+	project, err := projectDir(root)
+	if err != nil {
+		result.Warnings = append(result.Warnings, "npm cache: "+err.Error())
+		return
+	}
+	registry, err := npmblame.LoadRegistry(afero.NewOsFs(), project)
+	if err != nil {
+		result.Warnings = append(result.Warnings, "npmrc: "+err.Error())
+		return
+	}
+	if err := npmblame.NewCacache(afero.NewOsFs(), dir).Enrich(registry, result); err != nil {
+		result.Warnings = append(result.Warnings, "npm cache: "+err.Error())
 	}
 }
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/afero"
+	npmblame "github.com/talend-glorieux/npm-blame"
+)
+
+// pruneCommand removes the blamed files of the selected categories
+func pruneCommand(args []string) {
+	flags := flag.NewFlagSet("npm-blame prune", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: npm-blame prune -categories test,bench [flags]")
+		fmt.Fprintln(flags.Output(), "       npm-blame prune -restore undo.tar [-root node_modules]")
+		fmt.Fprintln(flags.Output(), "Removes the blamed files, except the ones referenced by main, bin, exports and types.")
+		flags.PrintDefaults()
+	}
+	var categories = flags.String("categories", "", "comma separated package errors whose files are removed")
+	var dryRun = flags.Bool("dry-run", false, "list the files to remove without removing them")
+	var archivePath = flags.String("archive", "", "tar archive of the removed files, to undo the prune with -restore")
+	var manifestPath = flags.String("manifest", "", "JSON manifest of the removed files")
+	var restore = flags.String("restore", "", "restore the files of a prune archive")
+	var jsonOutput = flags.Bool("json", false, "print the removed files as JSON")
+	sf := addScanFlags(flags)
+	flags.Parse(args)
+
+	fs := afero.NewOsFs()
+	if *restore != "" {
+		restored, err := restoreArchive(fs, *sf.root, *restore)
+		fmt.Printf("%d files restored.\n", restored)
+		if err != nil {
+			fmt.Println("Restore error.", err)
+			os.Exit(-1)
+		}
+		return
+	}
+
+	opts := npmblame.PruneOptions{DryRun: *dryRun}
+	for _, name := range strings.Split(*categories, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		var category npmblame.PackageError
+		if err := category.UnmarshalText([]byte(name)); err != nil {
+			fmt.Println("Category error.", err)
+			os.Exit(-1)
+		}
+		opts.Categories = append(opts.Categories, category)
+	}
+	if len(opts.Categories) == 0 {
+		flags.Usage()
+		os.Exit(-1)
+	}
+
+	result, err := sf.scan()
+	if err != nil {
+		fmt.Println("Scan error.", err)
+		os.Exit(-1)
+	}
+
+	if *dryRun {
+		*archivePath = ""
+	}
+	report, pruneErr := pruneArchived(fs, *sf.root, result, opts, *archivePath)
+	if report == nil {
+		fmt.Println("Archive error.", pruneErr)
+		os.Exit(-1)
+	}
+
+	if *manifestPath != "" {
+		if err := writeFile(*manifestPath, report.WriteJSON); err != nil {
+			fmt.Println("Manifest error.", err)
+			os.Exit(-1)
+		}
+	}
+	if *jsonOutput {
+		if err := report.WriteJSON(os.Stdout); err != nil {
+			fmt.Println("JSON encoding error.", err)
+			os.Exit(-1)
+		}
+	} else {
+		fmt.Print(report)
+	}
+	if pruneErr != nil {
+		fmt.Println("Prune error.", pruneErr)
+		os.Exit(-1)
+	}
+}
+
+// pruneArchived prunes the scanned root, archiving the removed files to
+// archivePath when set. The archive is closed before returning, on errors
+// too, so that the files removed before them can be restored.
+func pruneArchived(fs afero.Fs, root string, result *npmblame.Result, opts npmblame.PruneOptions, archivePath string) (*npmblame.PruneReport, error) {
+	if archivePath == "" {
+		return npmblame.Prune(fs, root, result, opts)
+	}
+	f, err := os.Create(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	opts.Archive = f
+	report, err := npmblame.Prune(fs, root, result, opts)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return report, err
+}
+
+// restoreArchive restores the files of a prune archive into the root
+func restoreArchive(fs afero.Fs, root, archivePath string) (int, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return npmblame.Restore(fs, root, f)
+}
+
+// writeFile creates a file with the output of write
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+	npmblame "github.com/talend-glorieux/npm-blame"
+)
+
+// reportOptions configure reportPackages
+type reportOptions struct {
+	outboxPath string
+	template   *npmblame.ReportTemplate
+	trackers   npmblame.TrackerOptions
+	rules      npmblame.TargetRules
+	// upstream checks the default branch of the repositories
+	upstream  bool
+	labels    []string
+	milestone string
+	assignees []string
+}
+
+// reportPackages reviews the report to the tracker of every blamed
+// package not reviewed yet, after listing the packages that have no
+// reachable tracker or are skipped by the target rules, and sends them
+// along with the unfinished reports of the previous runs. With upstream,
+// the findings fixed on the default branch of the repositories are
+// labeled, and the packages fixed upstream listed instead of reported.
+func reportPackages(result *npmblame.Result, root string, opts reportOptions) {
+	fs := afero.NewOsFs()
+	outbox := openOutbox(opts.outboxPath)
+
+	var candidates []*npmblame.ReviewCandidate
+	var unreachable, fixedUpstream []string
+	seen := make(map[string]bool)
+	for _, i := range result.Instances {
+		if len(i.Errors) == 0 || seen[i.Name] {
+			continue
+		}
+		seen[i.Name] = true
+		if outbox.Decided(i) {
+			if e := outbox.Entry(i.Name); !e.Pending() {
+				fmt.Println(e)
+			}
+			continue
+		}
+		m, err := npmblame.ReadManifest(fs, filepath.Join(root, filepath.FromSlash(i.Path)))
+		if err != nil {
+			unreachable = append(unreachable, fmt.Sprintf("%s has no reachable tracker: %v", i.Name, err))
+			continue
+		}
+		target, err := npmblame.ReportTarget(m, opts.trackers, opts.rules)
+		if err != nil {
+			unreachable = append(unreachable, err.Error())
+			continue
+		}
+		data := npmblame.NewReportData(i, target.Repository)
+		if opts.upstream {
+			status, err := npmblame.CheckUpstream(target, i)
+			switch {
+			case err != nil:
+				fmt.Printf("%s: upstream check error. %v\n", i.Name, err)
+			case status.AllFixed(i):
+				fixedUpstream = append(fixedUpstream, fmt.Sprintf("%s@%s: %s on %s", i.Name, i.Version, npmblame.FixedUpstreamLabel, status.Branch))
+				continue
+			default:
+				status.Label(data)
+			}
+		}
+		report, err := opts.template.RenderData(data)
+		if err != nil {
+			fmt.Println("Template error.", err)
+			os.Exit(-1)
+		}
+		report.Labels, report.Milestone, report.Assignees = opts.labels, opts.milestone, opts.assignees
+		candidates = append(candidates, &npmblame.ReviewCandidate{
+			Instance:   i,
+			Repository: target.Repository,
+			Report:     report,
+			Notes:      target.Notes,
+		})
+	}
+
+	if len(unreachable) > 0 {
+		fmt.Printf("%d packages can not be reported:\n", len(unreachable))
+		for _, u := range unreachable {
+			fmt.Println("  " + u)
+		}
+	}
+	if len(fixedUpstream) > 0 {
+		fmt.Printf("%d packages are fixed upstream and not reported:\n", len(fixedUpstream))
+		for _, f := range fixedUpstream {
+			fmt.Println("  " + f)
+		}
+	}
+	resumed := len(outbox.Pending())
+	if len(candidates) == 0 && resumed == 0 {
+		fmt.Println("No package to report.")
+		return
+	}
+	if len(candidates) > 0 {
+		reviewer := &npmblame.Reviewer{In: os.Stdin, Out: os.Stdout}
+		if _, err := reviewer.Review(outbox, candidates); err != nil {
+			fmt.Println("Review error.", err)
+			os.Exit(-1)
+		}
+	}
+	if len(outbox.Pending()) == 0 {
+		return
+	}
+	if resumed > 0 {
+		fmt.Printf("Resuming %d unfinished reports.\n", resumed)
+	}
+
+	fmt.Println("Reporting...")
+	failed := false
+	err := outbox.Flush(func(host string) (npmblame.Tracker, error) {
+		return npmblame.NewTracker(host, opts.trackers)
+	}, func(e *npmblame.OutboxEntry) {
+		fmt.Println(e)
+		failed = failed || e.Failed
+	})
+	if err != nil {
+		fmt.Println("Outbox error.", err)
+		os.Exit(-1)
+	}
+	if pending := outbox.Pending(); len(pending) > 0 {
+		fmt.Printf("%d reports are waiting for a rate limit and will be sent on the next run.\n", len(pending))
+		os.Exit(-1)
+	}
+	if failed {
+		os.Exit(-1)
+	}
+}
+
+// splitList splits a comma separated flag, ignoring blank items
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// openOutbox opens the outbox file, by default in the user config folder
+func openOutbox(path string) *npmblame.Outbox {
+	if path == "" {
+		var err error
+		if path, err = npmblame.DefaultOutboxPath(); err != nil {
+			fmt.Println("Outbox error.", err)
+			os.Exit(-1)
+		}
+	}
+	outbox, err := npmblame.OpenOutbox(afero.NewOsFs(), path)
+	if err != nil {
+		fmt.Println("Outbox error.", err)
+		os.Exit(-1)
+	}
+	return outbox
+}
+
+// loadReportTemplate returns the report template of the title and body
+// template files, the default templates being used for missing files
+func loadReportTemplate(titlePath, bodyPath string) (*npmblame.ReportTemplate, error) {
+	if titlePath == "" && bodyPath == "" {
+		return npmblame.DefaultReportTemplate(), nil
+	}
+	title, body := npmblame.DefaultTitleTemplate, npmblame.DefaultBodyTemplate
+	for _, t := range []struct {
+		path     string
+		template *string
+	}{{titlePath, &title}, {bodyPath, &body}} {
+		if t.path == "" {
+			continue
+		}
+		data, err := ioutil.ReadFile(t.path)
+		if err != nil {
+			return nil, err
+		}
+		*t.template = string(data)
+	}
+	return npmblame.NewReportTemplate(title, body)
+}
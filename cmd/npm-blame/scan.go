@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/afero"
+	npmblame "github.com/talend-glorieux/npm-blame"
+)
+
+// scanFlags are the flags of the commands scanning a node_modules folder
+type scanFlags struct {
+	root         *string
+	workers      *int
+	noCache      *bool
+	clearCache   *bool
+	strict       *bool
+	timeout      *time.Duration
+	suppressions *string
+
+	// cache is the cache used by the last scan, if any
+	cache *npmblame.Cache
+}
+
+func addScanFlags(fs *flag.FlagSet) *scanFlags {
+	return &scanFlags{
+		root:       fs.String("root", ".", "node_modules folder to scan"),
+		workers:    fs.Int("workers", 0, "number of packages scanned concurrently (defaults to the number of CPUs)"),
+		noCache:    fs.Bool("no-cache", false, "blame every package instead of reusing cached results"),
+		clearCache: fs.Bool("clear-cache", false, "invalidate the cached results before scanning"),
+		strict:     fs.Bool("strict", false, "stop on the first file system error"),
+		timeout:    fs.Duration("timeout", 0, "stop the scan after the given duration and print partial results"),
+		suppressions: fs.String("suppressions", "",
+			"JSON file of accepted package errors hidden from the results (defaults to "+npmblame.DefaultSuppressionsFile+" in the project folder)"),
+	}
+}
+
+// scan blames the node_modules folder until it is done, interrupted
+// or timed out. The cached results are saved afterwards and the
+// suppressions applied.
+func (sf *scanFlags) scan() (*npmblame.Result, error) {
+	suppressions, err := sf.loadSuppressions()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := npmblame.DefaultScanOptions()
+	opts.Workers = *sf.workers
+	opts.Strict = *sf.strict
+	if !*sf.noCache {
+		cache, err := openCache(*sf.clearCache)
+		if err != nil {
+			return nil, err
+		}
+		opts.Cache = cache
+		sf.cache = cache
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *sf.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *sf.timeout)
+		defer cancel()
+	}
+	scanner := npmblame.NewScanner(afero.NewOsFs(), *sf.root, opts)
+	result, err := scanner.ScanContext(ctx)
+	if opts.Cache != nil {
+		if err := opts.Cache.Save(); err != nil {
+			return result, err
+		}
+	}
+	if result != nil {
+		suppressions.Apply(result, time.Now())
+	}
+	return result, err
+}
+
+// loadSuppressions reads the -suppressions file, or the default one of
+// the project folder
+func (sf *scanFlags) loadSuppressions() (*npmblame.Suppressions, error) {
+	suppressionsPath := *sf.suppressions
+	if suppressionsPath == "" {
+		project, err := projectDir(*sf.root)
+		if err != nil {
+			return nil, err
+		}
+		suppressionsPath = filepath.Join(project, npmblame.DefaultSuppressionsFile)
+	}
+	return npmblame.LoadSuppressions(afero.NewOsFs(), suppressionsPath)
+}
+
+// projectDir returns the project folder of a node_modules folder, which
+// holds the lockfile, .npmrc and suppressions of the project
+func projectDir(root string) (string, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Dir(root), nil
+}
+
+// openCache opens the user cache of blamed packages
+func openCache(clear bool) (*npmblame.Cache, error) {
+	path, err := npmblame.DefaultCachePath()
+	if err != nil {
+		return nil, err
+	}
+	cache, err := npmblame.OpenCache(afero.NewOsFs(), path)
+	if err != nil {
+		return nil, err
+	}
+	if clear {
+		cache.Clear()
+	}
+	return cache, nil
+}
+
+// readResult reads a scan result saved with the -json flag
+func readResult(path string) (*npmblame.Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return npmblame.ReadResult(f)
+}
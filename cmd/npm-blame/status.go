@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	npmblame "github.com/talend-glorieux/npm-blame"
+)
+
+// statusCommand refreshes the status of the sent reports
+func statusCommand(args []string) {
+	flags := flag.NewFlagSet("npm-blame status", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: npm-blame status [flags]")
+		fmt.Fprintln(flags.Output(), "Refreshes the issues of the sent reports and lists the fixed, ignored and open ones.")
+		flags.PrintDefaults()
+	}
+	var thank = flags.Bool("thank", false, `comment "fixed in vX, thanks" on the open issues of fixed reports`)
+	var outboxPath = flags.String("outbox", "", "file recording the sent reports, in the user config folder by default")
+	var jsonOutput = flags.Bool("json", false, "print the statuses as JSON")
+	gf := addGitHubFlags(flags)
+	sf := addScanFlags(flags)
+	flags.Parse(args)
+
+	auth, err := gf.auth()
+	if err != nil {
+		fmt.Println("GitHub authentication error.", err)
+		os.Exit(-1)
+	}
+	outbox := openOutbox(*outboxPath)
+	result, err := sf.scan()
+	if err != nil {
+		fmt.Println("Scan error.", err)
+		os.Exit(-1)
+	}
+
+	opts := npmblame.TrackerOptions{GitHub: map[string]npmblame.GitHubAuth{auth.Host: auth}}
+	statuses, err := outbox.Refresh(result, func(host string) (npmblame.Tracker, error) {
+		return npmblame.NewTracker(host, opts)
+	}, npmblame.RefreshOptions{Thank: *thank})
+	if err != nil {
+		fmt.Println("Outbox error.", err)
+		os.Exit(-1)
+	}
+	if *jsonOutput {
+		if err := statuses.WriteJSON(os.Stdout); err != nil {
+			fmt.Println("JSON encoding error.", err)
+			os.Exit(-1)
+		}
+		return
+	}
+	fmt.Print(statuses)
+}
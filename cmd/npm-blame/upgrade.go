@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/spf13/afero"
+	npmblame "github.com/talend-glorieux/npm-blame"
+)
+
+// upgradeCommand blames the newer versions of the blamed packages
+func upgradeCommand(args []string) {
+	flags := flag.NewFlagSet("npm-blame upgrade", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: npm-blame upgrade [flags]")
+		fmt.Fprintln(flags.Output(), "Downloads the newer versions of the blamed packages and tells how much waste upgrading removes.")
+		flags.PrintDefaults()
+	}
+	var registryURL = flags.String("registry", "", "npm registry URL, read from .npmrc by default")
+	var jsonOutput = flags.Bool("json", false, "print the upgrades as JSON")
+	sf := addScanFlags(flags)
+	flags.Parse(args)
+
+	// The project .npmrc is next to the node_modules folder
+	project, err := projectDir(*sf.root)
+	if err != nil {
+		fmt.Println("Root error.", err)
+		os.Exit(-1)
+	}
+	registry, err := npmblame.LoadRegistry(afero.NewOsFs(), project)
+	if err != nil {
+		fmt.Println("npmrc error.", err)
+		os.Exit(-1)
+	}
+	if *registryURL != "" {
+		registry.URL = *registryURL
+	}
+
+	suppressions, err := sf.loadSuppressions()
+	if err != nil {
+		fmt.Println("Suppressions error.", err)
+		os.Exit(-1)
+	}
+	result, err := sf.scan()
+	if err != nil {
+		fmt.Println("Scan error.", err)
+		os.Exit(-1)
+	}
+	upgrades := registry.Advise(result, suppressions)
+	if *jsonOutput {
+		if err := upgrades.WriteJSON(os.Stdout); err != nil {
+			fmt.Println("JSON encoding error.", err)
+			os.Exit(-1)
+		}
+		return
+	}
+	fmt.Print(upgrades)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/spf13/afero"
+	npmblame "github.com/talend-glorieux/npm-blame"
+)
+
+// whyCommand prints the dependency paths leading to a package
+func whyCommand(args []string) {
+	flags := flag.NewFlagSet("npm-blame why", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: npm-blame why [flags] package")
+		fmt.Fprintln(flags.Output(), "Shows the dependency paths from the project to each installed copy of a package.")
+		flags.PrintDefaults()
+	}
+	var jsonOutput = flags.Bool("json", false, "print the dependency paths as JSON")
+	sf := addScanFlags(flags)
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(-1)
+	}
+
+	result, err := sf.scan()
+	if err != nil {
+		fmt.Println("Scan error.", err)
+		os.Exit(-1)
+	}
+
+	explanations, err := npmblame.Why(afero.NewOsFs(), *sf.root, result, flags.Arg(0))
+	if err != nil {
+		fmt.Println("Dependency error.", err)
+		os.Exit(-1)
+	}
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(explanations); err != nil {
+			fmt.Println("JSON encoding error.", err)
+			os.Exit(-1)
+		}
+		return
+	}
+	fmt.Print(explanations)
+}
@@ -0,0 +1,231 @@
+package npmblame
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/gosuri/uitable"
+)
+
+// PackageDelta is the blame change of a package between two scans
+type PackageDelta struct {
+	Name   string                 `json:"name"`
+	Errors map[PackageError]int   `json:"errors"`
+	Bytes  map[PackageError]int64 `json:"bytes"`
+}
+
+// zero reports whether the package blame did not change
+func (pd PackageDelta) zero() bool {
+	for _, err := range PackageErrors {
+		if pd.Errors[err] != 0 || pd.Bytes[err] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// NewFile is a file blamed by the current scan but not by the baseline
+type NewFile struct {
+	Package string `json:"package"`
+	BlamedFile
+}
+
+// Diff is the blame change between a baseline scan and a current one
+type Diff struct {
+	// Added and Removed list the installed packages names
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	// Changed lists the packages whose blame changed
+	Changed  []PackageDelta `json:"changed"`
+	NewFiles []NewFile      `json:"new_files"`
+}
+
+// NewDiff compares the current scan result against a baseline
+func NewDiff(baseline, current *Result) *Diff {
+	d := &Diff{
+		Added:    []string{},
+		Removed:  []string{},
+		Changed:  []PackageDelta{},
+		NewFiles: []NewFile{},
+	}
+
+	before := make(map[string]bool)
+	for _, name := range baseline.Names() {
+		before[name] = true
+	}
+	after := make(map[string]bool)
+	for _, name := range current.Names() {
+		after[name] = true
+		if !before[name] {
+			d.Added = append(d.Added, name)
+		}
+	}
+	for _, name := range baseline.Names() {
+		if !after[name] {
+			d.Removed = append(d.Removed, name)
+		}
+	}
+
+	for _, name := range mergeNames(baseline.Names(), current.Names()) {
+		delta := PackageDelta{
+			Name:   name,
+			Errors: make(map[PackageError]int),
+			Bytes:  make(map[PackageError]int64),
+		}
+		oldBytes, newBytes := baseline.Bytes(name), current.Bytes(name)
+		for _, err := range PackageErrors {
+			if n := current.Packages[name][err] - baseline.Packages[name][err]; n != 0 {
+				delta.Errors[err] = n
+			}
+			if b := newBytes[err] - oldBytes[err]; b != 0 {
+				delta.Bytes[err] = b
+			}
+		}
+		if !delta.zero() {
+			d.Changed = append(d.Changed, delta)
+		}
+	}
+
+	d.NewFiles = newFiles(baseline, current)
+	return d
+}
+
+// mergeNames returns the sorted union of two sorted name lists
+func mergeNames(a, b []string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, name := range append(append([]string{}, a...), b...) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newFiles returns the files blamed by current but not by baseline.
+// Files are identified by their package name and path in the package
+// so that moving a package around node_modules does not blame it again.
+func newFiles(baseline, current *Result) []NewFile {
+	known := make(map[string]bool)
+	for _, i := range baseline.Instances {
+		for _, f := range i.Files {
+			known[i.Name+"/"+f.Path] = true
+		}
+	}
+
+	files := []NewFile{}
+	for _, i := range current.Instances {
+		for _, f := range i.Files {
+			key := i.Name + "/" + f.Path
+			if known[key] {
+				continue
+			}
+			known[key] = true
+			files = append(files, NewFile{Package: i.Name, BlamedFile: f})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Package != files[j].Package {
+			return files[i].Package < files[j].Package
+		}
+		return files[i].Path < files[j].Path
+	})
+	return files
+}
+
+// Total returns the blame change summed over all packages
+func (d *Diff) Total() PackageDelta {
+	total := PackageDelta{
+		Name:   "TOTAL",
+		Errors: make(map[PackageError]int),
+		Bytes:  make(map[PackageError]int64),
+	}
+	for _, delta := range d.Changed {
+		for err, n := range delta.Errors {
+			total.Errors[err] += n
+		}
+		for err, b := range delta.Bytes {
+			total.Bytes[err] += b
+		}
+	}
+	return total
+}
+
+// Worse reports whether the current scan blames more than the baseline
+func (d *Diff) Worse() bool {
+	total := d.Total()
+	for _, err := range PackageErrors {
+		if total.Errors[err] > 0 || total.Bytes[err] > 0 {
+			return true
+		}
+	}
+	return len(d.NewFiles) > 0
+}
+
+// WriteJSON writes the machine-readable representation of the Diff
+func (d *Diff) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
+
+// String returns the printable representation of the Diff
+func (d *Diff) String() string {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "%d packages added, %d packages removed\n", len(d.Added), len(d.Removed))
+	if len(d.Added) > 0 {
+		fmt.Fprintf(buf, "Added: %s\n", strings.Join(d.Added, ", "))
+	}
+	if len(d.Removed) > 0 {
+		fmt.Fprintf(buf, "Removed: %s\n", strings.Join(d.Removed, ", "))
+	}
+
+	if len(d.Changed) > 0 {
+		table := uitable.New()
+		table.MaxColWidth = 50
+		table.AddRow(append([]interface{}{"PACKAGE"}, packageErrorColumns()...)...)
+		for _, delta := range append(d.Changed, d.Total()) {
+			row := []interface{}{delta.Name}
+			for _, err := range PackageErrors {
+				row = append(row, formatDelta(delta.Errors[err], delta.Bytes[err]))
+			}
+			table.AddRow(row...)
+		}
+		fmt.Fprintf(buf, "\n%d packages changed\n\n", len(d.Changed))
+		fmt.Fprintln(buf, table)
+	}
+
+	if len(d.NewFiles) > 0 {
+		table := uitable.New()
+		table.MaxColWidth = 80
+		table.AddRow("PACKAGE", "FILE", "SIZE", "ERRORS")
+		for _, f := range d.NewFiles {
+			errs := make([]string, len(f.Errors))
+			for i, err := range f.Errors {
+				errs[i] = err.String()
+			}
+			table.AddRow(f.Package, f.Path, formatBytes(f.Size), strings.Join(errs, ","))
+		}
+		fmt.Fprintf(buf, "\n%d newly blamed files\n\n", len(d.NewFiles))
+		fmt.Fprintln(buf, table)
+	}
+	return buf.String()
+}
+
+// formatDelta returns the printable change of a package error
+func formatDelta(count int, size int64) string {
+	if count == 0 && size == 0 {
+		return "0"
+	}
+	sign := ""
+	if size > 0 {
+		sign = "+"
+	}
+	return fmt.Sprintf("%+d (%s%s)", count, sign, formatBytes(size))
+}
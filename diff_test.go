@@ -0,0 +1,109 @@
+package npmblame
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func diffResults() (baseline, current *Result) {
+	baseline = NewResult()
+	baseline.Packages = NpmPackages{
+		"kept":    {ImageError: 1},
+		"removed": {TestError: 2},
+	}
+	baseline.Instances = []*Instance{
+		{Name: "kept", Path: "/kept", Files: []BlamedFile{
+			{Path: "logo.png", Size: 100, Errors: []PackageError{ImageError}},
+		}},
+		{Name: "removed", Path: "/removed"},
+	}
+
+	current = NewResult()
+	current.Packages = NpmPackages{
+		"kept":  {ImageError: 2},
+		"added": {},
+	}
+	current.Instances = []*Instance{
+		{Name: "added", Path: "/added"},
+		{Name: "kept", Path: "/kept", Files: []BlamedFile{
+			{Path: "logo.png", Size: 100, Errors: []PackageError{ImageError}},
+			{Path: "icon.png", Size: 50, Errors: []PackageError{ImageError}},
+		}},
+	}
+	return
+}
+
+func TestNewDiff(t *testing.T) {
+	d := NewDiff(diffResults())
+
+	if !reflect.DeepEqual(d.Added, []string{"added"}) {
+		t.Errorf("Added = %v", d.Added)
+	}
+	if !reflect.DeepEqual(d.Removed, []string{"removed"}) {
+		t.Errorf("Removed = %v", d.Removed)
+	}
+
+	want := []PackageDelta{
+		{Name: "kept", Errors: map[PackageError]int{ImageError: 1}, Bytes: map[PackageError]int64{ImageError: 50}},
+		{Name: "removed", Errors: map[PackageError]int{TestError: -2}, Bytes: map[PackageError]int64{}},
+	}
+	if !reflect.DeepEqual(d.Changed, want) {
+		t.Errorf("Changed = %+v, want %+v", d.Changed, want)
+	}
+
+	files := []NewFile{{Package: "kept", BlamedFile: BlamedFile{Path: "icon.png", Size: 50, Errors: []PackageError{ImageError}}}}
+	if !reflect.DeepEqual(d.NewFiles, files) {
+		t.Errorf("NewFiles = %+v, want %+v", d.NewFiles, files)
+	}
+
+	if total := d.Total(); total.Errors[ImageError] != 1 || total.Errors[TestError] != -2 {
+		t.Errorf("Wrong total: %+v", total)
+	}
+	if !d.Worse() {
+		t.Error("Diff should be worse")
+	}
+}
+
+func TestDiffSame(t *testing.T) {
+	baseline, _ := diffResults()
+	d := NewDiff(baseline, baseline)
+	if len(d.Added)+len(d.Removed)+len(d.Changed)+len(d.NewFiles) > 0 {
+		t.Errorf("Expected an empty diff got %+v", d)
+	}
+	if d.Worse() {
+		t.Error("Diff should not be worse")
+	}
+}
+
+func TestDiffString(t *testing.T) {
+	s := NewDiff(diffResults()).String()
+	for _, want := range []string{
+		"1 packages added, 1 packages removed",
+		"Added: added",
+		"+1 (+50 B)",
+		"1 newly blamed files",
+		"icon.png",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Missing %q in %s", want, s)
+		}
+	}
+}
+
+func TestDiffJSON(t *testing.T) {
+	d := NewDiff(diffResults())
+	buf := &bytes.Buffer{}
+	if err := d.WriteJSON(buf); err != nil {
+		t.Fatal(err)
+	}
+	decoded := new(Diff)
+	if err := json.Unmarshal(buf.Bytes(), decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, d) {
+		t.Errorf("Decoded %+v, want %+v", decoded, d)
+	}
+}
@@ -0,0 +1,130 @@
+package npmblame
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ExportFormats are the formats the detection rules can be exported to
+var ExportFormats = []string{"yarnclean", "find", "dockerfile"}
+
+// Export writes the detection rules of the given package errors as a
+// .yarnclean file, a find shell script or a Dockerfile RUN instruction.
+// Every pattern is commented with its package error. Unlike the prune
+// command, exports cannot spare the package entry points.
+func Export(w io.Writer, format string, categories []PackageError) error {
+	var rules []Rule
+	for _, r := range Rules {
+		if matchCategories([]PackageError{r.Error}, categories) {
+			rules = append(rules, r)
+		}
+	}
+
+	buf := &strings.Builder{}
+	switch format {
+	case "yarnclean":
+		exportYarnclean(buf, rules)
+	case "find":
+		exportFindScript(buf, rules)
+	case "dockerfile":
+		exportDockerfile(buf, rules)
+	default:
+		return fmt.Errorf("unknown export format %q, expected one of %s",
+			format, strings.Join(ExportFormats, ", "))
+	}
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+// ruleComment ties a rule to its package error
+func ruleComment(r Rule) string {
+	return fmt.Sprintf("# %s: %s", r.Error, r)
+}
+
+func exportYarnclean(w io.Writer, rules []Rule) {
+	fmt.Fprintln(w, "# Generated by npm-blame from its detection rules")
+	for _, r := range rules {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, ruleComment(r))
+		switch r.Kind {
+		case ContainsRule:
+			fmt.Fprintf(w, "*%s*\n", r.Pattern)
+		case ExtensionRule:
+			fmt.Fprintf(w, "*%s\n", r.Pattern)
+		case NameRule, FolderRule:
+			fmt.Fprintln(w, r.Pattern)
+		default:
+			fmt.Fprintln(w, "# not expressible as a .yarnclean pattern")
+		}
+	}
+}
+
+// findCommand returns the find command removing the files of a rule
+// from the current package folder, its nested node_modules left out.
+// Matching folders are pruned and removed at once, as -delete would
+// turn the pruning off.
+func findCommand(r Rule) string {
+	const skip = "find . -path ./node_modules -prune -o "
+	switch r.Kind {
+	case ContainsRule:
+		return skip + fmt.Sprintf("-path '*%s*' -prune -exec rm -rf {} +", r.Pattern)
+	case ExtensionRule:
+		return skip + fmt.Sprintf("-type f -name '*%s' -exec rm -f {} +", r.Pattern)
+	case NameRule:
+		return skip + fmt.Sprintf("-type f -name '%s' -exec rm -f {} +", r.Pattern)
+	case FolderRule:
+		return skip + fmt.Sprintf("-name '%s' -prune -exec rm -rf {} +", r.Pattern)
+	case ExecutableRule:
+		return skip + `-type f \( -perm -u+x -o -perm -g+x -o -perm -o+x \) -exec rm -f {} +`
+	}
+	return ""
+}
+
+// writeCleanFunction writes the clean shell function removing the
+// blamed files of the packages of a node_modules folder, nested ones
+// included. The rules are run from each package folder so that they
+// never match the package names.
+func writeCleanFunction(w io.Writer, rules []Rule) {
+	fmt.Fprintln(w, "clean() {")
+	fmt.Fprintln(w, `	for pkg in "$1"/* "$1"/@*/*; do`)
+	fmt.Fprintln(w, `		case "${pkg##*/}" in`)
+	fmt.Fprintln(w, "		@*|.*) continue ;;")
+	fmt.Fprintln(w, "		esac")
+	fmt.Fprintln(w, `		[ -d "$pkg" ] || continue`)
+	fmt.Fprintln(w, "		(")
+	fmt.Fprintln(w, `		cd "$pkg"`)
+	for _, r := range rules {
+		fmt.Fprintln(w, "		"+ruleComment(r))
+		fmt.Fprintln(w, "		"+findCommand(r))
+	}
+	fmt.Fprintln(w, "		)")
+	fmt.Fprintln(w, `		if [ -d "$pkg/node_modules" ]; then`)
+	fmt.Fprintln(w, `			clean "$pkg/node_modules"`)
+	fmt.Fprintln(w, "		fi")
+	fmt.Fprintln(w, "	done")
+	fmt.Fprintln(w, "}")
+}
+
+func exportFindScript(w io.Writer, rules []Rule) {
+	fmt.Fprintln(w, "#!/bin/sh")
+	fmt.Fprintln(w, "# Generated by npm-blame from its detection rules.")
+	fmt.Fprintln(w, "# Removes the blamed files of the node_modules folder given as")
+	fmt.Fprintln(w, "# argument, by default the one of the current folder.")
+	fmt.Fprintln(w, "set -e")
+	fmt.Fprintln(w)
+	writeCleanFunction(w, rules)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `clean "${1:-node_modules}"`)
+}
+
+func exportDockerfile(w io.Writer, rules []Rule) {
+	fmt.Fprintln(w, "# Generated by npm-blame from its detection rules.")
+	fmt.Fprintln(w, "# Run it in the layer installing the dependencies, so that the")
+	fmt.Fprintln(w, "# removed files never reach the image. Heredocs need BuildKit.")
+	fmt.Fprintln(w, "RUN <<'NPM_BLAME'")
+	fmt.Fprintln(w, "set -e")
+	writeCleanFunction(w, rules)
+	fmt.Fprintln(w, "clean node_modules")
+	fmt.Fprintln(w, "NPM_BLAME")
+}
@@ -0,0 +1,48 @@
+package npmblame
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	categories := []PackageError{ExecError, ImageError, SecretError, VCSError}
+	for format, lines := range map[string][]string{
+		"yarnclean": {
+			"# image: files with the .png extension\n*.png\n",
+			"# secret: files named .npmrc\n.npmrc\n",
+			"# vcs: .git folders\n.git\n",
+			"# exec: executable files\n# not expressible as a .yarnclean pattern\n",
+		},
+		"find": {
+			"#!/bin/sh\n",
+			"		# image: files with the .jpg extension\n		find . -path ./node_modules -prune -o -type f -name '*.jpg' -exec rm -f {} +\n",
+			"		# secret: files named .env\n		find . -path ./node_modules -prune -o -type f -name '.env' -exec rm -f {} +\n",
+			"		# vcs: .svn folders\n		find . -path ./node_modules -prune -o -name '.svn' -prune -exec rm -rf {} +\n",
+			"\nclean \"${1:-node_modules}\"\n",
+		},
+		"dockerfile": {
+			"RUN <<'NPM_BLAME'\nset -e\nclean() {\n",
+			"		# secret: files with the .pem extension\n		find . -path ./node_modules -prune -o -type f -name '*.pem' -exec rm -f {} +\n",
+			"clean node_modules\nNPM_BLAME\n",
+		},
+	} {
+		buf := &bytes.Buffer{}
+		if err := Export(buf, format, categories); err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range lines {
+			if !strings.Contains(buf.String(), line) {
+				t.Errorf("Missing %q in the %s export:\n%s", line, format, buf)
+			}
+		}
+		if strings.Contains(buf.String(), "test") {
+			t.Errorf("The %s export should only contain the selected categories:\n%s", format, buf)
+		}
+	}
+
+	if err := Export(&bytes.Buffer{}, "makefile", categories); err == nil {
+		t.Error("Expected an unknown format error")
+	}
+}
@@ -0,0 +1,466 @@
+package npmblame
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/spf13/afero"
+)
+
+const defaultFixTitle = `Exclude development files from the published package`
+
+// forkPolls and forkPollInterval bound the wait for a fork to be ready,
+// and branchAttempts the branch names tried when one already exists
+var (
+	forkPolls        = 10
+	forkPollInterval = 2 * time.Second
+	branchAttempts   = 10
+)
+
+// FixBranch returns the branch name of the fix of a package version
+func FixBranch(i *Instance) string {
+	name := strings.NewReplacer("@", "", "/", "-").Replace(i.Name)
+	if i.Version == "" {
+		return "npm-blame-fix/" + name
+	}
+	return "npm-blame-fix/" + name + "-" + i.Version
+}
+
+// Fix is a change of a package repository keeping the blamed files out
+// of its published tarball
+type Fix struct {
+	// Path is the changed file, package.json or .npmignore
+	Path    string
+	Content []byte
+	// Patterns are the excluded files and folders
+	Patterns []string
+	// Description is the markdown summary of the fix
+	Description string
+}
+
+// Fixer computes a fix from the upstream package.json and .npmignore,
+// the latter being nil when the repository has none
+type Fixer func(manifest []byte, npmignore []byte) (*Fix, error)
+
+// NewFix returns the fix of an installed package, dir being its folder.
+// A files field gets the blamed files as negated entries, npm ignoring
+// the root .npmignore of these packages. Otherwise packages with a
+// .npmignore get the blamed files appended to it, and the others a files
+// field listing the installed top level entries that are not only blamed
+// files, followed by the negated blamed files of these entries.
+func NewFix(fs afero.Fs, dir string, i *Instance, manifest []byte, npmignore []byte) (*Fix, error) {
+	installed, err := installedFiles(fs, dir)
+	if err != nil {
+		return nil, err
+	}
+	blamed := make(map[string]bool)
+	for _, f := range i.Files {
+		blamed[f.Path] = true
+	}
+	patterns := blamedPatterns(installed, blamed)
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("%s has no blamed files to exclude", i.Name)
+	}
+
+	fix := &Fix{Patterns: patterns}
+	start, end, hasFiles, err := jsonField(manifest, "files")
+	if err != nil {
+		return nil, fmt.Errorf("invalid package.json: %v", err)
+	}
+	switch {
+	case hasFiles:
+		var files []string
+		if err := json.Unmarshal(manifest[start:end], &files); err != nil {
+			return nil, fmt.Errorf("invalid files field: %v", err)
+		}
+		for _, p := range patterns {
+			files = appendMissing(files, "!"+strings.TrimSuffix(p, "/"))
+		}
+		fix.Path = "package.json"
+		fix.Content = replaceJSONField(manifest, start, end, files)
+	case npmignore != nil:
+		fix.Path = ".npmignore"
+		fix.Content = appendNpmignore(npmignore, patterns)
+	default:
+		files := publishedEntries(installed, blamed)
+		for _, p := range patterns {
+			// The blamed files of published folders are negated
+			if hasString(files, strings.SplitN(p, "/", 2)[0]) {
+				files = append(files, "!"+strings.TrimSuffix(p, "/"))
+			}
+		}
+		fix.Path = "package.json"
+		fix.Content = addJSONField(manifest, "files", files)
+	}
+	fix.Description = fixDescription(i, fix)
+	return fix, nil
+}
+
+// installedFiles lists the files of an installed package, without its
+// nested packages
+func installedFiles(fs afero.Fs, dir string) ([]string, error) {
+	var files []string
+	err := afero.Walk(fs, dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == "node_modules" {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() {
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return files, err
+}
+
+// blamedPatterns returns the blamed files, using their highest folder
+// when it only holds blamed files. Folders end with a slash.
+func blamedPatterns(installed []string, blamed map[string]bool) []string {
+	clean := make(map[string]bool)
+	for _, f := range installed {
+		if blamed[f] {
+			continue
+		}
+		for dir := path.Dir(f); dir != "."; dir = path.Dir(dir) {
+			clean[dir] = true
+		}
+	}
+
+	seen := make(map[string]bool)
+	var patterns []string
+	for _, f := range installed {
+		if !blamed[f] {
+			continue
+		}
+		pattern := f
+		parts := strings.Split(f, "/")
+		for n := 1; n < len(parts); n++ {
+			if dir := strings.Join(parts[:n], "/"); !clean[dir] {
+				pattern = dir + "/"
+				break
+			}
+		}
+		if !seen[pattern] {
+			seen[pattern] = true
+			patterns = append(patterns, pattern)
+		}
+	}
+	sort.Strings(patterns)
+	return patterns
+}
+
+// publishedEntries returns the top level entries holding files that are
+// not blamed. npm always publishes package.json and the readme, license
+// and changelog files.
+func publishedEntries(installed []string, blamed map[string]bool) []string {
+	var entries []string
+	for _, f := range installed {
+		if blamed[f] {
+			continue
+		}
+		entry := strings.SplitN(f, "/", 2)[0]
+		name := strings.ToLower(entry)
+		if name == "package.json" || strings.HasPrefix(name, "readme") ||
+			strings.HasPrefix(name, "license") || strings.HasPrefix(name, "licence") ||
+			strings.HasPrefix(name, "changelog") {
+			continue
+		}
+		entries = appendMissing(entries, entry)
+	}
+	sort.Strings(entries)
+	return entries
+}
+
+func appendMissing(list []string, s string) []string {
+	if hasString(list, s) {
+		return list
+	}
+	return append(list, s)
+}
+
+func hasString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// appendNpmignore adds the patterns missing from a .npmignore
+func appendNpmignore(npmignore []byte, patterns []string) []byte {
+	existing := make(map[string]bool)
+	for _, line := range strings.Split(string(npmignore), "\n") {
+		existing[strings.TrimSpace(line)] = true
+	}
+	buf := bytes.NewBuffer(append([]byte{}, npmignore...))
+	if buf.Len() > 0 && !bytes.HasSuffix(npmignore, []byte("\n")) {
+		buf.WriteString("\n")
+	}
+	header := false
+	for _, p := range patterns {
+		p = "/" + p
+		if existing[p] {
+			continue
+		}
+		if !header {
+			buf.WriteString("\n# Development files, found by npm-blame\n")
+			header = true
+		}
+		buf.WriteString(p + "\n")
+	}
+	return buf.Bytes()
+}
+
+// jsonField returns the offsets of the value of a top level field
+func jsonField(data []byte, key string) (int, int, bool, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return 0, 0, false, fmt.Errorf("expected an object")
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return 0, 0, false, err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return 0, 0, false, err
+		}
+		if t == key {
+			end := int(dec.InputOffset())
+			return end - len(value), end, true, nil
+		}
+	}
+	return 0, 0, false, nil
+}
+
+// jsonIndent returns the indentation of the fields of a JSON document
+func jsonIndent(data []byte) string {
+	for _, line := range strings.Split(string(data), "\n")[1:] {
+		if trimmed := strings.TrimLeft(line, " \t"); trimmed != "" {
+			return line[:len(line)-len(trimmed)]
+		}
+	}
+	return "  "
+}
+
+// formatJSONList formats a list of strings at the given indentation
+func formatJSONList(list []string, indent string) string {
+	if len(list) == 0 {
+		return "[]"
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteString("[")
+	for n, s := range list {
+		if n > 0 {
+			buf.WriteString(",")
+		}
+		quoted, _ := json.Marshal(s)
+		fmt.Fprintf(buf, "\n%s%s%s", indent, indent, quoted)
+	}
+	fmt.Fprintf(buf, "\n%s]", indent)
+	return buf.String()
+}
+
+// replaceJSONField replaces the value between start and end, keeping
+// the rest of the document untouched
+func replaceJSONField(data []byte, start, end int, list []string) []byte {
+	var buf bytes.Buffer
+	buf.Write(data[:start])
+	buf.WriteString(formatJSONList(list, jsonIndent(data)))
+	buf.Write(data[end:])
+	return buf.Bytes()
+}
+
+// addJSONField appends a field to a JSON object, keeping the order and
+// formatting of the other fields
+func addJSONField(data []byte, key string, list []string) []byte {
+	indent := jsonIndent(data)
+	closing := bytes.LastIndexByte(data, '}')
+	body := bytes.TrimRight(data[:closing], " \t\r\n")
+	var buf bytes.Buffer
+	buf.Write(body)
+	if !bytes.HasSuffix(body, []byte("{")) {
+		buf.WriteString(",")
+	}
+	quoted, _ := json.Marshal(key)
+	fmt.Fprintf(&buf, "\n%s%s: %s\n", indent, quoted, formatJSONList(list, indent))
+	buf.Write(data[closing:])
+	return buf.Bytes()
+}
+
+// fixDescription summarizes a fix for its pull request
+func fixDescription(i *Instance, fix *Fix) string {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "The published %s@%s package contains %s of files its users do not need", i.Name, i.Version, formatBytes(i.BlamedBytes()))
+	var errs []string
+	for _, err := range PackageErrors {
+		if count := i.Errors[err]; count > 0 {
+			errs = append(errs, fmt.Sprintf("%d %s", count, err))
+		}
+	}
+	if len(errs) > 0 {
+		fmt.Fprintf(buf, " (%s)", strings.Join(errs, ", "))
+	}
+	fmt.Fprintf(buf, ".\n\nThis change updates `%s` to leave them out of the tarball:\n\n", fix.Path)
+	for _, p := range fix.Patterns {
+		fmt.Fprintf(buf, "- `%s`\n", p)
+	}
+	fmt.Fprint(buf, "\nFound by [npm-blame](https://github.com/talend-glorieux/npm-blame).\n")
+	return buf.String()
+}
+
+// OpenPullRequest forks the repository of the report, commits the fix
+// computed from its default branch, in the report directory, on a new
+// branch and opens a pull request with the report title and body
+// followed by the fix summary. The branch starts from the upstream
+// default branch, whatever the state of the fork, and gets a numbered
+// suffix when it already exists.
+func (r *Report) OpenPullRequest(client *github.Client, branch string, fixer Fixer) (*github.PullRequest, error) {
+	if client == nil {
+		return nil, fmt.Errorf("No client passed.")
+	}
+
+	repo, _, err := client.Repositories.Get(r.Owner, r.Repository)
+	if err != nil {
+		return nil, err
+	}
+	base := "master"
+	if repo.DefaultBranch != nil {
+		base = *repo.DefaultBranch
+	}
+	baseRef, _, err := client.Git.GetRef(r.Owner, r.Repository, "heads/"+base)
+	if err != nil {
+		return nil, err
+	}
+	if baseRef.Object == nil || baseRef.Object.SHA == nil {
+		return nil, fmt.Errorf("no commit for %s in %s/%s", base, r.Owner, r.Repository)
+	}
+	// The files are read at the commit the branch starts from
+	baseSHA := *baseRef.Object.SHA
+
+	manifest, manifestSHA, err := getContent(client, r.Owner, r.Repository, path.Join(r.Directory, "package.json"), baseSHA)
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("%s/%s has no %s", r.Owner, r.Repository, path.Join(r.Directory, "package.json"))
+	}
+	npmignore, npmignoreSHA, err := getContent(client, r.Owner, r.Repository, path.Join(r.Directory, ".npmignore"), baseSHA)
+	if err != nil {
+		return nil, err
+	}
+	fix, err := fixer(manifest, npmignore)
+	if err != nil {
+		return nil, err
+	}
+	sha := manifestSHA
+	if fix.Path == ".npmignore" {
+		sha = npmignoreSHA
+	}
+
+	fork, _, err := client.Repositories.CreateFork(r.Owner, r.Repository, nil)
+	if err != nil {
+		return nil, err
+	}
+	if fork.Owner == nil || fork.Owner.Login == nil || fork.Name == nil {
+		return nil, fmt.Errorf("incomplete fork of %s/%s", r.Owner, r.Repository)
+	}
+	forkOwner, forkName := *fork.Owner.Login, *fork.Name
+
+	// Forks are created asynchronously
+	for n := 0; ; n++ {
+		_, _, err = client.Git.GetRef(forkOwner, forkName, "heads/"+base)
+		if err == nil || n == forkPolls {
+			break
+		}
+		time.Sleep(forkPollInterval)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Forks share the objects of their upstream repository
+	name := branch
+	for n := 1; ; n++ {
+		_, _, err = client.Git.CreateRef(forkOwner, forkName, &github.Reference{
+			Ref:    github.String("refs/heads/" + branch),
+			Object: &github.GitObject{SHA: github.String(baseSHA)},
+		})
+		errResp, ok := err.(*github.ErrorResponse)
+		if err == nil || !ok || errResp.Response.StatusCode != http.StatusUnprocessableEntity || n == branchAttempts {
+			break
+		}
+		branch = fmt.Sprintf("%s-%d", name, n+1)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &github.RepositoryContentFileOptions{
+		Message: github.String(fmt.Sprintf("Exclude development files with %s", fix.Path)),
+		Content: fix.Content,
+		SHA:     sha,
+		Branch:  github.String(branch),
+	}
+	if sha == nil {
+		_, _, err = client.Repositories.CreateFile(forkOwner, forkName, path.Join(r.Directory, fix.Path), opts)
+	} else {
+		_, _, err = client.Repositories.UpdateFile(forkOwner, forkName, path.Join(r.Directory, fix.Path), opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	title := r.Title
+	if title == "" || title == defaultTitle {
+		title = defaultFixTitle
+	}
+	body := fix.Description
+	if r.Body != "" {
+		body = r.Body + "\n\n" + body
+	}
+	pr, _, err := client.PullRequests.Create(r.Owner, r.Repository, &github.NewPullRequest{
+		Title: github.String(title),
+		Head:  github.String(forkOwner + ":" + branch),
+		Base:  github.String(base),
+		Body:  github.String(body),
+	})
+	return pr, err
+}
+
+// getContent returns the content and blob SHA of a repository file,
+// or nil when it does not exist
+func getContent(client *github.Client, owner, repo, p, ref string) ([]byte, *string, error) {
+	file, _, _, err := client.Repositories.GetContents(owner, repo, p, &github.RepositoryContentGetOptions{Ref: ref})
+	if errResp, ok := err.(*github.ErrorResponse); ok && errResp.Response.StatusCode == http.StatusNotFound {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if file == nil {
+		return nil, nil, fmt.Errorf("%s is not a file in %s/%s", p, owner, repo)
+	}
+	content, err := file.GetContent()
+	if err != nil {
+		return nil, nil, err
+	}
+	return []byte(content), file.SHA, nil
+}
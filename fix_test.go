@@ -0,0 +1,244 @@
+package npmblame
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/spf13/afero"
+)
+
+func fixPackage(t *testing.T) (afero.Fs, *Instance) {
+	fs := afero.NewMemMapFs()
+	for _, p := range []string{
+		"/pkg/package.json", "/pkg/README.md", "/pkg/index.js", "/pkg/lib/a.js",
+		"/pkg/lib/a.test.js", "/pkg/test/a.js", "/pkg/test/fixtures/b.js", "/pkg/logo.png",
+		"/pkg/node_modules/dep/index.js",
+	} {
+		afero.WriteFile(fs, p, []byte("x"), 0644)
+	}
+	i := &Instance{Name: "pkg", Version: "1.0.0", Path: "/pkg",
+		Errors: map[PackageError]int{TestError: 3, ImageError: 1},
+		Files: []BlamedFile{
+			{Path: "lib/a.test.js", Size: 1, Errors: []PackageError{TestError}},
+			{Path: "logo.png", Size: 1, Errors: []PackageError{ImageError}},
+			{Path: "test/a.js", Size: 1, Errors: []PackageError{TestError}},
+			{Path: "test/fixtures/b.js", Size: 1, Errors: []PackageError{TestError}},
+		}}
+	return fs, i
+}
+
+func TestNewFix(t *testing.T) {
+	fs, i := fixPackage(t)
+
+	t.Run("Files field added", func(t *testing.T) {
+		manifest := "{\n    \"name\": \"pkg\",\n    \"version\": \"1.0.0\"\n}\n"
+		fix, err := NewFix(fs, "/pkg", i, []byte(manifest), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "{\n    \"name\": \"pkg\",\n    \"version\": \"1.0.0\",\n    \"files\": [\n        \"index.js\",\n        \"lib\",\n        \"!lib/a.test.js\"\n    ]\n}\n"
+		if fix.Path != "package.json" || string(fix.Content) != want {
+			t.Errorf("Wrong fix %s:\n%s", fix.Path, fix.Content)
+		}
+		if strings.Join(fix.Patterns, " ") != "lib/a.test.js logo.png test/" {
+			t.Errorf("Wrong patterns %v", fix.Patterns)
+		}
+		if !strings.Contains(fix.Description, "pkg@1.0.0 package contains 4 B of files its users do not need (3 test, 1 image)") ||
+			!strings.Contains(fix.Description, "- `test/`\n") {
+			t.Errorf("Wrong description:\n%s", fix.Description)
+		}
+	})
+
+	t.Run("Files field negated", func(t *testing.T) {
+		manifest := `{
+  "name": "pkg",
+  "files": ["index.js", "lib", "test"],
+  "version": "1.0.0"
+}`
+		fix, err := NewFix(fs, "/pkg", i, []byte(manifest), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `{
+  "name": "pkg",
+  "files": [
+    "index.js",
+    "lib",
+    "test",
+    "!lib/a.test.js",
+    "!logo.png",
+    "!test"
+  ],
+  "version": "1.0.0"
+}`
+		if string(fix.Content) != want {
+			t.Errorf("Wrong package.json:\n%s", fix.Content)
+		}
+	})
+
+	t.Run("Npmignore", func(t *testing.T) {
+		fix, err := NewFix(fs, "/pkg", i, []byte(`{"name": "pkg"}`), []byte("/logo.png"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "/logo.png\n\n# Development files, found by npm-blame\n/lib/a.test.js\n/test/\n"
+		if fix.Path != ".npmignore" || string(fix.Content) != want {
+			t.Errorf("Wrong .npmignore:\n%s", fix.Content)
+		}
+	})
+
+	t.Run("Files field and npmignore", func(t *testing.T) {
+		// npm ignores the root .npmignore of packages with a files field
+		manifest := `{
+  "name": "pkg",
+  "files": ["index.js", "lib"]
+}`
+		fix, err := NewFix(fs, "/pkg", i, []byte(manifest), []byte("/logo.png"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `{
+  "name": "pkg",
+  "files": [
+    "index.js",
+    "lib",
+    "!lib/a.test.js",
+    "!logo.png",
+    "!test"
+  ]
+}`
+		if fix.Path != "package.json" || string(fix.Content) != want {
+			t.Errorf("Wrong fix of %s:\n%s", fix.Path, fix.Content)
+		}
+	})
+
+	t.Run("Nothing to fix", func(t *testing.T) {
+		if _, err := NewFix(fs, "/pkg", &Instance{Name: "pkg"}, []byte(`{}`), nil); err == nil {
+			t.Error("Expected an error without blamed files")
+		}
+	})
+}
+
+func TestOpenPullRequest(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	u, _ := url.Parse(server.URL + "/")
+	client := github.NewClient(nil)
+	client.BaseURL = u
+	forkPollInterval = 0
+
+	manifest := []byte("{\n  \"name\": \"pkg\"\n}\n")
+	var steps []string
+	mux.HandleFunc("/repos/owner/pkg", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name": "pkg", "default_branch": "main"}`)
+	})
+	mux.HandleFunc("/repos/owner/pkg/git/refs/heads/main", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ref": "refs/heads/main", "object": {"sha": "upstream"}}`)
+	})
+	mux.HandleFunc("/repos/owner/pkg/contents/package.json", func(w http.ResponseWriter, r *http.Request) {
+		if ref := r.URL.Query().Get("ref"); ref != "upstream" {
+			t.Errorf("Expected the upstream default branch commit got %s", ref)
+		}
+		fmt.Fprintf(w, `{"type": "file", "encoding": "base64", "content": %q, "sha": "blob"}`,
+			base64.StdEncoding.EncodeToString(manifest))
+	})
+	mux.HandleFunc("/repos/owner/pkg/contents/.npmignore", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+	})
+	mux.HandleFunc("/repos/owner/pkg/forks", func(w http.ResponseWriter, r *http.Request) {
+		steps = append(steps, "fork")
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, `{"name": "pkg-fork", "owner": {"login": "me"}}`)
+	})
+	refs := 0
+	mux.HandleFunc("/repos/me/pkg-fork/git/refs/heads/main", func(w http.ResponseWriter, r *http.Request) {
+		// The fork is not ready on the first poll
+		if refs++; refs == 1 {
+			http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+			return
+		}
+		// The fork is behind its upstream repository
+		fmt.Fprint(w, `{"ref": "refs/heads/main", "object": {"sha": "stale"}}`)
+	})
+	mux.HandleFunc("/repos/me/pkg-fork/git/refs", func(w http.ResponseWriter, r *http.Request) {
+		var ref struct{ Ref, SHA string }
+		json.NewDecoder(r.Body).Decode(&ref)
+		if ref.SHA != "upstream" {
+			t.Errorf("Wrong branch commit %+v", ref)
+		}
+		// A previous fix of the same version left its branch
+		if ref.Ref == "refs/heads/npm-blame-fix/pkg-1.0.0" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprint(w, `{"message": "Reference already exists"}`)
+			return
+		}
+		if ref.Ref != "refs/heads/npm-blame-fix/pkg-1.0.0-2" {
+			t.Errorf("Wrong branch %+v", ref)
+		}
+		steps = append(steps, "branch")
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("/repos/me/pkg-fork/contents/package.json", func(w http.ResponseWriter, r *http.Request) {
+		opts := new(github.RepositoryContentFileOptions)
+		json.NewDecoder(r.Body).Decode(opts)
+		if r.Method != "PUT" || *opts.SHA != "blob" || *opts.Branch != "npm-blame-fix/pkg-1.0.0-2" ||
+			!strings.Contains(string(opts.Content), `"files"`) {
+			t.Errorf("Wrong commit %s %+v", r.Method, opts)
+		}
+		steps = append(steps, "commit")
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("/repos/owner/pkg/pulls", func(w http.ResponseWriter, r *http.Request) {
+		pr := new(github.NewPullRequest)
+		json.NewDecoder(r.Body).Decode(pr)
+		if *pr.Head != "me:npm-blame-fix/pkg-1.0.0-2" || *pr.Base != "main" || *pr.Title != defaultFixTitle ||
+			!strings.HasPrefix(*pr.Body, "Thanks!\n\nThe published pkg@1.0.0") {
+			t.Errorf("Wrong pull request %+v", pr)
+		}
+		steps = append(steps, "pull request")
+		fmt.Fprint(w, `{"number": 7}`)
+	})
+
+	fs, i := fixPackage(t)
+	r := NewReport("owner", "pkg", nil)
+	r.Body = "Thanks!"
+	pr, err := r.OpenPullRequest(client, FixBranch(i), func(manifest, npmignore []byte) (*Fix, error) {
+		return NewFix(fs, "/pkg", i, manifest, npmignore)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Number == nil || *pr.Number != 7 {
+		t.Errorf("Wrong pull request %+v", pr)
+	}
+	if s := strings.Join(steps, ", "); s != "fork, branch, commit, pull request" {
+		t.Errorf("Wrong steps: %s", s)
+	}
+
+	if _, err := r.OpenPullRequest(nil, "", nil); err == nil {
+		t.Error("OpenPullRequest should require a client")
+	}
+}
+
+func TestFixBranch(t *testing.T) {
+	for _, tc := range []struct {
+		i        *Instance
+		expected string
+	}{
+		{&Instance{Name: "pkg", Version: "1.0.0"}, "npm-blame-fix/pkg-1.0.0"},
+		{&Instance{Name: "@scope/pkg", Version: "2.0.0-beta.1"}, "npm-blame-fix/scope-pkg-2.0.0-beta.1"},
+		{&Instance{Name: "pkg"}, "npm-blame-fix/pkg"},
+	} {
+		if branch := FixBranch(tc.i); branch != tc.expected {
+			t.Errorf("Expected %s got %s", tc.expected, branch)
+		}
+	}
+}
@@ -0,0 +1,527 @@
+package npmblame
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// Lockfiles are the lockfile names looked up in a project, by priority
+var Lockfiles = []string{"npm-shrinkwrap.json", "package-lock.json", "yarn.lock", "pnpm-lock.yaml"}
+
+// DependencyNode is a package resolved by a lockfile
+type DependencyNode struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Dependencies are the ids of the nodes the package depends on
+	Dependencies []string `json:"dependencies,omitempty"`
+}
+
+// DependencyGraph is the dependency graph of a project
+type DependencyGraph struct {
+	// Roots maps the direct dependencies of the project to their node id
+	Roots map[string]string `json:"roots"`
+	// Nodes are the resolved packages by id
+	Nodes map[string]*DependencyNode `json:"nodes"`
+}
+
+func newDependencyGraph() *DependencyGraph {
+	return &DependencyGraph{
+		Roots: make(map[string]string),
+		Nodes: make(map[string]*DependencyNode),
+	}
+}
+
+// FindLockfile returns the path of the lockfile of the project in dir
+func FindLockfile(fs afero.Fs, dir string) (string, error) {
+	for _, name := range Lockfiles {
+		p := filepath.Join(dir, name)
+		if _, err := fs.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("no lockfile found in %s", dir)
+}
+
+// ReadLockfile builds the dependency graph of a package-lock.json
+// (versions 1 to 3), yarn.lock (classic and berry) or pnpm-lock.yaml.
+// The package.json next to the lockfile, when there is one, gives the
+// direct dependencies lockfiles do not record.
+func ReadLockfile(fs afero.Fs, path string) (*DependencyGraph, error) {
+	data, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := ReadManifest(fs, filepath.Dir(path))
+	if os.IsNotExist(err) {
+		m, err = new(Manifest), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var g *DependencyGraph
+	switch filepath.Base(path) {
+	case "package-lock.json", "npm-shrinkwrap.json":
+		g, err = parseNpmLockfile(data, m)
+	case "yarn.lock":
+		if bytes.Contains(data, []byte("__metadata:")) {
+			g, err = parseYarnBerryLockfile(data, m)
+		} else {
+			g, err = parseYarnLockfile(data, m)
+		}
+	case "pnpm-lock.yaml":
+		g, err = parsePnpmLockfile(data)
+	default:
+		return nil, fmt.Errorf("unknown lockfile %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid lockfile %s: %v", path, err)
+	}
+	if len(g.Roots) == 0 {
+		g.guessRoots()
+	}
+	return g, nil
+}
+
+// guessRoots uses the packages nothing depends on as direct dependencies
+func (g *DependencyGraph) guessRoots() {
+	required := make(map[string]bool)
+	for _, n := range g.Nodes {
+		for _, id := range n.Dependencies {
+			required[id] = true
+		}
+	}
+	for id, n := range g.Nodes {
+		if !required[id] {
+			g.Roots[n.Name] = id
+		}
+	}
+}
+
+// npmLockfile is a package-lock.json. Version 1 nests Dependencies,
+// versions 2 and 3 list Packages by install path.
+type npmLockfile struct {
+	LockfileVersion int                           `json:"lockfileVersion"`
+	Packages        map[string]*npmLockPackage    `json:"packages"`
+	Dependencies    map[string]*npmLockDependency `json:"dependencies"`
+}
+
+type npmLockPackage struct {
+	Name                 string            `json:"name"`
+	Version              string            `json:"version"`
+	Resolved             string            `json:"resolved"`
+	Link                 bool              `json:"link"`
+	Dependencies         map[string]string `json:"dependencies"`
+	OptionalDependencies map[string]string `json:"optionalDependencies"`
+	DevDependencies      map[string]string `json:"devDependencies"`
+}
+
+type npmLockDependency struct {
+	Version      string                        `json:"version"`
+	Requires     map[string]string             `json:"requires"`
+	Dependencies map[string]*npmLockDependency `json:"dependencies"`
+}
+
+func parseNpmLockfile(data []byte, m *Manifest) (*DependencyGraph, error) {
+	lock := new(npmLockfile)
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, err
+	}
+	packages := lock.Packages
+	if packages == nil {
+		packages = make(map[string]*npmLockPackage)
+		flattenNpmDependencies(packages, "", lock.Dependencies)
+		root := &npmLockPackage{Dependencies: m.DirectDependencies()}
+		if len(root.Dependencies) > 0 {
+			packages[""] = root
+		}
+	}
+
+	g := newDependencyGraph()
+	for p, pkg := range packages {
+		if p == "" || pkg.Link {
+			continue
+		}
+		name := pkg.Name
+		if i := strings.LastIndex(p, "node_modules/"); name == "" && i != -1 {
+			name = p[i+len("node_modules/"):]
+		} else if name == "" {
+			// A workspace folder
+			name = filepath.Base(p)
+		}
+		n := &DependencyNode{Name: name, Version: pkg.Version}
+		for _, deps := range []map[string]string{pkg.Dependencies, pkg.OptionalDependencies} {
+			for dep := range deps {
+				if id := resolveNpmPath(packages, p, dep); id != "" {
+					n.Dependencies = append(n.Dependencies, id)
+				}
+			}
+		}
+		sort.Strings(n.Dependencies)
+		g.Nodes[p] = n
+	}
+	if root := packages[""]; root != nil {
+		for _, deps := range []map[string]string{root.Dependencies, root.DevDependencies, root.OptionalDependencies} {
+			for dep := range deps {
+				if id := resolveNpmPath(packages, "", dep); id != "" {
+					g.Roots[dep] = id
+				}
+			}
+		}
+	}
+	return g, nil
+}
+
+// flattenNpmDependencies lists version 1 nested dependencies by install path
+func flattenNpmDependencies(packages map[string]*npmLockPackage, parent string, deps map[string]*npmLockDependency) {
+	for name, dep := range deps {
+		p := "node_modules/" + name
+		if parent != "" {
+			p = parent + "/" + p
+		}
+		packages[p] = &npmLockPackage{Version: dep.Version, Dependencies: dep.Requires}
+		flattenNpmDependencies(packages, p, dep.Dependencies)
+	}
+}
+
+// resolveNpmPath resolves a dependency the way node does, from the
+// node_modules folder of the package up to the root of the project
+func resolveNpmPath(packages map[string]*npmLockPackage, from, name string) string {
+	for dir := from; ; {
+		p := "node_modules/" + name
+		if dir != "" {
+			p = dir + "/" + p
+		}
+		if pkg, ok := packages[p]; ok {
+			if pkg.Link {
+				if _, ok := packages[pkg.Resolved]; ok {
+					return pkg.Resolved
+				}
+				return ""
+			}
+			return p
+		}
+		if dir == "" {
+			return ""
+		}
+		if i := strings.LastIndex(dir, "/node_modules/"); i != -1 {
+			dir = dir[:i]
+		} else {
+			dir = ""
+		}
+	}
+}
+
+// yarnEntry is a package of a yarn.lock
+type yarnEntry struct {
+	name         string
+	version      string
+	resolution   string
+	specifiers   []string
+	dependencies map[string]string
+}
+
+// id returns the graph node id of the entry
+func (e *yarnEntry) id() string {
+	if e.resolution != "" {
+		return e.resolution
+	}
+	return e.name + "@" + e.version
+}
+
+// specifierName returns the package name of a name@range specifier
+func specifierName(specifier string) string {
+	if i := strings.Index(specifier, "@"); i == 0 {
+		i = strings.Index(specifier[1:], "@")
+		if i != -1 {
+			return specifier[:i+1]
+		}
+	} else if i != -1 {
+		return specifier[:i]
+	}
+	return specifier
+}
+
+// parseYarnLockfile parses the classic yarn.lock format
+func parseYarnLockfile(data []byte, m *Manifest) (*DependencyGraph, error) {
+	var entries []*yarnEntry
+	var entry *yarnEntry
+	var section string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), " \r")
+		content := strings.TrimLeft(line, " ")
+		if content == "" || strings.HasPrefix(content, "#") {
+			continue
+		}
+		switch indent := len(line) - len(content); {
+		case indent == 0:
+			if !strings.HasSuffix(content, ":") {
+				return nil, fmt.Errorf("line %d: expected an entry got %s", n, content)
+			}
+			entry = &yarnEntry{dependencies: make(map[string]string)}
+			for _, s := range strings.Split(strings.TrimSuffix(content, ":"), ",") {
+				entry.specifiers = append(entry.specifiers, unquoteYarn(strings.TrimSpace(s)))
+			}
+			entry.name = specifierName(entry.specifiers[0])
+			entries = append(entries, entry)
+		case entry == nil:
+			return nil, fmt.Errorf("line %d: unexpected indentation", n)
+		case indent == 2:
+			key, value := splitYarnField(content)
+			section = ""
+			switch {
+			case key == "version":
+				entry.version = value
+			case strings.HasSuffix(key, ":"):
+				section = strings.TrimSuffix(key, ":")
+			}
+		case section == "dependencies" || section == "optionalDependencies":
+			key, value := splitYarnField(content)
+			entry.dependencies[key] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return yarnGraph(entries, m.DirectDependencies(), func(name, r string) string {
+		return name + "@" + r
+	}), nil
+}
+
+// splitYarnField splits a `key "value"` line of a classic yarn.lock
+func splitYarnField(content string) (string, string) {
+	if content[0] == '"' {
+		if end := closingQuote(content, '"'); end != -1 {
+			return unquoteYarn(content[:end+1]), unquoteYarn(strings.TrimSpace(content[end+1:]))
+		}
+	}
+	if i := strings.Index(content, " "); i != -1 {
+		return content[:i], unquoteYarn(strings.TrimSpace(content[i+1:]))
+	}
+	return content, ""
+}
+
+// closingQuote returns the index of the quote closing s
+func closingQuote(s string, quote byte) int {
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+func unquoteYarn(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// parseYarnBerryLockfile parses the YAML yarn.lock of yarn 2 and later
+func parseYarnBerryLockfile(data []byte, m *Manifest) (*DependencyGraph, error) {
+	doc, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	lock, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a mapping of packages")
+	}
+	var entries []*yarnEntry
+	roots := m.DirectDependencies()
+	for key, value := range lock {
+		fields := yamlMap(value)
+		if key == "__metadata" || fields == nil {
+			continue
+		}
+		entry := &yarnEntry{
+			version:      yamlString(fields["version"]),
+			resolution:   yamlString(fields["resolution"]),
+			dependencies: yamlStrings(fields["dependencies"]),
+		}
+		for k, v := range yamlStrings(fields["optionalDependencies"]) {
+			entry.dependencies[k] = v
+		}
+		for _, s := range strings.Split(key, ",") {
+			entry.specifiers = append(entry.specifiers, strings.TrimSpace(s))
+		}
+		entry.name = specifierName(entry.specifiers[0])
+		if strings.HasSuffix(entry.specifiers[0], "@workspace:.") {
+			// The project itself
+			for k, v := range entry.dependencies {
+				roots[k] = v
+			}
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return yarnGraph(entries, roots, func(name, r string) string {
+		if !strings.Contains(r, ":") {
+			r = "npm:" + r
+		}
+		return name + "@" + r
+	}), nil
+}
+
+// yarnGraph links yarn entries through their specifiers
+func yarnGraph(entries []*yarnEntry, roots map[string]string, specifier func(name, r string) string) *DependencyGraph {
+	g := newDependencyGraph()
+	ids := make(map[string]string)
+	for _, e := range entries {
+		for _, s := range e.specifiers {
+			ids[s] = e.id()
+		}
+	}
+	for _, e := range entries {
+		n := g.Nodes[e.id()]
+		if n == nil {
+			n = &DependencyNode{Name: e.name, Version: e.version}
+			g.Nodes[e.id()] = n
+		}
+		for name, r := range e.dependencies {
+			if id, ok := ids[specifier(name, r)]; ok {
+				n.Dependencies = append(n.Dependencies, id)
+			}
+		}
+		sort.Strings(n.Dependencies)
+	}
+	for name, r := range roots {
+		if id, ok := ids[specifier(name, r)]; ok {
+			g.Roots[name] = id
+		}
+	}
+	return g
+}
+
+// parsePnpmLockfile parses the pnpm-lock.yaml formats 5 to 9
+func parsePnpmLockfile(data []byte) (*DependencyGraph, error) {
+	doc, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	lock := yamlMap(doc)
+	if lock == nil {
+		return nil, fmt.Errorf("expected a mapping")
+	}
+	// Format 9 moved the dependencies of the packages to snapshots
+	packages := yamlMap(lock["snapshots"])
+	if packages == nil {
+		packages = yamlMap(lock["packages"])
+	}
+
+	g := newDependencyGraph()
+	for key, value := range packages {
+		name, version := parsePnpmKey(key)
+		n := &DependencyNode{Name: name, Version: version}
+		fields := yamlMap(value)
+		for _, section := range []string{"dependencies", "optionalDependencies"} {
+			for dep, ref := range yamlStrings(fields[section]) {
+				if id := pnpmNode(packages, dep, ref); id != "" {
+					n.Dependencies = append(n.Dependencies, id)
+				}
+			}
+		}
+		sort.Strings(n.Dependencies)
+		g.Nodes[key] = n
+	}
+
+	importers := []map[string]interface{}{lock}
+	if projects := yamlMap(lock["importers"]); projects != nil {
+		importers = nil
+		for _, project := range projects {
+			importers = append(importers, yamlMap(project))
+		}
+	}
+	for _, project := range importers {
+		for _, section := range []string{"dependencies", "devDependencies", "optionalDependencies"} {
+			for dep, ref := range yamlMap(project[section]) {
+				// Format 6 and later record the specifier with the version
+				if fields := yamlMap(ref); fields != nil {
+					ref = fields["version"]
+				}
+				if id := pnpmNode(packages, dep, yamlString(ref)); id != "" {
+					g.Roots[dep] = id
+				}
+			}
+		}
+	}
+	return g, nil
+}
+
+// pnpmNode returns the key of the package a dependency reference
+// resolves to, whatever the lockfile format
+func pnpmNode(packages map[string]interface{}, name, ref string) string {
+	if strings.HasPrefix(ref, "link:") {
+		return ""
+	}
+	for _, key := range []string{ref, name + "@" + ref, "/" + name + "@" + ref, "/" + name + "/" + ref} {
+		if _, ok := packages[key]; ok {
+			return key
+		}
+	}
+	return ""
+}
+
+// parsePnpmKey returns the name and version of a package key such as
+// /name/1.0.0_peer@1.0.0, /name@1.0.0(peer@1.0.0) or name@1.0.0
+func parsePnpmKey(key string) (string, string) {
+	key = strings.TrimPrefix(key, "/")
+	if i := strings.Index(key, "("); i != -1 {
+		key = key[:i]
+	}
+	// Format 5 separates the version with a slash and its peers with _
+	end := strings.Index(key, "/")
+	if strings.HasPrefix(key, "@") && end != -1 {
+		if i := strings.Index(key[end+1:], "/"); i != -1 {
+			end += i + 1
+		} else {
+			end = -1
+		}
+	}
+	if end != -1 && end+1 < len(key) && key[end+1] >= '0' && key[end+1] <= '9' {
+		version := key[end+1:]
+		if i := strings.Index(version, "_"); i != -1 {
+			version = version[:i]
+		}
+		return key[:end], version
+	}
+	if i := strings.LastIndex(key, "@"); i > 0 {
+		return key[:i], key[i+1:]
+	}
+	return key, ""
+}
+
+func yamlMap(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
+
+func yamlString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+// yamlStrings returns the string values of a mapping
+func yamlStrings(v interface{}) map[string]string {
+	strings := make(map[string]string)
+	for k, v := range yamlMap(v) {
+		if s, ok := v.(string); ok {
+			strings[k] = s
+		}
+	}
+	return strings
+}
@@ -0,0 +1,295 @@
+package npmblame
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+const projectManifest = `{
+	"name": "project",
+	"dependencies": {"a": "^1.0.0"},
+	"devDependencies": {"@scope/b": "^2.0.0"}
+}`
+
+var lockfiles = map[string]string{
+	"npm-v1/package-lock.json": `{
+		"lockfileVersion": 1,
+		"dependencies": {
+			"a": {"version": "1.0.0", "requires": {"c": "^1.0.0"}},
+			"@scope/b": {"version": "2.0.0", "dev": true, "requires": {"c": "^2.0.0"},
+				"dependencies": {"c": {"version": "2.1.0"}}},
+			"c": {"version": "1.2.0"}
+		}
+	}`,
+	"npm-v3/package-lock.json": `{
+		"lockfileVersion": 3,
+		"packages": {
+			"": {"name": "project", "dependencies": {"a": "^1.0.0"}, "devDependencies": {"@scope/b": "^2.0.0"}},
+			"node_modules/a": {"version": "1.0.0", "dependencies": {"c": "^1.0.0"}},
+			"node_modules/@scope/b": {"version": "2.0.0", "dev": true, "dependencies": {"c": "^2.0.0"}},
+			"node_modules/@scope/b/node_modules/c": {"version": "2.1.0"},
+			"node_modules/c": {"version": "1.2.0"}
+		}
+	}`,
+	"yarn/yarn.lock": `# THIS IS AN AUTOGENERATED FILE. DO NOT EDIT THIS FILE DIRECTLY.
+# yarn lockfile v1
+
+
+"@scope/b@^2.0.0":
+  version "2.0.0"
+  resolved "https://registry.yarnpkg.com/@scope/b/-/b-2.0.0.tgz"
+  dependencies:
+    c "^2.0.0"
+
+a@^1.0.0:
+  version "1.0.0"
+  dependencies:
+    c "^1.0.0"
+
+c@^1.0.0, c@^1.1.0:
+  version "1.2.0"
+
+c@^2.0.0:
+  version "2.1.0"
+`,
+	"berry/yarn.lock": `__metadata:
+  version: 6
+  cacheKey: 8
+
+"@scope/b@npm:^2.0.0":
+  version: 2.0.0
+  resolution: "@scope/b@npm:2.0.0"
+  dependencies:
+    c: ^2.0.0
+  languageName: node
+  linkType: hard
+
+"a@npm:^1.0.0":
+  version: 1.0.0
+  resolution: "a@npm:1.0.0"
+  dependencies:
+    c: "npm:^1.0.0"
+
+"c@npm:^1.0.0":
+  version: 1.2.0
+  resolution: "c@npm:1.2.0"
+
+"c@npm:^2.0.0":
+  version: 2.1.0
+  resolution: "c@npm:2.1.0"
+
+"project@workspace:.":
+  version: 0.0.0-use.local
+  resolution: "project@workspace:."
+  dependencies:
+    "@scope/b": ^2.0.0
+    a: ^1.0.0
+  languageName: unknown
+  linkType: soft
+`,
+	"pnpm-v5/pnpm-lock.yaml": `lockfileVersion: 5.4
+
+specifiers:
+  '@scope/b': ^2.0.0
+  a: ^1.0.0
+
+dependencies:
+  a: 1.0.0
+
+devDependencies:
+  '@scope/b': 2.0.0
+
+packages:
+
+  /@scope/b/2.0.0:
+    resolution: {integrity: sha512-b}
+    dependencies:
+      c: 2.1.0
+    dev: true
+
+  /a/1.0.0:
+    resolution: {integrity: sha512-a}
+    dependencies:
+      c: 1.2.0_react@18.0.0
+    dev: false
+
+  /c/1.2.0_react@18.0.0:
+    resolution: {integrity: sha512-c}
+    peerDependencies:
+      react: '*'
+
+  /c/2.1.0:
+    resolution: {integrity: sha512-c2}
+`,
+	"pnpm-v6/pnpm-lock.yaml": `lockfileVersion: '6.0'
+
+dependencies:
+  a:
+    specifier: ^1.0.0
+    version: 1.0.0
+
+devDependencies:
+  '@scope/b':
+    specifier: ^2.0.0
+    version: 2.0.0
+
+packages:
+
+  /@scope/b@2.0.0:
+    resolution: {integrity: sha512-b}
+    dependencies:
+      c: 2.1.0
+    dev: true
+
+  /a@1.0.0:
+    dependencies:
+      c: 1.2.0(react@18.0.0)
+
+  /c@1.2.0(react@18.0.0):
+    resolution: {integrity: sha512-c}
+
+  /c@2.1.0:
+    resolution: {integrity: sha512-c2}
+`,
+	"pnpm-v9/pnpm-lock.yaml": `lockfileVersion: '9.0'
+
+importers:
+
+  .:
+    dependencies:
+      a:
+        specifier: ^1.0.0
+        version: 1.0.0
+    devDependencies:
+      '@scope/b':
+        specifier: ^2.0.0
+        version: 2.0.0
+
+packages:
+
+  '@scope/b@2.0.0':
+    resolution: {integrity: sha512-b}
+
+  a@1.0.0:
+    resolution: {integrity: sha512-a}
+
+  c@1.2.0:
+    resolution: {integrity: sha512-c}
+
+  c@2.1.0:
+    resolution: {integrity: sha512-c2}
+
+snapshots:
+
+  '@scope/b@2.0.0':
+    dependencies:
+      c: 2.1.0
+
+  a@1.0.0:
+    dependencies:
+      c: 1.2.0(react@18.0.0)
+
+  c@1.2.0(react@18.0.0): {}
+
+  c@2.1.0: {}
+`,
+}
+
+// graphEdges returns the edges of a graph between name@version
+func graphEdges(g *DependencyGraph) []string {
+	var edges []string
+	for name, id := range g.Roots {
+		n := g.Nodes[id]
+		edges = append(edges, "project -> "+name+"@"+n.Version)
+	}
+	for _, n := range g.Nodes {
+		for _, id := range n.Dependencies {
+			dep := g.Nodes[id]
+			edges = append(edges, n.Name+"@"+n.Version+" -> "+dep.Name+"@"+dep.Version)
+		}
+	}
+	sort.Strings(edges)
+	return edges
+}
+
+func TestReadLockfile(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	for p, data := range lockfiles {
+		afero.WriteFile(fs, "/"+p, []byte(data), 0644)
+	}
+	afero.WriteFile(fs, "/npm-v1/package.json", []byte(projectManifest), 0644)
+	afero.WriteFile(fs, "/yarn/package.json", []byte(projectManifest), 0644)
+
+	want := []string{
+		"@scope/b@2.0.0 -> c@2.1.0",
+		"a@1.0.0 -> c@1.2.0",
+		"project -> @scope/b@2.0.0",
+		"project -> a@1.0.0",
+	}
+	for p := range lockfiles {
+		t.Run(p, func(t *testing.T) {
+			g, err := ReadLockfile(fs, "/"+p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if edges := graphEdges(g); !reflect.DeepEqual(edges, want) {
+				t.Errorf("Edges = %v, want %v", edges, want)
+			}
+		})
+	}
+}
+
+func TestReadLockfileErrors(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/npm/package-lock.json", []byte(`{"packages": [`), 0644)
+	afero.WriteFile(fs, "/yarn/yarn.lock", []byte("  version \"1.0.0\"\n"), 0644)
+	afero.WriteFile(fs, "/other/deps.lock", []byte(""), 0644)
+
+	for _, p := range []string{"/npm/package-lock.json", "/yarn/yarn.lock", "/other/deps.lock", "/missing/yarn.lock"} {
+		if _, err := ReadLockfile(fs, p); err == nil {
+			t.Errorf("Expected an error reading %s", p)
+		}
+	}
+}
+
+func TestReadLockfileGuessesRoots(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/package-lock.json", []byte(lockfiles["npm-v1/package-lock.json"]), 0644)
+	g, err := ReadLockfile(fs, "/package-lock.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Roots) != 2 || g.Roots["a"] == "" || g.Roots["@scope/b"] == "" {
+		t.Errorf("Without package.json the unrequired packages should be roots: %v", g.Roots)
+	}
+}
+
+func TestFindLockfile(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/project/yarn.lock", []byte(""), 0644)
+	afero.WriteFile(fs, "/project/package-lock.json", []byte("{}"), 0644)
+	if p, err := FindLockfile(fs, "/project"); err != nil || p != "/project/package-lock.json" {
+		t.Errorf("FindLockfile = %q, %v", p, err)
+	}
+	if _, err := FindLockfile(fs, "/empty"); err == nil {
+		t.Error("Expected a missing lockfile error")
+	}
+}
+
+func TestParsePnpmKey(t *testing.T) {
+	for key, want := range map[string][2]string{
+		"/a/1.0.0":                        {"a", "1.0.0"},
+		"/@scope/b/2.0.0_react@18.0.0":    {"@scope/b", "2.0.0"},
+		"/@scope/b@2.0.0(react@18.0.0)":   {"@scope/b", "2.0.0"},
+		"a@1.0.0":                         {"a", "1.0.0"},
+		"/under_score@1.0.0":              {"under_score", "1.0.0"},
+		"@scope/b@1.0.0-beta.1(@x/y@1.0)": {"@scope/b", "1.0.0-beta.1"},
+	} {
+		if name, version := parsePnpmKey(key); name != want[0] || version != want[1] {
+			t.Errorf("parsePnpmKey(%q) = %s, %s want %v", key, name, version, want)
+		}
+	}
+}
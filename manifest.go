@@ -0,0 +1,102 @@
+package npmblame
+
+import (
+	"encoding/json"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// Manifest represents the fields of a package.json used by npm-blame
+type Manifest struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Integrity is the tarball checksum recorded by npm at install time
+	Integrity string `json:"_integrity"`
+
+	Dependencies         map[string]string `json:"dependencies,omitempty"`
+	DevDependencies      map[string]string `json:"devDependencies,omitempty"`
+	OptionalDependencies map[string]string `json:"optionalDependencies,omitempty"`
+
+	// Main, Bin, Exports, Types and Typings reference the files loaded
+	// by the users of the package. Bin may be a string or an object,
+	// Exports any nesting of conditions.
+	Main    string      `json:"main,omitempty"`
+	Bin     interface{} `json:"bin,omitempty"`
+	Exports interface{} `json:"exports,omitempty"`
+	Types   string      `json:"types,omitempty"`
+	Typings string      `json:"typings,omitempty"`
+
+	// Repository is a string, npm shorthand or URL, or an object with
+	// type, url and directory fields. Bugs is a URL or an object with
+	// url and email fields.
+	Repository interface{} `json:"repository,omitempty"`
+	Bugs       interface{} `json:"bugs,omitempty"`
+}
+
+// EntryPoints returns the sorted paths, relative to the package folder,
+// referenced by the main, bin, exports, types and typings fields, main
+// defaulting to index.js. Exports subpath patterns keep their *
+// wildcard.
+func (m *Manifest) EntryPoints() []string {
+	seen := make(map[string]bool)
+	var add func(v interface{})
+	add = func(v interface{}) {
+		switch v := v.(type) {
+		case string:
+			if v != "" {
+				seen[path.Clean(strings.TrimPrefix(v, "./"))] = true
+			}
+		case []interface{}:
+			for _, e := range v {
+				add(e)
+			}
+		case map[string]interface{}:
+			for _, e := range v {
+				add(e)
+			}
+		}
+	}
+	// Node loads index.js without main field
+	main := m.Main
+	if main == "" {
+		main = "index.js"
+	}
+	for _, v := range []interface{}{main, m.Bin, m.Exports, m.Types, m.Typings} {
+		add(v)
+	}
+	entries := make([]string, 0, len(seen))
+	for e := range seen {
+		entries = append(entries, e)
+	}
+	sort.Strings(entries)
+	return entries
+}
+
+// DirectDependencies returns the version ranges of all the dependencies
+// of the manifest, including the development and optional ones
+func (m *Manifest) DirectDependencies() map[string]string {
+	deps := make(map[string]string)
+	for _, d := range []map[string]string{m.DevDependencies, m.OptionalDependencies, m.Dependencies} {
+		for name, r := range d {
+			deps[name] = r
+		}
+	}
+	return deps
+}
+
+// ReadManifest reads the package.json of the package installed in dir
+func ReadManifest(fs afero.Fs, dir string) (*Manifest, error) {
+	data, err := afero.ReadFile(fs, filepath.Join(dir, "package.json"))
+	if err != nil {
+		return nil, err
+	}
+	m := new(Manifest)
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
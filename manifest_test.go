@@ -0,0 +1,60 @@
+package npmblame
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestReadManifest(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/pkg/package.json", []byte(`{
+		"name": "pkg",
+		"version": "1.0.0",
+		"_integrity": "sha512-abc"
+	}`), 0644)
+	afero.WriteFile(fs, "/broken/package.json", []byte(`{`), 0644)
+
+	t.Run("Valid", func(t *testing.T) {
+		m, err := ReadManifest(fs, "/pkg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Name != "pkg" || m.Version != "1.0.0" || m.Integrity != "sha512-abc" {
+			t.Errorf("Wrong manifest: %+v", m)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		if _, err := ReadManifest(fs, "/broken"); err == nil {
+			t.Error("Expected a parsing error")
+		}
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		if _, err := ReadManifest(fs, "/missing"); err == nil {
+			t.Error("Expected a missing file error")
+		}
+	})
+}
+
+func TestManifestEntryPoints(t *testing.T) {
+	m := &Manifest{
+		Main:  "./lib/index",
+		Bin:   map[string]interface{}{"pkg": "bin/cli.js", "alias": "./bin/cli.js"},
+		Types: "index.d.ts",
+		Exports: map[string]interface{}{
+			".":            map[string]interface{}{"import": "./esm/index.mjs", "require": []interface{}{"./lib/index.js"}},
+			"./features/*": "./features/*.js",
+			"./internal":   nil,
+		},
+	}
+	want := []string{"bin/cli.js", "esm/index.mjs", "features/*.js", "index.d.ts", "lib/index", "lib/index.js"}
+	if entries := m.EntryPoints(); !reflect.DeepEqual(entries, want) {
+		t.Errorf("EntryPoints = %v, want %v", entries, want)
+	}
+	if entries := (&Manifest{Bin: "cli.js"}).EntryPoints(); !reflect.DeepEqual(entries, []string{"cli.js", "index.js"}) {
+		t.Errorf("Wrong string bin entry points: %v", entries)
+	}
+}
@@ -0,0 +1,317 @@
+package npmblame
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// outboxVersion is bumped whenever the outbox file changes shape
+const outboxVersion = 1
+
+// Review decisions recorded in the outbox
+const (
+	// SkipDecision skips a package version, newer versions are reviewed
+	SkipDecision = "skip"
+	// SuppressDecision never reports the package
+	SuppressDecision = "suppress"
+)
+
+// OutboxEntry is the report of a package queued in the outbox, or the
+// review decision not to send it
+type OutboxEntry struct {
+	Package string `json:"package"`
+	Version string `json:"version,omitempty"`
+	// Host is the tracker host the report is sent to
+	Host   string  `json:"host"`
+	Report *Report `json:"report"`
+
+	Attempts int `json:"attempts,omitempty"`
+	// NextAttempt delays the retries of rate limited or failed sends
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+	// Failed is set once the report was rejected, or ran out of attempts
+	Failed bool `json:"failed,omitempty"`
+	// Decision is the review decision of a package not to report
+	Decision string `json:"decision,omitempty"`
+
+	// Findings and BlamedBytes are the blame of the reported version
+	Findings    map[PackageError]int `json:"findings,omitempty"`
+	BlamedBytes int64                `json:"blamed_bytes,omitempty"`
+
+	// Issue is the issue created for the package, once sent
+	Issue  *Issue    `json:"issue,omitempty"`
+	SentAt time.Time `json:"sent_at"`
+
+	// IssueState is the issue state at the last refresh
+	IssueState string    `json:"issue_state,omitempty"`
+	CheckedAt  time.Time `json:"checked_at"`
+	// FixedIn is the first installed version found fixed
+	FixedIn string `json:"fixed_in,omitempty"`
+	// Thanked is set once the fix was acknowledged on the issue
+	Thanked bool `json:"thanked,omitempty"`
+}
+
+// Pending reports whether the report still has to be sent
+func (e *OutboxEntry) Pending() bool {
+	return e.Issue == nil && !e.Failed && e.Decision == ""
+}
+
+// String returns the printable state of the entry
+func (e *OutboxEntry) String() string {
+	switch {
+	case e.Issue != nil:
+		return fmt.Sprintf("%s: reported at %s", e.Package, e.Issue.URL)
+	case e.Decision == SuppressDecision:
+		return fmt.Sprintf("%s: suppressed", e.Package)
+	case e.Decision == SkipDecision:
+		return fmt.Sprintf("%s: skipped version %s", e.Package, e.Version)
+	case e.Failed:
+		return fmt.Sprintf("%s: report failed after %d attempts. %s", e.Package, e.Attempts, e.LastError)
+	case e.Attempts > 0:
+		return fmt.Sprintf("%s: report pending, next attempt at %s. %s",
+			e.Package, e.NextAttempt.Format(time.RFC3339), e.LastError)
+	}
+	return fmt.Sprintf("%s: report pending", e.Package)
+}
+
+// Outbox is a queue of package reports persisted on disk. Sends are
+// retried with an exponential backoff, respect the rate limits of the
+// trackers and resume on the next run when they would wait too long.
+// Sent reports are kept, recording the issue of every package.
+type Outbox struct {
+	// MaxAttempts bounds the sends of a report
+	MaxAttempts int
+	// Backoff is the wait after the first failed send, doubled on
+	// every following attempt
+	Backoff time.Duration
+	// MaxWait is the longest wait of a flush, the reports waiting longer
+	// are left for the next run
+	MaxWait time.Duration
+	// Interval spaces the sends to a host, as GitHub secondary rate
+	// limits forbid creating issues in bursts
+	Interval time.Duration
+
+	fs      afero.Fs
+	path    string
+	entries []*OutboxEntry
+	now     func() time.Time
+	sleep   func(time.Duration)
+}
+
+type outboxFile struct {
+	Version int            `json:"version"`
+	Entries []*OutboxEntry `json:"entries"`
+}
+
+// DefaultOutboxPath returns the outbox location in the user config
+// folder, which unlike the cache folder is not meant to be cleared
+func DefaultOutboxPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "npm-blame", "outbox.json"), nil
+}
+
+// OpenOutbox loads the outbox stored at path on fs.
+// A missing outbox file gives an empty outbox.
+func OpenOutbox(fs afero.Fs, path string) (*Outbox, error) {
+	o := &Outbox{
+		MaxAttempts: 5,
+		Backoff:     5 * time.Second,
+		MaxWait:     time.Minute,
+		Interval:    time.Second,
+		fs:          fs,
+		path:        path,
+		now:         time.Now,
+		sleep:       time.Sleep,
+	}
+	data, err := afero.ReadFile(fs, path)
+	if os.IsNotExist(err) {
+		return o, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file outboxFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid outbox %s: %v", path, err)
+	}
+	if file.Version != outboxVersion {
+		return nil, fmt.Errorf("unsupported outbox %s version %d", path, file.Version)
+	}
+	o.entries = file.Entries
+	return o, nil
+}
+
+// Entries returns the queued and sent reports, in queue order
+func (o *Outbox) Entries() []*OutboxEntry {
+	return o.entries
+}
+
+// Entry returns the entry of a package, or nil
+func (o *Outbox) Entry(name string) *OutboxEntry {
+	for _, e := range o.entries {
+		if e.Package == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// Pending returns the reports still to be sent
+func (o *Outbox) Pending() []*OutboxEntry {
+	var pending []*OutboxEntry
+	for _, e := range o.entries {
+		if e.Pending() {
+			pending = append(pending, e)
+		}
+	}
+	return pending
+}
+
+// Queue adds the report of a package to the outbox, replacing its
+// pending, failed or skipped report. Packages already reported or
+// suppressed are not queued again and their entry is returned with false.
+func (o *Outbox) Queue(i *Instance, host string, r *Report) (*OutboxEntry, bool) {
+	e := o.Entry(i.Name)
+	if e != nil && (e.Issue != nil || e.Decision == SuppressDecision) {
+		return e, false
+	}
+	e = o.reset(i)
+	e.Host, e.Report = host, r
+	e.Findings, e.BlamedBytes = i.Errors, i.BlamedBytes()
+	return e, true
+}
+
+// Decide records the decision not to report a package, replacing its
+// pending, failed or skipped report. Reported packages are left as is.
+func (o *Outbox) Decide(i *Instance, decision string) *OutboxEntry {
+	if e := o.Entry(i.Name); e != nil && e.Issue != nil {
+		return e
+	}
+	e := o.reset(i)
+	e.Decision = decision
+	return e
+}
+
+// Decided reports whether a package needs no review: it was reported,
+// is waiting to be, was suppressed, or its version skipped
+func (o *Outbox) Decided(i *Instance) bool {
+	e := o.Entry(i.Name)
+	switch {
+	case e == nil:
+		return false
+	case e.Decision == SkipDecision:
+		return e.Version == i.Version
+	}
+	return !e.Failed
+}
+
+// reset returns the emptied entry of a package, added when missing
+func (o *Outbox) reset(i *Instance) *OutboxEntry {
+	e := o.Entry(i.Name)
+	if e == nil {
+		e = &OutboxEntry{}
+		o.entries = append(o.entries, e)
+	}
+	*e = OutboxEntry{Package: i.Name, Version: i.Version}
+	return e
+}
+
+// Flush sends the pending reports in queue order with the trackers
+// returned by trackerFor, saving the outbox after every attempt.
+// sent is called, when not nil, after every attempt.
+func (o *Outbox) Flush(trackerFor func(host string) (Tracker, error), sent func(*OutboxEntry)) error {
+	// notBefore holds the earliest next send per host
+	notBefore := make(map[string]time.Time)
+	for _, e := range o.entries {
+		for e.Pending() {
+			next := e.NextAttempt
+			if t := notBefore[e.Host]; t.After(next) {
+				next = t
+			}
+			wait := next.Sub(o.now())
+			if wait > o.MaxWait {
+				// Left for the next run
+				e.NextAttempt = next
+				break
+			}
+			if wait > 0 {
+				o.sleep(wait)
+			}
+
+			tracker, err := trackerFor(e.Host)
+			if err == nil {
+				e.Issue, err = e.Report.Send(tracker)
+			}
+			now := o.now()
+			e.Attempts++
+			notBefore[e.Host] = now.Add(o.Interval)
+			if err != nil {
+				o.retry(e, err, now, notBefore)
+			} else {
+				e.SentAt = now
+				e.LastError = ""
+			}
+
+			if err := o.Save(); err != nil {
+				return err
+			}
+			if sent != nil {
+				sent(e)
+			}
+		}
+	}
+	return nil
+}
+
+// retry schedules the next attempt of a failed send, or marks it failed
+func (o *Outbox) retry(e *OutboxEntry, err error, now time.Time, notBefore map[string]time.Time) {
+	e.Issue = nil
+	e.LastError = err.Error()
+	if !temporary(err) || e.Attempts >= o.MaxAttempts {
+		e.Failed = true
+		return
+	}
+	e.NextAttempt = now.Add(o.Backoff << uint(e.Attempts-1))
+	if te, ok := err.(*TrackerError); ok && !te.RetryAt.IsZero() {
+		// Rate limits apply to every report sent to the host
+		e.NextAttempt = te.RetryAt
+		if te.RetryAt.After(notBefore[e.Host]) {
+			notBefore[e.Host] = te.RetryAt
+		}
+	}
+}
+
+// temporary reports whether a failed send may succeed when retried:
+// rate limits, server errors and network errors. Sends failing once the
+// issue was created are retried too, the marker of the report finding
+// the issue back.
+func temporary(err error) bool {
+	switch err := err.(type) {
+	case *TrackerError:
+		return err.Temporary()
+	case net.Error:
+		return true
+	}
+	return false
+}
+
+// Save writes the outbox back to disk
+func (o *Outbox) Save() error {
+	data, err := json.MarshalIndent(outboxFile{Version: outboxVersion, Entries: o.entries}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := o.fs.MkdirAll(filepath.Dir(o.path), 0755); err != nil {
+		return err
+	}
+	return afero.WriteFile(o.fs, o.path, data, 0644)
+}
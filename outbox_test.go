@@ -0,0 +1,289 @@
+package npmblame
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// fakeTracker answers the created issues with the queued errors
+type fakeTracker struct {
+	errs    []error
+	created []string
+	issues  []*NewIssue
+	// lostErr fails the next created issue after creating it
+	lostErr error
+	// updated lists the updated issues by number
+	updated []int
+	// closed lists the closed issues by number
+	closed   map[int]bool
+	comments map[int][]string
+	// stateErr fails the issue state requests when set
+	stateErr error
+	// repositories are the metadata by owner/repo, every repository
+	// accepting issues when nil
+	repositories map[string]*RepositoryInfo
+	// files are the contents of the default branch by owner/repo/path
+	files map[string]string
+}
+
+func (t *fakeTracker) CreateIssue(owner, repo string, issue *NewIssue) (*Issue, error) {
+	if len(t.errs) > 0 {
+		err := t.errs[0]
+		t.errs = t.errs[1:]
+		if err != nil {
+			return nil, err
+		}
+	}
+	t.created = append(t.created, owner+"/"+repo)
+	t.issues = append(t.issues, issue)
+	if t.lostErr != nil {
+		// The issue is created but its response lost
+		err := t.lostErr
+		t.lostErr = nil
+		return nil, err
+	}
+	return &Issue{Number: len(t.created), URL: fmt.Sprintf("https://github.com/%s/%s/issues/%d", owner, repo, len(t.created))}, nil
+}
+
+func (t *fakeTracker) OwnIssues(owner, repo string, labels []string) ([]*FoundIssue, error) {
+	var found []*FoundIssue
+	for n := len(t.issues) - 1; n >= 0; n-- {
+		if t.created[n] != owner+"/"+repo {
+			continue
+		}
+		found = append(found, &FoundIssue{
+			Issue: Issue{Number: n + 1, URL: fmt.Sprintf("https://github.com/%s/%s/issues/%d", owner, repo, n+1)},
+			Body:  t.issues[n].Body,
+		})
+	}
+	return found, nil
+}
+
+func (t *fakeTracker) UpdateIssue(owner, repo string, number int, title, body string) error {
+	t.updated = append(t.updated, number)
+	t.issues[number-1].Title, t.issues[number-1].Body = title, body
+	return nil
+}
+
+func (t *fakeTracker) IssueState(owner, repo string, number int) (string, error) {
+	if t.stateErr != nil {
+		return "", t.stateErr
+	}
+	if t.closed[number] {
+		return IssueClosed, nil
+	}
+	return IssueOpen, nil
+}
+
+func (t *fakeTracker) Comment(owner, repo string, number int, body string) error {
+	if t.comments == nil {
+		t.comments = make(map[int][]string)
+	}
+	t.comments[number] = append(t.comments[number], body)
+	return nil
+}
+
+func (t *fakeTracker) RepositoryInfo(owner, repo string) (*RepositoryInfo, error) {
+	if t.repositories == nil {
+		return &RepositoryInfo{HasIssues: true}, nil
+	}
+	info, ok := t.repositories[owner+"/"+repo]
+	if !ok {
+		return nil, &TrackerError{StatusCode: http.StatusNotFound, Message: "Not Found"}
+	}
+	return info, nil
+}
+
+func (t *fakeTracker) FileContent(owner, repo, ref, path string) ([]byte, error) {
+	content, ok := t.files[owner+"/"+repo+"/"+path]
+	if !ok {
+		return nil, nil
+	}
+	return []byte(content), nil
+}
+
+// fakeClock is a clock advanced by the outbox sleeps
+type fakeClock struct {
+	now   time.Time
+	slept []time.Duration
+}
+
+func newTestOutbox(t *testing.T, fs afero.Fs) (*Outbox, *fakeClock) {
+	o, err := OpenOutbox(fs, "/config/outbox.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	o.now = func() time.Time { return clock.now }
+	o.sleep = func(d time.Duration) {
+		clock.slept = append(clock.slept, d)
+		clock.now = clock.now.Add(d)
+	}
+	return o, clock
+}
+
+func queueTestReports(o *Outbox, names ...string) {
+	for _, name := range names {
+		o.Queue(&Instance{Name: name, Version: "1.0.0"}, "github.com", NewReport("owner", name, nil))
+	}
+}
+
+func TestOutboxFlush(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	o, clock := newTestOutbox(t, fs)
+	queueTestReports(o, "a", "b")
+	tracker := &fakeTracker{errs: []error{
+		&TrackerError{StatusCode: http.StatusBadGateway},
+		nil,
+	}}
+	var attempts int
+	err := o.Flush(func(host string) (Tracker, error) { return tracker, nil }, func(*OutboxEntry) { attempts++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attempts != 3 || len(tracker.created) != 2 {
+		t.Errorf("Expected 3 attempts and 2 issues got %d and %v", attempts, tracker.created)
+	}
+	// Backoff after the failure, then the interval between sends
+	if fmt.Sprint(clock.slept) != "[5s 1s]" {
+		t.Errorf("Wrong waits %v", clock.slept)
+	}
+	if e := o.Entry("a"); e.Issue == nil || e.Issue.URL != "https://github.com/owner/a/issues/1" || e.Attempts != 2 {
+		t.Errorf("Wrong entry %+v", e)
+	}
+
+	// Sent reports are recorded and not queued again
+	reopened, _ := newTestOutbox(t, fs)
+	if len(reopened.Entries()) != 2 || len(reopened.Pending()) != 0 {
+		t.Fatalf("Expected 2 sent entries got %+v", reopened.Entries())
+	}
+	if e, queued := reopened.Queue(&Instance{Name: "a"}, "github.com", NewReport("owner", "a", nil)); queued || e.Issue == nil {
+		t.Error("A reported package should not be queued again")
+	}
+	if e := reopened.Entry("b"); e.String() != "b: reported at https://github.com/owner/b/issues/2" {
+		t.Errorf("Wrong entry %s", e)
+	}
+}
+
+func TestOutboxRateLimit(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	o, clock := newTestOutbox(t, fs)
+	queueTestReports(o, "a", "b")
+	tracker := &fakeTracker{errs: []error{
+		&TrackerError{StatusCode: http.StatusForbidden, RetryAt: clock.now.Add(time.Hour)},
+	}}
+	trackerFor := func(host string) (Tracker, error) { return tracker, nil }
+	if err := o.Flush(trackerFor, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The rate limit holds every report to the host until the next run
+	if len(o.Pending()) != 2 || len(clock.slept) != 0 {
+		t.Fatalf("Expected 2 pending reports and no wait got %+v and %v", o.Pending(), clock.slept)
+	}
+	for _, e := range o.Pending() {
+		if !e.NextAttempt.Equal(clock.now.Add(time.Hour)) {
+			t.Errorf("%s: wrong next attempt %s", e.Package, e.NextAttempt)
+		}
+	}
+
+	resumed, resumedClock := newTestOutbox(t, fs)
+	resumedClock.now = clock.now.Add(time.Hour)
+	if err := resumed.Flush(trackerFor, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(resumed.Pending()) != 0 || len(tracker.created) != 2 {
+		t.Errorf("Expected the reports to be sent on the next run got %v", tracker.created)
+	}
+}
+
+func TestOutboxFailures(t *testing.T) {
+	o, _ := newTestOutbox(t, afero.NewMemMapFs())
+	queueTestReports(o, "rejected", "flaky", "unknown")
+	o.MaxAttempts = 2
+	tracker := &fakeTracker{errs: []error{
+		&TrackerError{StatusCode: http.StatusNotFound, Message: "Not Found"},
+		&TrackerError{StatusCode: http.StatusInternalServerError},
+		&TrackerError{StatusCode: http.StatusInternalServerError},
+	}}
+	err := o.Flush(func(host string) (Tracker, error) {
+		if len(tracker.errs) == 0 {
+			return nil, fmt.Errorf("unknown tracker host %s", host)
+		}
+		return tracker, nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, attempts := range map[string]int{"rejected": 1, "flaky": 2, "unknown": 1} {
+		e := o.Entry(name)
+		if !e.Failed || e.Attempts != attempts {
+			t.Errorf("%s: expected to fail after %d attempts got %+v", name, attempts, e)
+		}
+	}
+	if e := o.Entry("rejected"); e.String() != "rejected: report failed after 1 attempts. 404 Not Found" {
+		t.Errorf("Wrong entry %s", e)
+	}
+
+	// Failed reports can be queued again
+	if _, queued := o.Queue(&Instance{Name: "rejected"}, "github.com", NewReport("owner", "rejected", nil)); !queued || len(o.Pending()) != 1 {
+		t.Error("A failed report should be queued again")
+	}
+}
+
+func TestOutboxLostResponse(t *testing.T) {
+	o, _ := newTestOutbox(t, afero.NewMemMapFs())
+	queueTestReports(o, "pkg")
+	o.Entry("pkg").Report.Marker = &ReportMarker{NpmBlameVersion: Version, Package: "pkg", Version: "1.0.0"}
+	// The issue is created but the response times out, before the search
+	// indexes of the trackers would find it
+	tracker := &fakeTracker{lostErr: &url.Error{Op: "Post", URL: "https://api.github.com", Err: &net.OpError{Op: "read", Net: "tcp", Err: fmt.Errorf("i/o timeout")}}}
+	if err := o.Flush(func(host string) (Tracker, error) { return tracker, nil }, nil); err != nil {
+		t.Fatal(err)
+	}
+	e := o.Entry("pkg")
+	if len(tracker.issues) != 1 || e.Issue == nil || e.Issue.Number != 1 || e.Attempts != 2 {
+		t.Errorf("Expected the retry to find the created issue got %d issues, %+v", len(tracker.issues), e)
+	}
+	if len(tracker.updated) != 1 || tracker.updated[0] != 1 {
+		t.Errorf("Expected the found issue to be updated got %v", tracker.updated)
+	}
+}
+
+func TestTemporary(t *testing.T) {
+	refused := &url.Error{Op: "Post", URL: "https://api.github.com", Err: &net.OpError{Op: "dial", Net: "tcp", Err: fmt.Errorf("connection refused")}}
+	timeout := &url.Error{Op: "Post", URL: "https://api.github.com", Err: &net.OpError{Op: "read", Net: "tcp", Err: fmt.Errorf("i/o timeout")}}
+	for _, tc := range []struct {
+		err       error
+		temporary bool
+	}{
+		{refused, true},
+		{timeout, true},
+		{&TrackerError{StatusCode: http.StatusServiceUnavailable}, true},
+		{&TrackerError{StatusCode: http.StatusUnprocessableEntity}, false},
+		{fmt.Errorf("invalid character"), false},
+	} {
+		if got := temporary(tc.err); got != tc.temporary {
+			t.Errorf("temporary(%v) = %t, want %t", tc.err, got, tc.temporary)
+		}
+	}
+}
+
+func TestOpenOutbox(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/broken.json", []byte(`{`), 0644)
+	afero.WriteFile(fs, "/future.json", []byte(`{"version": 42}`), 0644)
+	for _, path := range []string{"/broken.json", "/future.json"} {
+		if _, err := OpenOutbox(fs, path); err == nil {
+			t.Errorf("Expected an error for %s", path)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package npmblame
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// ignoreRule is a .gitignore style pattern
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negated bool
+	// dirOnly rules end with a slash and only match folders
+	dirOnly bool
+	// anchored rules match paths from the package folder, others match
+	// file and folder names at any depth
+	anchored bool
+}
+
+// parseIgnoreRule parses a pattern, anchor anchoring it even without
+// slash as the entries of the files field. Blank lines and comments
+// give a nil rule.
+func parseIgnoreRule(line string, anchor bool) (*ignoreRule, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, nil
+	}
+	r := &ignoreRule{anchored: anchor}
+	if strings.HasPrefix(line, "!") {
+		r.negated = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		r.anchored = true
+	}
+	line = strings.TrimPrefix(path.Clean("/"+line), "/")
+	if line == "" {
+		return nil, nil
+	}
+	var err error
+	if r.re, err = globRegexp(line); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %v", line, err)
+	}
+	return r, nil
+}
+
+// match reports whether the rule matches a file, or one of its folders
+func (r *ignoreRule) match(p string) bool {
+	parts := strings.Split(p, "/")
+	for n := 1; n <= len(parts); n++ {
+		if n == len(parts) && r.dirOnly {
+			break
+		}
+		target := parts[n-1]
+		if r.anchored {
+			target = strings.Join(parts[:n], "/")
+		}
+		if r.re.MatchString(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Packlist decides which files of a package npm publishes, from the files
+// field of its package.json or, without files field, its .npmignore or
+// .gitignore rules. The files npm excludes whatever the configuration,
+// such as .git folders, are not taken into account: Packlist tells
+// whether the package configuration keeps a file out.
+type Packlist struct {
+	hasFiles bool
+	files    []*ignoreRule
+	ignores  []*ignoreRule
+	main     string
+}
+
+// NewPacklist returns the packlist of a package.json and its ignore file,
+// ignore being nil when the package has none
+func NewPacklist(manifest []byte, ignore []byte) (*Packlist, error) {
+	var m struct {
+		Files *[]string `json:"files"`
+		Main  string    `json:"main"`
+	}
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return nil, fmt.Errorf("invalid package.json: %v", err)
+	}
+	p := &Packlist{main: path.Clean(strings.TrimPrefix(m.Main, "./"))}
+	if m.Files != nil {
+		p.hasFiles = true
+		for _, entry := range *m.Files {
+			r, err := parseIgnoreRule(entry, true)
+			if err != nil {
+				return nil, fmt.Errorf("invalid files field: %v", err)
+			}
+			if r != nil {
+				p.files = append(p.files, r)
+			}
+		}
+		// The files field takes precedence over the ignore file
+		return p, nil
+	}
+	for _, line := range strings.Split(string(ignore), "\n") {
+		r, err := parseIgnoreRule(line, false)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ignore file: %v", err)
+		}
+		if r != nil {
+			p.ignores = append(p.ignores, r)
+		}
+	}
+	return p, nil
+}
+
+// alwaysPublished matches the top level files npm always publishes
+var alwaysPublished = regexp.MustCompile(`(?i)^(package\.json|(readme|copying|license|licence)(\..*)?)$`)
+
+// Published reports whether npm publishes a file, given by its slash
+// separated path relative to the package folder
+func (p *Packlist) Published(file string) bool {
+	if alwaysPublished.MatchString(file) || file == p.main {
+		return true
+	}
+	if p.hasFiles {
+		published := false
+		for _, r := range p.files {
+			if r.match(file) {
+				published = !r.negated
+			}
+		}
+		return published
+	}
+	ignored := false
+	for _, r := range p.ignores {
+		if r.match(file) {
+			ignored = !r.negated
+		}
+	}
+	return !ignored
+}
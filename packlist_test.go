@@ -0,0 +1,59 @@
+package npmblame
+
+import "testing"
+
+func TestPacklist(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		manifest  string
+		ignore    string
+		published []string
+		excluded  []string
+	}{
+		{
+			name:      "No configuration",
+			manifest:  `{"name": "a"}`,
+			published: []string{"index.js", "test/a.js", ".travis.yml"},
+		},
+		{
+			name:      "npmignore",
+			manifest:  `{"name": "a"}`,
+			ignore:    "# Development\ntest/\n*.png\n!logo.png\n/.travis.yml\n",
+			published: []string{"index.js", "lib/test.js", "logo.png", "lib/.travis.yml"},
+			excluded:  []string{"test/a.js", "lib/test/a.js", "docs/screen.png", ".travis.yml"},
+		},
+		{
+			name:      "Files field",
+			manifest:  `{"name": "a", "main": "./index.js", "files": ["lib", "bin/*.js", "!lib/test"]}`,
+			ignore:    "lib/\n",
+			published: []string{"index.js", "README.md", "LICENSE", "package.json", "lib/a.js", "lib/deep/b.js", "bin/cli.js"},
+			excluded:  []string{"test/a.js", "lib/test/a.js", "src/lib/a.js", "bin/cli.sh", ".travis.yml"},
+		},
+		{
+			name:      "Empty files field",
+			manifest:  `{"name": "a", "files": []}`,
+			published: []string{"package.json", "readme"},
+			excluded:  []string{"index.js"},
+		},
+	} {
+		p, err := NewPacklist([]byte(tc.manifest), []byte(tc.ignore))
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		for _, f := range tc.published {
+			if !p.Published(f) {
+				t.Errorf("%s: expected %s to be published", tc.name, f)
+			}
+		}
+		for _, f := range tc.excluded {
+			if p.Published(f) {
+				t.Errorf("%s: expected %s to be excluded", tc.name, f)
+			}
+		}
+	}
+
+	if _, err := NewPacklist([]byte(`{"files": "lib"}`), nil); err == nil {
+		t.Error("Expected an invalid files field error")
+	}
+}
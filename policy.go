@@ -0,0 +1,131 @@
+package npmblame
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/spf13/afero"
+)
+
+// Policy defines the limits a scan result must respect,
+// typically to block merges bringing in bloated dependencies.
+// Limits missing from the policy are disabled.
+type Policy struct {
+	// MaxBlamedBytes is the maximum size of all the blamed files,
+	// nil for no limit and 0 allowing none
+	MaxBlamedBytes *int64 `json:"max_blamed_bytes"`
+	// MaxErrors is the maximum count of each package error listed,
+	// 0 allowing none
+	MaxErrors map[PackageError]int `json:"max_errors"`
+	// Forbidden lists the package errors no package may have
+	Forbidden []PackageError `json:"forbidden"`
+	// Budgets is the maximum installed size of packages by name, 0
+	// allowing no installed file.
+	// The "*" budget applies to the packages without their own.
+	Budgets map[string]int64 `json:"budgets"`
+}
+
+// Violation is a policy limit exceeded by a scan result
+type Violation struct {
+	Rule    string `json:"rule"`
+	Package string `json:"package,omitempty"`
+	Message string `json:"message"`
+}
+
+// LoadPolicy reads a JSON policy file
+func LoadPolicy(fs afero.Fs, path string) (*Policy, error) {
+	data, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, err
+	}
+	p := new(Policy)
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %v", path, err)
+	}
+	return p, nil
+}
+
+// Check returns the policy violations of a scan result
+func (p *Policy) Check(r *Result) []Violation {
+	var violations []Violation
+
+	if p.MaxBlamedBytes != nil {
+		var total int64
+		for _, i := range r.Instances {
+			total += i.BlamedBytes()
+		}
+		if total > *p.MaxBlamedBytes {
+			violations = append(violations, Violation{
+				Rule: "max_blamed_bytes",
+				Message: fmt.Sprintf("%s of blamed files exceeds the %s limit",
+					formatBytes(total), formatBytes(*p.MaxBlamedBytes)),
+			})
+		}
+	}
+
+	totals := make(map[PackageError]int)
+	for _, errors := range r.Packages {
+		for err, count := range errors {
+			totals[err] += count
+		}
+	}
+	for _, err := range PackageErrors {
+		if max, ok := p.MaxErrors[err]; ok && totals[err] > max {
+			violations = append(violations, Violation{
+				Rule:    "max_errors",
+				Message: fmt.Sprintf("%d %s errors exceed the limit of %d", totals[err], err, max),
+			})
+		}
+	}
+
+	names := r.Names()
+	for _, err := range p.Forbidden {
+		for _, name := range names {
+			if count := r.Packages[name][err]; count > 0 {
+				violations = append(violations, Violation{
+					Rule:    "forbidden",
+					Package: name,
+					Message: fmt.Sprintf("%s has %d forbidden %s errors", name, count, err),
+				})
+			}
+		}
+	}
+
+	if len(p.Budgets) > 0 {
+		sizes := make(map[string]int64)
+		for _, i := range r.Instances {
+			sizes[i.Name] += i.Size
+		}
+		for _, name := range names {
+			budget, ok := p.Budgets[name]
+			if !ok {
+				budget, ok = p.Budgets["*"]
+			}
+			if ok && sizes[name] > budget {
+				violations = append(violations, Violation{
+					Rule:    "budget",
+					Package: name,
+					Message: fmt.Sprintf("%s weighs %s, over its %s budget",
+						name, formatBytes(sizes[name]), formatBytes(budget)),
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(violations, func(i, j int) bool {
+		return violations[i].Rule < violations[j].Rule
+	})
+	return violations
+}
+
+// FormatViolations returns a concise summary of policy violations
+func FormatViolations(violations []Violation) string {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "%d policy violations:\n", len(violations))
+	for _, v := range violations {
+		fmt.Fprintf(buf, "  [%s] %s\n", v.Rule, v.Message)
+	}
+	return buf.String()
+}
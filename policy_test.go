@@ -0,0 +1,125 @@
+package npmblame
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func policyResult() *Result {
+	r := NewResult()
+	r.Packages = NpmPackages{
+		"big":    {ImageError: 3},
+		"leaky":  {SecretError: 1},
+		"small":  {},
+		"tested": {TestError: 2},
+	}
+	r.Instances = []*Instance{
+		{Name: "big", Path: "/big", Size: 5000, Files: []BlamedFile{
+			{Path: "logo.png", Size: 2000, Errors: []PackageError{ImageError}},
+		}},
+		{Name: "leaky", Path: "/leaky", Size: 100},
+		{Name: "small", Path: "/small", Size: 10},
+		{Name: "tested", Path: "/tested", Size: 100},
+	}
+	return r
+}
+
+func TestLoadPolicy(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/policy.json", []byte(`{
+		"max_blamed_bytes": 1000,
+		"max_errors": {"image": 2},
+		"forbidden": ["secret", "vcs"],
+		"budgets": {"big": 1000, "*": 50}
+	}`), 0644)
+	afero.WriteFile(fs, "/invalid.json", []byte(`{"forbidden": ["unknown"]}`), 0644)
+
+	p, err := LoadPolicy(fs, "/policy.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.MaxBlamedBytes == nil || *p.MaxBlamedBytes != 1000 || p.MaxErrors[ImageError] != 2 ||
+		len(p.Forbidden) != 2 || p.Budgets["*"] != 50 {
+		t.Errorf("Wrong policy: %+v", p)
+	}
+
+	afero.WriteFile(fs, "/none.json", []byte(`{"max_blamed_bytes": 0}`), 0644)
+	if p, err := LoadPolicy(fs, "/none.json"); err != nil || p.MaxBlamedBytes == nil || *p.MaxBlamedBytes != 0 {
+		t.Errorf("A zero max_blamed_bytes should allow none got %+v %v", p, err)
+	}
+
+	if _, err := LoadPolicy(fs, "/invalid.json"); err == nil {
+		t.Error("Unknown package errors should be rejected")
+	}
+	if _, err := LoadPolicy(fs, "/missing.json"); err == nil {
+		t.Error("Expected a missing file error")
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	r := policyResult()
+
+	t.Run("Empty policy", func(t *testing.T) {
+		if v := new(Policy).Check(r); len(v) != 0 {
+			t.Errorf("Expected no violations got %v", v)
+		}
+	})
+
+	t.Run("Limits", func(t *testing.T) {
+		maxBlamedBytes := int64(1000)
+		p := &Policy{
+			MaxBlamedBytes: &maxBlamedBytes,
+			MaxErrors:      map[PackageError]int{ImageError: 2, TestError: 2},
+			Forbidden:      []PackageError{SecretError},
+			Budgets:        map[string]int64{"big": 10000, "*": 50},
+		}
+		v := p.Check(r)
+		want := []Violation{
+			{Rule: "budget", Package: "leaky", Message: "leaky weighs 100 B, over its 50 B budget"},
+			{Rule: "budget", Package: "tested", Message: "tested weighs 100 B, over its 50 B budget"},
+			{Rule: "forbidden", Package: "leaky", Message: "leaky has 1 forbidden secret errors"},
+			{Rule: "max_blamed_bytes", Message: "2.0 kB of blamed files exceeds the 1.0 kB limit"},
+			{Rule: "max_errors", Message: "3 image errors exceed the limit of 2"},
+		}
+		if len(v) != len(want) {
+			t.Fatalf("Violations = %v, want %v", v, want)
+		}
+		for i := range want {
+			if v[i] != want[i] {
+				t.Errorf("Violation %d = %+v, want %+v", i, v[i], want[i])
+			}
+		}
+	})
+
+	t.Run("Zero limits", func(t *testing.T) {
+		var none int64
+		p := &Policy{
+			MaxBlamedBytes: &none,
+			MaxErrors:      map[PackageError]int{SecretError: 0, VCSError: 0},
+			Budgets:        map[string]int64{"small": 0},
+		}
+		v := p.Check(r)
+		want := []Violation{
+			{Rule: "budget", Package: "small", Message: "small weighs 10 B, over its 0 B budget"},
+			{Rule: "max_blamed_bytes", Message: "2.0 kB of blamed files exceeds the 0 B limit"},
+			{Rule: "max_errors", Message: "1 secret errors exceed the limit of 0"},
+		}
+		if len(v) != len(want) {
+			t.Fatalf("Violations = %v, want %v", v, want)
+		}
+		for i := range want {
+			if v[i] != want[i] {
+				t.Errorf("Violation %d = %+v, want %+v", i, v[i], want[i])
+			}
+		}
+	})
+}
+
+func TestFormatViolations(t *testing.T) {
+	s := FormatViolations([]Violation{{Rule: "forbidden", Message: "leaky has 1 forbidden secret errors"}})
+	if !strings.Contains(s, "1 policy violations:\n  [forbidden] leaky has 1 forbidden secret errors") {
+		t.Errorf("Wrong summary: %s", s)
+	}
+}
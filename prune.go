@@ -0,0 +1,292 @@
+package npmblame
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gosuri/uitable"
+	"github.com/spf13/afero"
+)
+
+// PrunedMarkerFile marks the package folders modified by Prune
+const PrunedMarkerFile = ".npm-blame-pruned"
+
+// PruneOptions select the files removed by Prune
+type PruneOptions struct {
+	// Categories are the package errors whose files are removed
+	Categories []PackageError
+	// DryRun reports the files without removing them
+	DryRun bool
+	// Archive, when set, receives a tar archive of the removed files
+	// that Restore extracts back
+	Archive io.Writer
+}
+
+// PrunedFile is a file removed by Prune
+type PrunedFile struct {
+	Package string `json:"package"`
+	Version string `json:"version,omitempty"`
+	// Path is the file location relative to the scan root
+	Path   string         `json:"path"`
+	Size   int64          `json:"size"`
+	Errors []PackageError `json:"errors"`
+}
+
+// PruneReport is the undo manifest of a prune
+type PruneReport struct {
+	DryRun bool         `json:"dry_run"`
+	Files  []PrunedFile `json:"files"`
+	// Protected lists the matching files kept because the package
+	// manifest references them
+	Protected []string `json:"protected,omitempty"`
+}
+
+// Prune removes the blamed files of a scan result matching the selected
+// categories from the scanned root. Files referenced by the main, bin,
+// exports, types or typings fields of their package.json, and the
+// package.json itself, are never removed. Files already removed are
+// skipped, and pruned packages are marked with a PrunedMarkerFile.
+// The archive is closed on errors too, the files removed before them
+// being restorable.
+func Prune(fs afero.Fs, root string, r *Result, opts PruneOptions) (report *PruneReport, err error) {
+	report = &PruneReport{DryRun: opts.DryRun}
+	var archive *tar.Writer
+	if opts.Archive != nil && !opts.DryRun {
+		archive = tar.NewWriter(opts.Archive)
+		defer func() {
+			if closeErr := archive.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+	}
+
+	for _, i := range r.Instances {
+		dir := filepath.Join(root, filepath.FromSlash(i.Path))
+		var entries entryPoints
+		if m, err := ReadManifest(fs, dir); err == nil {
+			entries = newEntryPoints(m.EntryPoints())
+		}
+
+		pruned := false
+		for _, f := range i.Files {
+			if !matchCategories(f.Errors, opts.Categories) {
+				continue
+			}
+			p := path.Join(i.Path, f.Path)
+			if f.Path == "package.json" || entries.match(f.Path) {
+				report.Protected = append(report.Protected, p)
+				continue
+			}
+			if !opts.DryRun {
+				filePath := filepath.Join(dir, filepath.FromSlash(f.Path))
+				if _, err := fs.Stat(filePath); os.IsNotExist(err) {
+					// Already pruned
+					continue
+				}
+				if err := pruneFile(fs, filePath, p, archive); err != nil && !os.IsNotExist(err) {
+					return report, err
+				}
+				pruned = true
+			}
+			report.Files = append(report.Files, PrunedFile{
+				Package: i.Name, Version: i.Version, Path: p, Size: f.Size, Errors: f.Errors,
+			})
+		}
+		if pruned {
+			// The package no longer matches its integrity: the marker
+			// keys its cached blame on the folder instead
+			if err := afero.WriteFile(fs, filepath.Join(dir, PrunedMarkerFile), nil, 0644); err != nil {
+				return report, err
+			}
+			now := time.Now()
+			if err := fs.Chtimes(dir, now, now); err != nil {
+				return report, err
+			}
+		}
+	}
+	return report, nil
+}
+
+// pruneFile archives, when asked to, and removes a file
+func pruneFile(fs afero.Fs, filePath string, name string, archive *tar.Writer) error {
+	if archive != nil {
+		info, err := fs.Stat(filePath)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = strings.TrimPrefix(name, "/")
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		f, err := fs.Open(filePath)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(archive, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return fs.Remove(filePath)
+}
+
+func matchCategories(errors []PackageError, categories []PackageError) bool {
+	for _, err := range errors {
+		for _, c := range categories {
+			if err == c {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// entryPoints matches the files referenced by a package manifest
+type entryPoints struct {
+	paths    []string
+	patterns []*regexp.Regexp
+}
+
+func newEntryPoints(paths []string) entryPoints {
+	var e entryPoints
+	for _, p := range paths {
+		if !strings.Contains(p, "*") {
+			e.paths = append(e.paths, p)
+			continue
+		}
+		// Exports subpath patterns match across folders
+		if re, err := globRegexp(strings.Replace(p, "*", "**", -1)); err == nil {
+			e.patterns = append(e.patterns, re)
+		}
+	}
+	return e
+}
+
+// match reports whether a file is an entry point. Entry points may omit
+// their extension or name a folder containing an index file.
+func (e entryPoints) match(p string) bool {
+	for _, entry := range e.paths {
+		if p == entry || strings.TrimSuffix(p, path.Ext(p)) == entry ||
+			strings.HasPrefix(p, entry+"/index.") {
+			return true
+		}
+	}
+	for _, re := range e.patterns {
+		if re.MatchString(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reclaimed returns the bytes removed per package
+func (pr *PruneReport) Reclaimed() map[string]int64 {
+	reclaimed := make(map[string]int64)
+	for _, f := range pr.Files {
+		reclaimed[f.Package] += f.Size
+	}
+	return reclaimed
+}
+
+// WriteJSON writes the machine-readable representation of the PruneReport
+func (pr *PruneReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(pr)
+}
+
+// String returns the printable bytes reclaimed per package
+func (pr *PruneReport) String() string {
+	reclaimed := pr.Reclaimed()
+	files := make(map[string]int)
+	for _, f := range pr.Files {
+		files[f.Package]++
+	}
+	names := make([]string, 0, len(reclaimed))
+	for name := range reclaimed {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if reclaimed[names[i]] != reclaimed[names[j]] {
+			return reclaimed[names[i]] > reclaimed[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	buf := &bytes.Buffer{}
+	if pr.DryRun {
+		fmt.Fprint(buf, "DRY RUN: no file was removed.\n\n")
+	}
+	table := uitable.New()
+	table.MaxColWidth = 50
+	table.AddRow("PACKAGE", "FILES", "RECLAIMED")
+	var total int64
+	for _, name := range names {
+		table.AddRow(name, files[name], formatBytes(reclaimed[name]))
+		total += reclaimed[name]
+	}
+	table.AddRow("TOTAL", len(pr.Files), formatBytes(total))
+	fmt.Fprintln(buf, table)
+	if len(pr.Protected) > 0 {
+		fmt.Fprintf(buf, "\n%d files were kept as package entry points.\n", len(pr.Protected))
+	}
+	return buf.String()
+}
+
+// Restore extracts a prune archive back into the scanned root
+func Restore(fs afero.Fs, root string, archive io.Reader) (int, error) {
+	tr := tar.NewReader(archive)
+	restored := 0
+	now := time.Now()
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return restored, nil
+		}
+		if err != nil {
+			return restored, err
+		}
+		name := path.Clean("/" + header.Name)
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := fs.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return restored, err
+		}
+		f, err := fs.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode).Perm())
+		if err != nil {
+			return restored, err
+		}
+		_, err = io.Copy(f, tr)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return restored, err
+		}
+		restored++
+
+		// Invalidate the cached blame of the packages above the file
+		for dir := filepath.Dir(p); len(dir) > len(filepath.Clean(root)); dir = filepath.Dir(dir) {
+			if err := fs.Chtimes(dir, now, now); err != nil {
+				return restored, err
+			}
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package npmblame
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func pruneProject(t *testing.T) (afero.Fs, *Result) {
+	fs := afero.NewMemMapFs()
+	for p, data := range map[string]string{
+		"/nm/a/package.json":       `{"name": "a", "version": "1.0.0", "main": "test/index", "bin": {"a": "./bench/cli.js"}}`,
+		"/nm/a/test/index.js":      "module.exports = 1",
+		"/nm/a/test/a.spec.js":     "spec",
+		"/nm/a/bench/cli.js":       "cli",
+		"/nm/a/bench/run.js":       "run",
+		"/nm/a/logo.png":           "png",
+		"/nm/b/package.json":       `{"name": "b", "version": "2.0.0", "exports": {"./fixtures/*": "./test/fixtures/*.js"}}`,
+		"/nm/b/test/fixtures/x.js": "fixture",
+		"/nm/b/test/b.spec.js":     "spec spec",
+	} {
+		afero.WriteFile(fs, p, []byte(data), 0644)
+	}
+	r, err := NewScanner(fs, "/nm", DefaultScanOptions()).Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs, r
+}
+
+func TestPruneDryRun(t *testing.T) {
+	fs, r := pruneProject(t)
+	report, err := Prune(fs, "/nm", r, PruneOptions{Categories: []PackageError{TestError, BenchError}, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pruned []string
+	for _, f := range report.Files {
+		pruned = append(pruned, f.Path)
+	}
+	want := "/a/bench/run.js /a/test/a.spec.js /b/test/b.spec.js"
+	if strings.Join(pruned, " ") != want {
+		t.Errorf("Pruned %v, want %s", pruned, want)
+	}
+	if got := strings.Join(report.Protected, " "); got != "/a/bench/cli.js /a/test/index.js /b/test/fixtures/x.js" {
+		t.Errorf("Wrong protected files: %s", got)
+	}
+	if ok, _ := afero.Exists(fs, "/nm/a/test/a.spec.js"); !ok {
+		t.Error("A dry run should not remove files")
+	}
+	if reclaimed := report.Reclaimed(); reclaimed["a"] != 7 || reclaimed["b"] != 9 {
+		t.Errorf("Wrong reclaimed bytes: %v", reclaimed)
+	}
+	if s := report.String(); !strings.HasPrefix(s, "DRY RUN") || !strings.Contains(s, "3 files were kept") {
+		t.Errorf("Wrong report:\n%s", s)
+	}
+}
+
+func TestPruneAndRestore(t *testing.T) {
+	fs, r := pruneProject(t)
+	archive := &bytes.Buffer{}
+	report, err := Prune(fs, "/nm", r, PruneOptions{Categories: []PackageError{ImageError, TestError}, Archive: archive})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Files) != 3 {
+		t.Fatalf("Expected 3 pruned files got %+v", report.Files)
+	}
+	for _, p := range []string{"/nm/a/logo.png", "/nm/a/test/a.spec.js", "/nm/b/test/b.spec.js"} {
+		if ok, _ := afero.Exists(fs, p); ok {
+			t.Errorf("%s should be removed", p)
+		}
+	}
+	if ok, _ := afero.Exists(fs, "/nm/a/test/index.js"); !ok {
+		t.Error("The main file should be kept")
+	}
+
+	restored, err := Restore(fs, "/nm", archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored != 3 {
+		t.Errorf("Expected 3 restored files got %d", restored)
+	}
+	if data, _ := afero.ReadFile(fs, "/nm/b/test/b.spec.js"); string(data) != "spec spec" {
+		t.Errorf("Wrong restored content %q", data)
+	}
+}
+
+// removeErrorFs fails to remove one file
+type removeErrorFs struct {
+	afero.Fs
+	path string
+}
+
+func (fs removeErrorFs) Remove(name string) error {
+	if name == fs.path {
+		return os.ErrPermission
+	}
+	return fs.Fs.Remove(name)
+}
+
+func TestPruneError(t *testing.T) {
+	fs, r := pruneProject(t)
+	archive := &bytes.Buffer{}
+	failing := removeErrorFs{Fs: fs, path: "/nm/b/test/b.spec.js"}
+	if _, err := Prune(failing, "/nm", r, PruneOptions{Categories: []PackageError{ImageError, TestError}, Archive: archive}); err == nil {
+		t.Fatal("Expected the remove error")
+	}
+	if !bytes.HasSuffix(archive.Bytes(), make([]byte, 1024)) {
+		t.Error("The archive should end with its trailer")
+	}
+	// The files removed before the error are restored from the archive
+	if _, err := Restore(fs, "/nm", archive); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"/nm/a/logo.png", "/nm/a/test/a.spec.js", "/nm/b/test/b.spec.js"} {
+		if ok, _ := afero.Exists(fs, p); !ok {
+			t.Errorf("%s should be restored", p)
+		}
+	}
+}
+
+func TestPrunePackageNames(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	for p, data := range map[string]string{
+		"/nm/test-exclude/package.json":   `{"name": "test-exclude", "version": "1.0.0"}`,
+		"/nm/test-exclude/index.js":       "main",
+		"/nm/test-exclude/lib/util.js":    "util",
+		"/nm/test-exclude/test/a.spec.js": "spec",
+	} {
+		afero.WriteFile(fs, p, []byte(data), 0644)
+	}
+	r, err := NewScanner(fs, "/nm", DefaultScanOptions()).Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := Prune(fs, "/nm", r, PruneOptions{Categories: []PackageError{TestError}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Files) != 1 || report.Files[0].Path != "/test-exclude/test/a.spec.js" {
+		t.Errorf("Expected only the test file to be pruned, got %+v", report.Files)
+	}
+	for _, p := range []string{"/nm/test-exclude/index.js", "/nm/test-exclude/lib/util.js"} {
+		if ok, _ := afero.Exists(fs, p); !ok {
+			t.Errorf("%s should be kept", p)
+		}
+	}
+}
+
+func TestPruneCache(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	manifest := `{"name": "a", "version": "1.0.0", "_integrity": "sha512-a"}`
+	for _, dir := range []string{"/nm/a", "/nm/b/node_modules/a"} {
+		afero.WriteFile(fs, dir+"/package.json", []byte(manifest), 0644)
+		afero.WriteFile(fs, dir+"/test/a.spec.js", []byte("spec"), 0644)
+	}
+	afero.WriteFile(fs, "/nm/b/package.json", []byte(`{"name": "b", "version": "1.0.0"}`), 0644)
+	cache, _ := OpenCache(afero.NewMemMapFs(), "/cache.json")
+	opts := DefaultScanOptions()
+	opts.Cache = cache
+	scan := func() *Result {
+		r, err := NewScanner(fs, "/nm", opts).Scan()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	// Only the top level copy is pruned
+	r := scan()
+	r.Instances = r.Instances[:1]
+	if _, err := Prune(fs, "/nm", r, PruneOptions{Categories: []PackageError{TestError}}); err != nil {
+		t.Fatal(err)
+	}
+	// Files removed since the scan are already pruned
+	if report, err := Prune(fs, "/nm", r, PruneOptions{Categories: []PackageError{TestError}}); err != nil || len(report.Files) != 0 {
+		t.Errorf("Expected nothing to prune got %+v %v", report, err)
+	}
+
+	r = scan()
+	for _, i := range r.Instances {
+		if i.Name != "a" {
+			continue
+		}
+		if pruned := i.Path == "/a"; pruned != (len(i.Files) == 0) {
+			t.Errorf("Wrong blamed files of %s: %+v", i.Path, i.Files)
+		}
+	}
+	if report, err := Prune(fs, "/nm", r, PruneOptions{Categories: []PackageError{TestError}}); err != nil || len(report.Files) != 1 {
+		t.Errorf("Expected the nested copy to be pruned got %+v %v", report, err)
+	}
+}
@@ -0,0 +1,359 @@
+package npmblame
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// DefaultRegistry is the public npm registry
+const DefaultRegistry = "https://registry.npmjs.org/"
+
+// Registry is an npm registry client
+type Registry struct {
+	// URL is the registry of the packages without scoped registry
+	URL string
+	// Scopes are the registries of package scopes, such as "@org"
+	Scopes map[string]string
+	// Auth are the Authorization headers by registry URL without scheme,
+	// such as "//registry.npmjs.org/", sent to the URLs they prefix
+	Auth map[string]string
+	// HTTPClient is used by the registry, http.DefaultClient by default
+	HTTPClient *http.Client
+}
+
+// NewRegistry returns an anonymous client of a registry URL
+func NewRegistry(u string) *Registry {
+	return &Registry{URL: u, Scopes: make(map[string]string), Auth: make(map[string]string)}
+}
+
+// LoadRegistry returns the registry client configured by the user and
+// project .npmrc files, the project one taking precedence. The user file
+// is $NPM_CONFIG_USERCONFIG or ~/.npmrc, and $NPM_CONFIG_REGISTRY
+// overrides the registry URL. ${VAR} references are expanded.
+func LoadRegistry(fs afero.Fs, project string) (*Registry, error) {
+	// Without home folder only the project file is read
+	home, _ := os.UserHomeDir()
+	return loadRegistry(fs, project, os.Getenv, home)
+}
+
+func loadRegistry(fs afero.Fs, project string, getenv func(string) string, home string) (*Registry, error) {
+	r := NewRegistry(DefaultRegistry)
+	user := getenv("NPM_CONFIG_USERCONFIG")
+	if user == "" && home != "" {
+		user = filepath.Join(home, ".npmrc")
+	}
+	files := []string{user}
+	if project != "" {
+		files = append(files, filepath.Join(project, ".npmrc"))
+	}
+	for _, p := range files {
+		if p == "" {
+			continue
+		}
+		if err := r.readNpmrc(fs, p, getenv); err != nil {
+			return nil, err
+		}
+	}
+	if u := getenv("NPM_CONFIG_REGISTRY"); u != "" {
+		r.URL = u
+	}
+	return r, nil
+}
+
+// readNpmrc reads the registries and credentials of a .npmrc file.
+// Missing files are ignored.
+func (r *Registry) readNpmrc(fs afero.Fs, p string, getenv func(string) string) error {
+	data, err := afero.ReadFile(fs, p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// username and _password come in pairs
+	users := make(map[string]string)
+	passwords := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(parts[0])
+		value := strings.Trim(strings.TrimSpace(os.Expand(strings.TrimSpace(parts[1]), getenv)), `"`)
+
+		prefix, setting := "", key
+		if strings.HasPrefix(key, "//") {
+			i := strings.LastIndex(key, ":")
+			if i == -1 {
+				continue
+			}
+			prefix, setting = key[:i], key[i+1:]
+		}
+		switch {
+		case setting == "registry" && prefix == "":
+			r.URL = value
+		case strings.HasPrefix(setting, "@") && strings.HasSuffix(setting, ":registry"):
+			r.Scopes[strings.TrimSuffix(setting, ":registry")] = value
+		case setting == "_authToken":
+			r.Auth[authPrefix(prefix, r.URL)] = "Bearer " + value
+		case setting == "_auth":
+			r.Auth[authPrefix(prefix, r.URL)] = "Basic " + value
+		case setting == "username":
+			users[authPrefix(prefix, r.URL)] = value
+		case setting == "_password":
+			passwords[authPrefix(prefix, r.URL)] = value
+		}
+	}
+	for prefix, user := range users {
+		// Passwords are base64 encoded in .npmrc
+		password, err := base64.StdEncoding.DecodeString(passwords[prefix])
+		if err != nil {
+			return fmt.Errorf("invalid _password for %s in %s: %v", prefix, p, err)
+		}
+		r.Auth[prefix] = "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+string(password)))
+	}
+	return scanner.Err()
+}
+
+// authPrefix returns the URL prefix of a credential, the registry URL for
+// the legacy credentials without prefix
+func authPrefix(prefix, registry string) string {
+	if prefix == "" {
+		prefix = registry
+		if i := strings.Index(registry, ":"); i != -1 {
+			prefix = registry[i+1:]
+		}
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix
+}
+
+// authorization returns the Authorization header of a URL, matching the
+// longest credential prefix
+func (r *Registry) authorization(u string) string {
+	parts := strings.SplitN(u, ":", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	var match, header string
+	for prefix, h := range r.Auth {
+		if strings.HasPrefix(parts[1], prefix) && len(prefix) > len(match) {
+			match, header = prefix, h
+		}
+	}
+	return header
+}
+
+// PackageVersion is a published version of a packument
+type PackageVersion struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Deprecated is the deprecation message of the version
+	Deprecated  string       `json:"deprecated,omitempty"`
+	Maintainers []Maintainer `json:"maintainers,omitempty"`
+	Dist        struct {
+		Tarball   string `json:"tarball"`
+		Integrity string `json:"integrity,omitempty"`
+		// UnpackedSize is the size of the tarball files, when known
+		UnpackedSize int64 `json:"unpackedSize,omitempty"`
+	} `json:"dist"`
+}
+
+// Packument is the registry document of a package
+type Packument struct {
+	Name     string                     `json:"name"`
+	DistTags map[string]string          `json:"dist-tags"`
+	Versions map[string]*PackageVersion `json:"versions"`
+	// Maintainers are the current maintainers of the package
+	Maintainers []Maintainer `json:"maintainers,omitempty"`
+	// Time are the publish times by version, along with the created and
+	// modified times of the package
+	Time PublishTimes `json:"time,omitempty"`
+}
+
+// PublishTimes are the times of a packument
+type PublishTimes map[string]time.Time
+
+// UnmarshalJSON decodes the times, skipping the other values such as the
+// unpublished object of unpublished packages
+func (t *PublishTimes) UnmarshalJSON(data []byte) error {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	*t = make(PublishTimes)
+	for k, v := range values {
+		var tm time.Time
+		if err := json.Unmarshal(v, &tm); err == nil {
+			(*t)[k] = tm
+		}
+	}
+	return nil
+}
+
+// Maintainer is a maintainer of a package
+type Maintainer struct {
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
+}
+
+// UnmarshalJSON decodes a maintainer object or, as in old packuments, a
+// "name <email>" string
+func (m *Maintainer) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		parts := strings.SplitN(s, "<", 2)
+		m.Name = strings.TrimSpace(parts[0])
+		if len(parts) == 2 {
+			m.Email = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(parts[1]), ">"))
+		}
+		return nil
+	}
+	type maintainer Maintainer
+	return json.Unmarshal(data, (*maintainer)(m))
+}
+
+// registryURL returns the registry of a package
+func (r *Registry) registryURL(name string) string {
+	u := r.URL
+	if strings.HasPrefix(name, "@") {
+		if scoped, ok := r.Scopes[strings.SplitN(name, "/", 2)[0]]; ok {
+			u = scoped
+		}
+	}
+	if !strings.HasSuffix(u, "/") {
+		u += "/"
+	}
+	return u
+}
+
+// Packument fetches the registry document of a package
+func (r *Registry) Packument(name string) (*Packument, error) {
+	// The slash of scoped names is escaped
+	u := r.registryURL(name) + url.PathEscape(name)
+	data, err := r.get(u)
+	if err != nil {
+		return nil, err
+	}
+	p := new(Packument)
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("invalid packument of %s: %v", name, err)
+	}
+	return p, nil
+}
+
+// get returns the body of a registry URL
+func (r *Registry) get(u string) ([]byte, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	headers := make(map[string]string)
+	if auth := r.authorization(u); auth != "" {
+		headers["Authorization"] = auth
+	}
+	return doRequest(r.HTTPClient, req, headers)
+}
+
+// BlameTarball downloads the tarball of a package version and blames its
+// files with the same rules as installed packages
+func (r *Registry) BlameTarball(v *PackageVersion) (*Instance, error) {
+	if v.Dist.Tarball == "" {
+		return nil, fmt.Errorf("%s@%s has no tarball", v.Name, v.Version)
+	}
+	data, err := r.get(v.Dist.Tarball)
+	if err != nil {
+		return nil, err
+	}
+	fs := afero.NewMemMapFs()
+	dir := path.Join("/node_modules", v.Name)
+	if err := extractTarball(fs, dir, bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("invalid tarball of %s@%s: %v", v.Name, v.Version, err)
+	}
+
+	result, err := NewScanner(fs, "/node_modules", ScanOptions{Workers: 1, Strict: true}).Scan()
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range result.Instances {
+		if i.Path == "/"+v.Name {
+			// Tarballs may lack their package.json version
+			i.Version = v.Version
+			return i, nil
+		}
+	}
+	return nil, fmt.Errorf("empty tarball of %s@%s", v.Name, v.Version)
+}
+
+// extractTarball extracts a gzipped package tarball in a folder, the top
+// level folder of its entries, usually package/, being dropped
+func extractTarball(fs afero.Fs, dir string, r io.Reader) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	if err := fs.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg && h.Typeflag != tar.TypeRegA {
+			continue
+		}
+		parts := strings.SplitN(path.Clean("/"+h.Name), "/", 3)
+		if len(parts) < 3 {
+			continue
+		}
+		p := path.Join(dir, parts[2])
+		if err := fs.MkdirAll(path.Dir(p), 0755); err != nil {
+			return err
+		}
+		f, err := fs.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(h.Mode)&os.ModePerm)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, tr)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		// Some file systems ignore the permissions of OpenFile, the
+		// executable bit being blamed
+		if err := fs.Chmod(p, os.FileMode(h.Mode)&os.ModePerm); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package npmblame
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// testTarball returns a gzipped package tarball of files by path, the
+// executable ones ending with .sh
+func testTarball(files map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	for p, content := range files {
+		mode := int64(0644)
+		if len(p) > 3 && p[len(p)-3:] == ".sh" {
+			mode = 0755
+		}
+		tw.WriteHeader(&tar.Header{Name: "package/" + p, Mode: mode, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+// registryServer is a registry stand-in serving packuments by escaped
+// name and tarballs by path, requiring a token when set
+func registryServer(t *testing.T, token string, packuments map[string]string, tarballs map[string][]byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && r.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, `{"error": "unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		if tarball, ok := tarballs[r.URL.Path]; ok {
+			w.Write(tarball)
+			return
+		}
+		if p, ok := packuments[r.URL.EscapedPath()]; ok {
+			fmt.Fprint(w, p)
+			return
+		}
+		http.Error(w, `{"error": "Not found"}`, http.StatusNotFound)
+	}))
+}
+
+func TestLoadRegistry(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	password := base64.StdEncoding.EncodeToString([]byte("secret"))
+	afero.WriteFile(fs, "/home/.npmrc", []byte(`; User settings
+registry=https://registry.example.com/npm/
+//registry.example.com/npm/:_authToken=${NPM_TOKEN}
+@org:registry=https://npm.org.example.com
+//npm.org.example.com/:username=me
+//npm.org.example.com/:_password="`+password+`"
+`), 0644)
+	afero.WriteFile(fs, "/project/.npmrc", []byte("# Project settings\n@local:registry=http://localhost:4873/\n"), 0644)
+
+	env := map[string]string{"NPM_TOKEN": "token"}
+	r, err := loadRegistry(fs, "/project", func(k string) string { return env[k] }, "/home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.URL != "https://registry.example.com/npm/" || r.Scopes["@org"] != "https://npm.org.example.com" || r.Scopes["@local"] != "http://localhost:4873/" {
+		t.Errorf("Wrong registries %+v", r)
+	}
+	for _, tc := range []struct {
+		url  string
+		auth string
+	}{
+		{"https://registry.example.com/npm/pkg", "Bearer token"},
+		{"https://registry.example.com/npm/pkg/-/pkg-1.0.0.tgz", "Bearer token"},
+		{"https://registry.example.com/other/pkg", ""},
+		{"https://npm.org.example.com/@org%2fpkg", "Basic " + base64.StdEncoding.EncodeToString([]byte("me:secret"))},
+	} {
+		if auth := r.authorization(tc.url); auth != tc.auth {
+			t.Errorf("%s: expected %q got %q", tc.url, tc.auth, auth)
+		}
+	}
+	if u := r.registryURL("@org/pkg"); u != "https://npm.org.example.com/" {
+		t.Errorf("Wrong scoped registry %s", u)
+	}
+
+	env["NPM_CONFIG_REGISTRY"] = "http://localhost:8080"
+	env["NPM_CONFIG_USERCONFIG"] = "/missing"
+	if r, _ := loadRegistry(fs, "/project", func(k string) string { return env[k] }, "/home"); r.URL != "http://localhost:8080" || len(r.Auth) != 0 {
+		t.Errorf("Expected the environment registry without credentials got %+v", r)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	var server *httptest.Server
+	server = registryServer(t, "token", map[string]string{
+		"/@org%2Fpkg": `{"name": "@org/pkg", "dist-tags": {"latest": "1.0.0"}, "versions": {"1.0.0": {"name": "@org/pkg", "version": "1.0.0", "dist": {"tarball": "TARBALL"}}}}`,
+	}, map[string][]byte{
+		"/@org/pkg/-/pkg-1.0.0.tgz": testTarball(map[string]string{
+			"package.json":  `{"name": "@org/pkg", "version": "1.0.0"}`,
+			"index.js":      "module.exports = 1",
+			"test/index.js": "test()",
+			"build.sh":      "make",
+		}),
+	})
+	defer server.Close()
+
+	r := NewRegistry(server.URL)
+	if _, err := r.Packument("@org/pkg"); err == nil {
+		t.Error("Expected an authentication error")
+	}
+	r.Auth[authPrefix("", server.URL)] = "Bearer token"
+	p, err := r.Packument("@org/pkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.DistTags["latest"] != "1.0.0" || p.Versions["1.0.0"] == nil {
+		t.Fatalf("Wrong packument %+v", p)
+	}
+	if _, err := r.Packument("missing"); err == nil {
+		t.Error("Expected a not found error")
+	}
+
+	v := p.Versions["1.0.0"]
+	v.Dist.Tarball = server.URL + "/@org/pkg/-/pkg-1.0.0.tgz"
+	i, err := r.BlameTarball(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.Name != "@org/pkg" || i.Version != "1.0.0" || i.Errors[TestError] != 2 || i.Errors[ExecError] != 1 || i.BlamedBytes() != 10 {
+		t.Errorf("Wrong blame %+v", i)
+	}
+}
@@ -1,7 +1,9 @@
 package npmblame
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/google/go-github/github"
 	"golang.org/x/oauth2"
@@ -20,6 +22,51 @@ type Report struct {
 	Repository string
 	Errors     []int
 	Solutions  []int
+	// Directory is the package folder of a monorepo repository
+	Directory string
+	Labels    []string
+	// Milestone is the title of an open milestone of the repository
+	Milestone string
+	Assignees []string
+	// Marker is appended to the body of the created issue
+	Marker *ReportMarker
+}
+
+// ReportMarker identifies the issues created by npm-blame. It is hidden
+// in an HTML comment ending their body.
+type ReportMarker struct {
+	// NpmBlameVersion is the version of npm-blame creating the issue
+	NpmBlameVersion string `json:"npm_blame"`
+	Package         string `json:"package"`
+	// Version is the scanned version of the package
+	Version string `json:"version"`
+}
+
+const markerPrefix = "<!-- npm-blame "
+
+// String returns the HTML comment of the marker
+func (m *ReportMarker) String() string {
+	data, _ := json.Marshal(m)
+	return markerPrefix + string(data) + " -->"
+}
+
+// ParseReportMarker returns the marker of an issue body, or nil for the
+// issues not created by npm-blame
+func ParseReportMarker(body string) *ReportMarker {
+	start := strings.LastIndex(body, markerPrefix)
+	if start == -1 {
+		return nil
+	}
+	rest := body[start+len(markerPrefix):]
+	end := strings.Index(rest, " -->")
+	if end == -1 {
+		return nil
+	}
+	m := new(ReportMarker)
+	if err := json.Unmarshal([]byte(rest[:end]), m); err != nil {
+		return nil
+	}
+	return m
 }
 
 // NewReport returns a new issue report
@@ -44,15 +91,48 @@ func DefaultClient(authToken string) *github.Client {
 	return client
 }
 
-// Send sends a report to the appropriate npm package issue tracker
-func (r *Report) Send(client *github.Client) (issue *github.Issue, err error) {
-	if client == nil {
-		return nil, fmt.Errorf("No client passed.")
+// Send sends a report to the npm package issue tracker, with its marker
+// ending the issue body. The issue of a previous send carrying the same
+// marker, such as one created by a send which failed past the request,
+// is updated instead of creating another.
+func (r *Report) Send(tracker Tracker) (*Issue, error) {
+	if tracker == nil {
+		return nil, fmt.Errorf("No tracker passed.")
 	}
-
-	issue, _, err = client.Issues.Create(r.Owner, r.Repository, &github.IssueRequest{
-		Title: &r.Title,
-		Body:  &r.Body,
+	body := r.Body
+	if r.Marker != nil {
+		body = strings.TrimRight(body, "\n") + "\n\n" + r.Marker.String()
+		issue, err := r.sentIssue(tracker)
+		if err != nil {
+			return nil, err
+		}
+		if issue != nil {
+			return issue, tracker.UpdateIssue(r.Owner, r.Repository, issue.Number, r.Title, body)
+		}
+	}
+	return tracker.CreateIssue(r.Owner, r.Repository, &NewIssue{
+		Title:     r.Title,
+		Body:      body,
+		Labels:    r.Labels,
+		Milestone: r.Milestone,
+		Assignees: r.Assignees,
 	})
-	return issue, err
+}
+
+// sentIssue returns the own issue whose marker names the reported
+// package version, nil when there is none. Issues are listed rather than
+// searched, the search indexes lagging behind the created issues.
+func (r *Report) sentIssue(tracker Tracker) (*Issue, error) {
+	found, err := tracker.OwnIssues(r.Owner, r.Repository, r.Labels)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range found {
+		m := ParseReportMarker(f.Body)
+		if m != nil && m.Package == r.Marker.Package && m.Version == r.Marker.Version {
+			issue := f.Issue
+			return &issue, nil
+		}
+	}
+	return nil, nil
 }
@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/google/go-github/github"
@@ -62,7 +63,7 @@ func TestSend(t *testing.T) {
 		if !reflect.DeepEqual(ir, expected) {
 			t.Errorf("Request body = %+v, want %+v", ir, expected)
 		}
-		fmt.Fprint(w, `{"number":1}`)
+		fmt.Fprint(w, `{"number":1,"html_url":"https://github.com/npm-blame/test/issues/1"}`)
 	})
 
 	r := NewReport("npm-blame", "test", errors)
@@ -70,18 +71,93 @@ func TestSend(t *testing.T) {
 	t.Run("Default client", func(t *testing.T) {
 		_, err := r.Send(nil)
 		if err == nil {
-			t.Error("Send should require a client")
+			t.Error("Send should require a tracker")
 		}
 	})
 
 	t.Run("Test Client", func(t *testing.T) {
-		issue, err := r.Send(client)
+		issue, err := r.Send(NewGitHubTracker(client))
 		if err != nil {
 			t.Error(err)
 		}
-		want := &github.Issue{Number: Int(1)}
+		want := &Issue{Number: 1, URL: "https://github.com/npm-blame/test/issues/1"}
 		if !reflect.DeepEqual(issue, want) {
 			t.Errorf("Issues.Create returned %+v, want %+v", issue, want)
 		}
 	})
 }
+
+func TestSendMetadata(t *testing.T) {
+	r := packageReport(t, templateInstance(), &Repository{Host: "github.com", Owner: "owner", Name: "pkg"})
+	r.Labels, r.Milestone, r.Assignees = []string{"npm-blame"}, "v2", []string{"me"}
+	tracker := &fakeTracker{}
+	if _, err := r.Send(tracker); err != nil {
+		t.Fatal(err)
+	}
+	issue := tracker.issues[0]
+	if issue.Title != r.Title || !reflect.DeepEqual(issue.Labels, r.Labels) || issue.Milestone != "v2" || !reflect.DeepEqual(issue.Assignees, r.Assignees) {
+		t.Errorf("Wrong issue %+v", issue)
+	}
+	expected := r.Body + "\n\n<!-- npm-blame {\"npm_blame\":\"" + Version + "\",\"package\":\"pkg\",\"version\":\"1.2.3\"} -->"
+	if issue.Body != expected {
+		t.Errorf("Expected the marker to end the body got %q", issue.Body)
+	}
+	if m := ParseReportMarker(issue.Body); m == nil || *m != *r.Marker {
+		t.Errorf("Expected %+v got %+v", r.Marker, m)
+	}
+
+	// Sending again updates the issue of the marker
+	r.Title = "Updated"
+	sent, err := r.Send(tracker)
+	if err != nil || len(tracker.issues) != 1 || sent.Number != 1 || sent.URL != "https://github.com/owner/pkg/issues/1" {
+		t.Errorf("Expected the sent issue got %+v %v, %d issues", sent, err, len(tracker.issues))
+	}
+	if len(tracker.updated) != 1 || tracker.issues[0].Title != "Updated" || tracker.issues[0].Body != expected {
+		t.Errorf("Expected the issue to be updated got %+v", tracker.issues[0])
+	}
+	r.Marker.Version = "2.0.0"
+	if sent, err := r.Send(tracker); err != nil || len(tracker.issues) != 2 || sent.Number != 2 {
+		t.Errorf("Expected a new issue for another version got %+v %v", sent, err)
+	}
+}
+
+func TestParseReportMarker(t *testing.T) {
+	for _, body := range []string{
+		"No marker",
+		"<!-- npm-blame not json -->",
+		"<!-- npm-blame {\"package\":\"pkg\"}",
+	} {
+		if m := ParseReportMarker(body); m != nil {
+			t.Errorf("%q: expected no marker got %+v", body, m)
+		}
+	}
+	// The last marker wins, quoted issues keeping theirs
+	body := "> <!-- npm-blame {\"package\":\"old\"} -->\n\n<!-- npm-blame {\"npm_blame\":\"1.0.0\",\"package\":\"pkg\",\"version\":\"2.0.0\"} -->"
+	if m := ParseReportMarker(body); m == nil || m.Package != "pkg" || m.Version != "2.0.0" || m.NpmBlameVersion != "1.0.0" {
+		t.Errorf("Wrong marker %+v", m)
+	}
+}
+
+// packageReport returns the report of a blamed package, sent to its
+// repository, rendered by the default report template
+func packageReport(t *testing.T, i *Instance, repo *Repository) *Report {
+	r, err := DefaultReportTemplate().Render(i, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestPackageReport(t *testing.T) {
+	i := &Instance{Name: "pkg", Version: "1.0.0", Size: 10, Errors: map[PackageError]int{TestError: 1}, Files: []BlamedFile{{Path: "test.js", Size: 4, Errors: []PackageError{TestError}}}}
+	r := packageReport(t, i, &Repository{Host: "github.com", Owner: "owner", Name: "mono", Directory: "packages/pkg"})
+	if r.Owner != "owner" || r.Repository != "mono" || r.Directory != "packages/pkg" {
+		t.Errorf("Wrong report target %+v", r)
+	}
+	if r.Title != "pkg: the published package includes 4 B of development files" {
+		t.Errorf("Wrong title %q", r.Title)
+	}
+	if !strings.Contains(r.Body, "### Tests: 1 file, 4 B") {
+		t.Errorf("Wrong body %q", r.Body)
+	}
+}
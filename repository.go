@@ -0,0 +1,199 @@
+package npmblame
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Repository is the source repository of a package
+type Repository struct {
+	Host  string `json:"host"`
+	Owner string `json:"owner"`
+	Name  string `json:"name"`
+	// Directory is the package folder of a monorepo
+	Directory string `json:"directory,omitempty"`
+}
+
+// String returns the host/owner/name of the repository
+func (r *Repository) String() string {
+	return r.Host + "/" + r.Owner + "/" + r.Name
+}
+
+// URL returns the web URL of the repository
+func (r *Repository) URL() string {
+	return "https://" + r.String()
+}
+
+// shorthandHosts are the hosts of the npm repository shorthands
+var shorthandHosts = map[string]string{
+	"github":    "github.com",
+	"gitlab":    "gitlab.com",
+	"bitbucket": "bitbucket.org",
+}
+
+// ParseRepository parses the repository of a package.json, given in any
+// of the formats npm accepts: github:, gitlab: and bitbucket: shorthands,
+// bare user/repo GitHub shorthands, git, git+https, git+ssh, scp-like
+// and web URLs, including tree and issues URLs.
+func ParseRepository(s string) (*Repository, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, fmt.Errorf("empty repository")
+	}
+	raw := s
+	if i := strings.Index(s, "#"); i != -1 {
+		// Committish
+		s = s[:i]
+	}
+
+	var host, p string
+	switch {
+	case strings.Contains(s, "://"):
+		u, err := url.Parse(strings.TrimPrefix(s, "git+"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid repository %q: %v", raw, err)
+		}
+		host, p = u.Hostname(), u.Path
+	case isScpLike(s):
+		// git@github.com:user/repo.git
+		at := strings.Index(s, "@")
+		colon := strings.Index(s, ":")
+		host, p = s[at+1:colon], s[colon+1:]
+	case strings.Contains(s, ":"):
+		i := strings.Index(s, ":")
+		shorthand, ok := shorthandHosts[s[:i]]
+		if !ok {
+			return nil, fmt.Errorf("unsupported repository %q", raw)
+		}
+		host, p = shorthand, s[i+1:]
+	default:
+		parts := strings.SplitN(s, "/", 2)
+		if strings.Contains(parts[0], ".") && len(parts) == 2 {
+			// github.com/user/repo
+			host, p = parts[0], parts[1]
+		} else {
+			host, p = "github.com", s
+		}
+	}
+	host = strings.ToLower(strings.TrimPrefix(host, "www."))
+	if host == "" {
+		return nil, fmt.Errorf("no host in repository %q", raw)
+	}
+
+	segments, directory := repositoryPath(strings.Trim(p, "/"))
+	if len(segments) < 2 {
+		return nil, fmt.Errorf("no owner and name in repository %q", raw)
+	}
+	// GitLab groups may nest, the other hosts use owner/name only
+	if host != "gitlab.com" && len(segments) > 2 {
+		segments = segments[:2]
+	}
+	n := len(segments) - 1
+	return &Repository{
+		Host:      host,
+		Owner:     strings.Join(segments[:n], "/"),
+		Name:      strings.TrimSuffix(segments[n], ".git"),
+		Directory: directory,
+	}, nil
+}
+
+// isScpLike reports whether s is a user@host:path git location
+func isScpLike(s string) bool {
+	at := strings.Index(s, "@")
+	colon := strings.Index(s, ":")
+	return at > 0 && colon > at
+}
+
+// repositoryPath splits a repository path into its segments, removing
+// the web pages following them and returning the tree folder they show
+func repositoryPath(p string) ([]string, string) {
+	var segments []string
+	for _, s := range strings.Split(p, "/") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	for i, s := range segments {
+		if i < 2 {
+			continue
+		}
+		switch s {
+		case "-":
+			// GitLab pages: group/repo/-/tree/main/dir
+			rest := segments[i+1:]
+			if len(rest) > 2 && rest[0] == "tree" {
+				return segments[:i], path.Join(rest[2:]...)
+			}
+			return segments[:i], ""
+		case "tree", "src":
+			// GitHub and Bitbucket folders: user/repo/tree/main/dir
+			rest := segments[i+1:]
+			if len(rest) > 1 {
+				return segments[:i], path.Join(rest[1:]...)
+			}
+			return segments[:i], ""
+		case "issues", "blob", "wiki", "pulls", "issue", "merge_requests":
+			return segments[:i], ""
+		}
+	}
+	return segments, ""
+}
+
+// SourceRepository returns the repository of the manifest, keeping the
+// directory of monorepo packages
+func (m *Manifest) SourceRepository() (*Repository, error) {
+	var s, directory string
+	switch r := m.Repository.(type) {
+	case string:
+		s = r
+	case map[string]interface{}:
+		s, _ = r["url"].(string)
+		directory, _ = r["directory"].(string)
+	case nil:
+		return nil, fmt.Errorf("no repository field")
+	}
+	repo, err := ParseRepository(s)
+	if err != nil {
+		return nil, err
+	}
+	if directory != "" {
+		repo.Directory = path.Clean(strings.TrimPrefix(directory, "./"))
+	}
+	return repo, nil
+}
+
+// BugsURL returns the URL of the bugs field of the manifest
+func (m *Manifest) BugsURL() string {
+	switch b := m.Bugs.(type) {
+	case string:
+		return b
+	case map[string]interface{}:
+		u, _ := b["url"].(string)
+		return u
+	}
+	return ""
+}
+
+// NoTrackerError is returned for packages without a supported tracker
+type NoTrackerError struct {
+	Package string
+	// Reasons explain why each repository location was rejected
+	Reasons []string
+}
+
+func (e *NoTrackerError) Error() string {
+	return fmt.Sprintf("%s has no reachable tracker: %s", e.Package, strings.Join(e.Reasons, ", "))
+}
+
+// TrackerForManifest returns the tracker of a package and its repository.
+// The repository field is tried first, then the bugs URL. A
+// *NoTrackerError is returned when neither leads to a supported tracker.
+func TrackerForManifest(m *Manifest, opts TrackerOptions) (Tracker, *Repository, error) {
+	t, err := reportTarget(m, opts, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return t.Tracker, t.Repository, nil
+}
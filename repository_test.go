@@ -0,0 +1,107 @@
+package npmblame
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseRepository(t *testing.T) {
+	for _, tc := range []struct {
+		in       string
+		expected Repository
+	}{
+		{"user/repo", Repository{"github.com", "user", "repo", ""}},
+		{"github:user/repo", Repository{"github.com", "user", "repo", ""}},
+		{"gitlab:group/sub/repo", Repository{"gitlab.com", "group/sub", "repo", ""}},
+		{"bitbucket:user/repo", Repository{"bitbucket.org", "user", "repo", ""}},
+		{"https://github.com/user/repo", Repository{"github.com", "user", "repo", ""}},
+		{"http://www.github.com/user/repo/", Repository{"github.com", "user", "repo", ""}},
+		{"git+https://github.com/user/repo.git", Repository{"github.com", "user", "repo", ""}},
+		{"git://github.com/user/repo.git#v1.0.0", Repository{"github.com", "user", "repo", ""}},
+		{"git+ssh://git@github.com/user/repo.git", Repository{"github.com", "user", "repo", ""}},
+		{"ssh://git@github.com:22/user/repo.git", Repository{"github.com", "user", "repo", ""}},
+		{"git@github.com:user/repo.git", Repository{"github.com", "user", "repo", ""}},
+		{"github.com/user/repo", Repository{"github.com", "user", "repo", ""}},
+		{"https://github.com/user/repo/issues", Repository{"github.com", "user", "repo", ""}},
+		{"https://gitlab.com/group/repo/-/issues", Repository{"gitlab.com", "group", "repo", ""}},
+		{"https://github.com/babel/babel/tree/main/packages/babel-core", Repository{"github.com", "babel", "babel", "packages/babel-core"}},
+		{"https://gitlab.com/group/repo/-/tree/main/packages/a", Repository{"gitlab.com", "group", "repo", "packages/a"}},
+		{"https://git.example.com/owner/repo", Repository{"git.example.com", "owner", "repo", ""}},
+	} {
+		r, err := ParseRepository(tc.in)
+		if err != nil {
+			t.Errorf("%s: %v", tc.in, err)
+			continue
+		}
+		if *r != tc.expected {
+			t.Errorf("%s: expected %+v got %+v", tc.in, tc.expected, *r)
+		}
+	}
+
+	for _, invalid := range []string{"", "repo", "gist:11081aaa281", "https://github.com/user", "file:../repo"} {
+		if _, err := ParseRepository(invalid); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestSourceRepository(t *testing.T) {
+	var m Manifest
+	json.Unmarshal([]byte(`{
+		"name": "@babel/core",
+		"repository": {
+			"type": "git",
+			"url": "https://github.com/babel/babel.git",
+			"directory": "./packages/babel-core"
+		}
+	}`), &m)
+	r, err := m.SourceRepository()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.String() != "github.com/babel/babel" || r.Directory != "packages/babel-core" {
+		t.Errorf("Wrong repository %+v", r)
+	}
+
+	if _, err := (&Manifest{}).SourceRepository(); err == nil {
+		t.Error("Expected an error without repository")
+	}
+}
+
+func TestTrackerForManifest(t *testing.T) {
+	opts := TrackerOptions{}
+	for _, tc := range []struct {
+		manifest string
+		repo     string
+	}{
+		{`{"name": "a", "repository": "github:user/a"}`, "github.com/user/a"},
+		{`{"name": "a", "repository": "https://git.example.com/user/a", "bugs": {"url": "https://gitlab.com/user/a/-/issues"}}`, "gitlab.com/user/a"},
+		{`{"name": "a", "bugs": "https://codeberg.org/user/a/issues"}`, "codeberg.org/user/a"},
+	} {
+		var m Manifest
+		json.Unmarshal([]byte(tc.manifest), &m)
+		tracker, repo, err := TrackerForManifest(&m, opts)
+		if err != nil {
+			t.Errorf("%s: %v", tc.manifest, err)
+			continue
+		}
+		if tracker == nil || repo.String() != tc.repo {
+			t.Errorf("%s: expected %s got %s", tc.manifest, tc.repo, repo)
+		}
+	}
+
+	var m Manifest
+	json.Unmarshal([]byte(`{"name": "a", "repository": "https://git.example.com/user/a", "bugs": {"email": "a@example.com"}}`), &m)
+	_, _, err := TrackerForManifest(&m, opts)
+	noTracker, ok := err.(*NoTrackerError)
+	if !ok {
+		t.Fatalf("Expected a NoTrackerError got %v", err)
+	}
+	if noTracker.Package != "a" || len(noTracker.Reasons) != 2 {
+		t.Errorf("Wrong error %+v", noTracker)
+	}
+	if !strings.Contains(err.Error(), "a has no reachable tracker: repository: unknown tracker host git.example.com") {
+		t.Errorf("Unclear error %q", err)
+	}
+}
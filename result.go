@@ -0,0 +1,225 @@
+package npmblame
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/gosuri/uitable"
+)
+
+// Diagnostic is a file system error met, and skipped, during a scan
+type Diagnostic struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// BlamedFile is a package file matching package errors
+type BlamedFile struct {
+	// Path is the file location relative to its package folder
+	Path   string         `json:"path"`
+	Size   int64          `json:"size"`
+	Errors []PackageError `json:"errors"`
+}
+
+// Instance is a single installed copy of a npm package
+type Instance struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	// Path is the package folder relative to the scan root
+	Path string `json:"path"`
+	// Size is the total size of the package files
+	Size   int64                `json:"size"`
+	Errors map[PackageError]int `json:"errors,omitempty"`
+	Files  []BlamedFile         `json:"files,omitempty"`
+	// Folders are the blamed folders, counted by the errors but not
+	// sized: their files are blamed on their own
+	Folders []BlamedFile `json:"folders,omitempty"`
+	// Metadata is the registry metadata of the version, when enriched
+	Metadata *PackageMetadata `json:"metadata,omitempty"`
+}
+
+// Bytes returns the size of the blamed files per package error
+func (i *Instance) Bytes() map[PackageError]int64 {
+	sizes := make(map[PackageError]int64)
+	for _, f := range i.Files {
+		for _, err := range f.Errors {
+			sizes[err] += f.Size
+		}
+	}
+	return sizes
+}
+
+// BlamedBytes returns the size of the blamed files.
+// Files matching several package errors are only counted once.
+func (i *Instance) BlamedBytes() int64 {
+	var total int64
+	for _, f := range i.Files {
+		total += f.Size
+	}
+	return total
+}
+
+// Result is the outcome of a scan
+type Result struct {
+	Packages NpmPackages `json:"packages"`
+	// Instances lists every installed package, ordered by path
+	Instances []*Instance `json:"instances,omitempty"`
+	// Diagnostics lists the paths that could not be scanned
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+	// Partial marks a scan interrupted before its end
+	Partial bool `json:"partial"`
+	// Suppressed lists the blame hidden by suppressions
+	Suppressed []SuppressedHit `json:"suppressed,omitempty"`
+	// Warnings are notices about the scan configuration
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// NewResult returns a new empty scan result
+func NewResult() *Result {
+	return &Result{Packages: NewNpmPackages()}
+}
+
+// sort orders the instances and diagnostics by path
+// so that results do not depend on the scan scheduling.
+func (r *Result) sort() {
+	sort.Slice(r.Instances, func(i, j int) bool {
+		return r.Instances[i].Path < r.Instances[j].Path
+	})
+	sort.Slice(r.Diagnostics, func(i, j int) bool {
+		return r.Diagnostics[i].Path < r.Diagnostics[j].Path
+	})
+}
+
+// Names returns the sorted names of the installed packages
+func (r *Result) Names() []string {
+	seen := make(map[string]bool)
+	for name := range r.Packages {
+		seen[name] = true
+	}
+	for _, i := range r.Instances {
+		seen[i.Name] = true
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Bytes returns the size of a package blamed files per package error,
+// summed over all of its installed instances.
+func (r *Result) Bytes(name string) map[PackageError]int64 {
+	sizes := make(map[PackageError]int64)
+	for _, i := range r.Instances {
+		if i.Name != name {
+			continue
+		}
+		for err, size := range i.Bytes() {
+			sizes[err] += size
+		}
+	}
+	return sizes
+}
+
+// ReadResult decodes a Result written by WriteJSON
+func ReadResult(rd io.Reader) (*Result, error) {
+	r := NewResult()
+	if err := json.NewDecoder(rd).Decode(r); err != nil {
+		return nil, err
+	}
+	if r.Packages == nil {
+		r.Packages = NewNpmPackages()
+	}
+	return r, nil
+}
+
+// WriteJSON writes the machine-readable representation of the Result
+func (r *Result) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// String returns the printable representation of the Result
+func (r *Result) String() string {
+	buf := &bytes.Buffer{}
+	if r.Partial {
+		fmt.Fprint(buf, "PARTIAL RESULTS: the scan was interrupted before completion.\n\n")
+	}
+	fmt.Fprint(buf, r.Packages)
+	if deprecated := r.deprecated(); len(deprecated) > 0 {
+		fmt.Fprintf(buf, "\n%d installed packages are deprecated:\n", len(deprecated))
+		for _, i := range deprecated {
+			fmt.Fprintf(buf, "  %s@%s: %s\n", i.Name, i.Version, i.Metadata.Deprecated)
+		}
+	}
+	if len(r.Diagnostics) > 0 {
+		fmt.Fprintf(buf, "\n%d paths could not be scanned:\n", len(r.Diagnostics))
+		for _, d := range r.Diagnostics {
+			fmt.Fprintf(buf, "  %s: %s\n", d.Path, d.Error)
+		}
+	}
+	if len(r.Suppressed) > 0 {
+		fmt.Fprintf(buf, "\n%d suppressed errors are hidden.\n", r.suppressedCount())
+	}
+	if len(r.Warnings) > 0 {
+		fmt.Fprintf(buf, "\n%d warnings:\n", len(r.Warnings))
+		for _, w := range r.Warnings {
+			fmt.Fprintf(buf, "  %s\n", w)
+		}
+	}
+	return buf.String()
+}
+
+// deprecated returns the instances of deprecated versions, each version
+// once
+func (r *Result) deprecated() []*Instance {
+	var deprecated []*Instance
+	seen := make(map[string]bool)
+	for _, i := range r.Instances {
+		key := i.Name + "@" + i.Version
+		if i.Metadata == nil || i.Metadata.Deprecated == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		deprecated = append(deprecated, i)
+	}
+	return deprecated
+}
+
+func (r *Result) suppressedCount() int {
+	count := 0
+	for _, hit := range r.Suppressed {
+		count += hit.Count
+	}
+	return count
+}
+
+// SuppressedString returns the printable list of suppressed errors
+func (r *Result) SuppressedString() string {
+	table := uitable.New()
+	table.MaxColWidth = 60
+	table.AddRow("PACKAGE", "VERSION", "ERROR", "COUNT", "PATH", "JUSTIFICATION")
+	for _, hit := range r.Suppressed {
+		table.AddRow(hit.Package, hit.Version, hit.Error, hit.Count, hit.Path, hit.Justification)
+	}
+	return fmt.Sprintf("%d suppressed errors\n\n%s\n", r.suppressedCount(), table)
+}
+
+// formatBytes returns a human readable size
+func formatBytes(b int64) string {
+	const unit = 1000
+	if b < unit && b > -unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit || n <= -unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(b)/float64(div), "kMGTPE"[exp])
+}
@@ -0,0 +1,102 @@
+package npmblame
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResultString(t *testing.T) {
+	r := NewResult()
+	r.Packages.AppendError("pkg", ImageError)
+	if strings.Contains(r.String(), "could not be scanned") {
+		t.Error("No diagnostics section expected", r)
+	}
+
+	r.Diagnostics = []Diagnostic{{Path: "/pkg/lib", Error: "permission denied"}}
+	if !strings.Contains(r.String(), "1 paths could not be scanned:\n  /pkg/lib: permission denied") {
+		t.Error("Missing diagnostics section", r)
+	}
+}
+
+func TestResultPartial(t *testing.T) {
+	r := NewResult()
+	r.Partial = true
+	if !strings.HasPrefix(r.String(), "PARTIAL RESULTS") {
+		t.Error("Partial results should be marked", r)
+	}
+
+	buf := &bytes.Buffer{}
+	r.WriteJSON(buf)
+	if !strings.Contains(buf.String(), `"partial": true`) {
+		t.Error("Partial results should be marked", buf)
+	}
+}
+
+func TestResultJSON(t *testing.T) {
+	r := NewResult()
+	r.Packages.AppendError("pkg", ImageError)
+	r.Diagnostics = []Diagnostic{{Path: "/pkg/lib", Error: "permission denied"}}
+
+	buf := &bytes.Buffer{}
+	if err := r.WriteJSON(buf); err != nil {
+		t.Fatal(err)
+	}
+	decoded := NewResult()
+	if err := json.Unmarshal(buf.Bytes(), decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, r) {
+		t.Errorf("Decoded %+v, want %+v", decoded, r)
+	}
+}
+
+func TestResultBytes(t *testing.T) {
+	r := NewResult()
+	r.Instances = []*Instance{
+		{Name: "pkg", Path: "/pkg", Files: []BlamedFile{
+			{Path: "logo.png", Size: 10, Errors: []PackageError{ImageError}},
+		}},
+		{Name: "pkg", Path: "/dep/node_modules/pkg", Files: []BlamedFile{
+			{Path: "test/logo.png", Size: 5, Errors: []PackageError{TestError, ImageError}},
+		}},
+		{Name: "dep", Path: "/dep"},
+	}
+
+	if b := r.Bytes("pkg"); b[ImageError] != 15 || b[TestError] != 5 {
+		t.Errorf("Wrong bytes: %v", b)
+	}
+	if names := r.Names(); !reflect.DeepEqual(names, []string{"dep", "pkg"}) {
+		t.Errorf("Wrong names: %v", names)
+	}
+}
+
+func TestReadResult(t *testing.T) {
+	if _, err := ReadResult(strings.NewReader("{")); err == nil {
+		t.Error("Expected a decoding error")
+	}
+	r, err := ReadResult(strings.NewReader(`{"partial":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Partial || r.Packages == nil {
+		t.Errorf("Wrong result: %+v", r)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{
+		0:        "0 B",
+		999:      "999 B",
+		1000:     "1.0 kB",
+		-1500:    "-1.5 kB",
+		12345678: "12.3 MB",
+	}
+	for b, want := range tests {
+		if got := formatBytes(b); got != want {
+			t.Errorf("formatBytes(%d) = %s, want %s", b, got, want)
+		}
+	}
+}
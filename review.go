@@ -0,0 +1,147 @@
+package npmblame
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ReviewCandidate is a package report waiting for review
+type ReviewCandidate struct {
+	Instance   *Instance
+	Repository *Repository
+	Report     *Report
+	// Notes explain how the target repository was picked
+	Notes []string
+}
+
+// Reviewer asks, package per package, whether to send, skip, edit or
+// suppress their report
+type Reviewer struct {
+	In  io.Reader
+	Out io.Writer
+	// Edit edits a report body, EditInEditor by default
+	Edit func(body string) (string, error)
+}
+
+// reviewPrompt lists the review actions
+const reviewPrompt = "[s]end, s[k]ip, [e]dit, su[p]press or [q]uit? "
+
+// Review shows the target repository, findings and body of every
+// candidate and records the answer in the outbox: sent reports are
+// queued, skipped and suppressed packages remembered so they are not
+// reviewed again. Quitting, or the end of the input, leaves the
+// remaining candidates for the next review. The number of queued
+// reports is returned.
+func (rv *Reviewer) Review(o *Outbox, candidates []*ReviewCandidate) (int, error) {
+	edit := rv.Edit
+	if edit == nil {
+		edit = EditInEditor
+	}
+	in := bufio.NewScanner(rv.In)
+	queued := 0
+	for n, c := range candidates {
+		rv.show(n+1, len(candidates), c)
+		for answered := false; !answered; {
+			fmt.Fprint(rv.Out, reviewPrompt)
+			if !in.Scan() {
+				fmt.Fprintln(rv.Out)
+				return queued, in.Err()
+			}
+			answered = true
+			switch strings.ToLower(strings.TrimSpace(in.Text())) {
+			case "s", "send":
+				o.Queue(c.Instance, c.Repository.Host, c.Report)
+				queued++
+			case "k", "skip":
+				o.Decide(c.Instance, SkipDecision)
+			case "p", "suppress":
+				o.Decide(c.Instance, SuppressDecision)
+			case "e", "edit":
+				body, err := edit(c.Report.Body)
+				if err != nil {
+					fmt.Fprintln(rv.Out, "Edit error.", err)
+				} else {
+					c.Report.Body = body
+					fmt.Fprintf(rv.Out, "\n%s\n\n", body)
+				}
+				answered = false
+			case "q", "quit":
+				return queued, nil
+			default:
+				answered = false
+			}
+		}
+		if err := o.Save(); err != nil {
+			return queued, err
+		}
+	}
+	return queued, nil
+}
+
+// show prints a candidate
+func (rv *Reviewer) show(n, total int, c *ReviewCandidate) {
+	fmt.Fprintf(rv.Out, "\n[%d/%d] %s@%s\n", n, total, c.Instance.Name, c.Instance.Version)
+	fmt.Fprintf(rv.Out, "Repository: %s", c.Repository.URL())
+	if c.Repository.Directory != "" {
+		fmt.Fprintf(rv.Out, " (%s)", c.Repository.Directory)
+	}
+	fmt.Fprintln(rv.Out)
+	for _, note := range c.Notes {
+		fmt.Fprintf(rv.Out, "Note: %s\n", note)
+	}
+	if r := c.Report; len(r.Labels) > 0 || r.Milestone != "" || len(r.Assignees) > 0 {
+		fmt.Fprintf(rv.Out, "Labels: %s, milestone: %s, assignees: %s\n",
+			orNone(strings.Join(r.Labels, ", ")), orNone(r.Milestone), orNone(strings.Join(r.Assignees, ", ")))
+	}
+	fmt.Fprintf(rv.Out, "Findings: %s\nTitle: %s\n\n%s\n\n", formatBlame(c.Instance), c.Report.Title, c.Report.Body)
+}
+
+// orNone returns s, or "none" when it is empty
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+// EditInEditor edits a text in $VISUAL, $EDITOR or vi and returns it
+func EditInEditor(text string) (string, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	f, err := ioutil.TempFile("", "npm-blame-*.md")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(text); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	// Editors are often given with arguments, such as "code --wait"
+	args := strings.Fields(editor)
+	cmd := exec.Command(args[0], append(args[1:], f.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %v", editor, err)
+	}
+	edited, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(edited), "\n"), nil
+}
@@ -0,0 +1,96 @@
+package npmblame
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func reviewCandidates(t *testing.T, names ...string) []*ReviewCandidate {
+	var candidates []*ReviewCandidate
+	for _, name := range names {
+		i := &Instance{Name: name, Version: "1.0.0", Size: 10, Errors: map[PackageError]int{TestError: 1}}
+		repo := &Repository{Host: "github.com", Owner: "owner", Name: name}
+		candidates = append(candidates, &ReviewCandidate{Instance: i, Repository: repo, Report: packageReport(t, i, repo)})
+	}
+	return candidates
+}
+
+func TestReview(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	o, _ := newTestOutbox(t, fs)
+	out := &bytes.Buffer{}
+	reviewer := &Reviewer{
+		// An unknown answer is asked again, edits are shown before asking
+		In:  strings.NewReader("what\ne\ns\nk\np\n"),
+		Out: out,
+		Edit: func(body string) (string, error) {
+			return "Edited body", nil
+		},
+	}
+	candidates := reviewCandidates(t, "sent", "skipped", "suppressed")
+	candidates[1].Notes = []string{"repository: github.com/owner/old is archived"}
+	queued, err := reviewer.Review(o, candidates)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if queued != 1 || len(o.Pending()) != 1 || o.Pending()[0].Report.Body != "Edited body" {
+		t.Errorf("Expected the edited report to be queued got %+v", o.Pending())
+	}
+	if !strings.Contains(out.String(), "[1/3] sent@1.0.0\nRepository: https://github.com/owner/sent\nFindings: 1 test (0 B), 0 B blamed of 10 B") {
+		t.Errorf("Wrong review output:\n%s", out)
+	}
+	if !strings.Contains(out.String(), "Repository: https://github.com/owner/skipped\nNote: repository: github.com/owner/old is archived\nFindings:") {
+		t.Errorf("Expected the target notes got:\n%s", out)
+	}
+	if strings.Count(out.String(), reviewPrompt) != 5 {
+		t.Errorf("Expected 5 prompts:\n%s", out)
+	}
+
+	// Decisions are remembered across runs
+	reopened, _ := newTestOutbox(t, fs)
+	for _, c := range candidates {
+		if !reopened.Decided(c.Instance) {
+			t.Errorf("%s should not be reviewed again", c.Instance.Name)
+		}
+	}
+	if e := reopened.Entry("suppressed"); e.String() != "suppressed: suppressed" {
+		t.Errorf("Wrong entry %s", e)
+	}
+	if reopened.Decided(&Instance{Name: "skipped", Version: "2.0.0"}) {
+		t.Error("A new version of a skipped package should be reviewed")
+	}
+	if _, queued := reopened.Queue(candidates[2].Instance, "github.com", candidates[2].Report); queued {
+		t.Error("A suppressed package should not be queued")
+	}
+}
+
+func TestReviewQuit(t *testing.T) {
+	for _, input := range []string{"q\n", ""} {
+		o, _ := newTestOutbox(t, afero.NewMemMapFs())
+		queued, err := (&Reviewer{In: strings.NewReader(input), Out: &bytes.Buffer{}}).Review(o, reviewCandidates(t, "a", "b"))
+		if err != nil || queued != 0 || len(o.Entries()) != 0 {
+			t.Errorf("%q: expected nothing to be recorded got %d %v", input, queued, err)
+		}
+	}
+}
+
+func TestEditInEditor(t *testing.T) {
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "sed -i s/blamed/edited/")
+	edited, err := EditInEditor("A blamed body\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edited != "A edited body" {
+		t.Errorf("Wrong edit %q", edited)
+	}
+
+	t.Setenv("EDITOR", "false")
+	if _, err := EditInEditor("body"); err == nil {
+		t.Error("Expected the editor error")
+	}
+}
@@ -0,0 +1,117 @@
+package npmblame
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RuleKind is the way a rule matches files
+type RuleKind int
+
+const (
+	// ContainsRule matches the paths containing the pattern
+	ContainsRule RuleKind = iota
+	// ExtensionRule matches the files with the pattern as extension
+	ExtensionRule
+	// NameRule matches the files named after the pattern
+	NameRule
+	// FolderRule matches the paths going through a folder, or a file,
+	// named after the pattern
+	FolderRule
+	// ExecutableRule matches the executable files
+	ExecutableRule
+)
+
+// Rule detects the files of a package error
+type Rule struct {
+	Error   PackageError
+	Kind    RuleKind
+	Pattern string
+}
+
+// Rules are the active detection rules, ordered by package error
+var Rules = []Rule{
+	{ExecError, ExecutableRule, ""},
+	{TestError, ContainsRule, "test"},
+	{TestError, ContainsRule, ".zuul.yml"},
+	{TestError, ContainsRule, "coverage"},
+	{TestError, ContainsRule, ".coveralls.yml"},
+	{BenchError, ContainsRule, "bench"},
+	{ImageError, ExtensionRule, ".png"},
+	{ImageError, ExtensionRule, ".jpg"},
+	{ImageError, ExtensionRule, ".ico"},
+	{CIError, ContainsRule, ".travis.yml"},
+	{DotfileError, ContainsRule, ".editorconfig"},
+	{DotfileError, ContainsRule, ".eslintrc"},
+	{DotfileError, ContainsRule, ".sass-lint.yml"},
+	{DotfileError, ContainsRule, ".jshintrc"},
+	{SecretError, NameRule, ".env"},
+	{SecretError, NameRule, ".npmrc"},
+	{SecretError, NameRule, ".htpasswd"},
+	{SecretError, NameRule, "id_rsa"},
+	{SecretError, NameRule, "id_dsa"},
+	{SecretError, NameRule, "id_ecdsa"},
+	{SecretError, NameRule, "id_ed25519"},
+	{SecretError, ExtensionRule, ".pem"},
+	{SecretError, ExtensionRule, ".key"},
+	{SecretError, ExtensionRule, ".p12"},
+	{SecretError, ExtensionRule, ".pfx"},
+	{VCSError, FolderRule, ".git"},
+	{VCSError, FolderRule, ".hg"},
+	{VCSError, FolderRule, ".svn"},
+}
+
+// Match reports whether the rule matches a file
+func (r Rule) Match(path string, info os.FileInfo) bool {
+	switch r.Kind {
+	case ContainsRule:
+		return strings.Contains(path, r.Pattern)
+	case ExtensionRule:
+		return filepath.Ext(path) == r.Pattern
+	case NameRule:
+		return filepath.Base(path) == r.Pattern
+	case FolderRule:
+		for _, dir := range strings.Split(path, "/") {
+			if dir == r.Pattern {
+				return true
+			}
+		}
+		return false
+	case ExecutableRule:
+		return !info.IsDir() && (info.Mode()&0111) != 0
+	}
+	return false
+}
+
+// String describes the files matched by the rule
+func (r Rule) String() string {
+	switch r.Kind {
+	case ContainsRule:
+		return fmt.Sprintf("paths containing %q", r.Pattern)
+	case ExtensionRule:
+		return fmt.Sprintf("files with the %s extension", r.Pattern)
+	case NameRule:
+		return fmt.Sprintf("files named %s", r.Pattern)
+	case FolderRule:
+		return fmt.Sprintf("%s folders", r.Pattern)
+	case ExecutableRule:
+		return "executable files"
+	}
+	return fmt.Sprintf("RuleKind(%d) %s", int(r.Kind), r.Pattern)
+}
+
+// Detect returns the package errors of a file
+func Detect(path string, info os.FileInfo) []PackageError {
+	var errs []PackageError
+	for _, r := range Rules {
+		if n := len(errs); n > 0 && errs[n-1] == r.Error {
+			continue
+		}
+		if r.Match(path, info) {
+			errs = append(errs, r.Error)
+		}
+	}
+	return errs
+}
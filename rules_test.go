@@ -0,0 +1,56 @@
+package npmblame
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+type fakeFileInfo struct {
+	name string
+	mode os.FileMode
+}
+
+func (fi fakeFileInfo) Name() string       { return fi.name }
+func (fi fakeFileInfo) Size() int64        { return 0 }
+func (fi fakeFileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi fakeFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi fakeFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi fakeFileInfo) Sys() interface{}   { return nil }
+
+func TestRuleMatch(t *testing.T) {
+	file := fakeFileInfo{name: "x", mode: 0644}
+	for _, tc := range []struct {
+		rule  Rule
+		path  string
+		info  os.FileInfo
+		match bool
+	}{
+		{Rule{TestError, ContainsRule, "test"}, "/pkg/lib/latest.js", file, true},
+		{Rule{ImageError, ExtensionRule, ".png"}, "/pkg/logo.png", file, true},
+		{Rule{ImageError, ExtensionRule, ".png"}, "/pkg/logo.png.js", file, false},
+		{Rule{SecretError, NameRule, ".env"}, "/pkg/config/.env", file, true},
+		{Rule{SecretError, NameRule, ".env"}, "/pkg/.env.example", file, false},
+		{Rule{VCSError, FolderRule, ".git"}, "/pkg/.git/HEAD", file, true},
+		{Rule{VCSError, FolderRule, ".git"}, "/pkg/.github/workflow.yml", file, false},
+		{Rule{ExecError, ExecutableRule, ""}, "/pkg/cli", fakeFileInfo{name: "cli", mode: 0755}, true},
+		{Rule{ExecError, ExecutableRule, ""}, "/pkg/bin", fakeFileInfo{name: "bin", mode: os.ModeDir | 0755}, false},
+	} {
+		if match := tc.rule.Match(tc.path, tc.info); match != tc.match {
+			t.Errorf("%s matching %s = %v, want %v", tc.rule, tc.path, match, tc.match)
+		}
+	}
+}
+
+func TestDetectReportsEachErrorOnce(t *testing.T) {
+	errs := Detect("/pkg/test/coverage/.travis.yml", fakeFileInfo{name: ".travis.yml", mode: 0755})
+	want := []PackageError{ExecError, TestError, CIError}
+	if len(errs) != len(want) {
+		t.Fatalf("Detect = %v, want %v", errs, want)
+	}
+	for i := range want {
+		if errs[i] != want[i] {
+			t.Errorf("Detect = %v, want %v", errs, want)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package npmblame
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// ScanOptions configures a Scanner
+type ScanOptions struct {
+	// Ignore lists the package names left out of the scan
+	Ignore []string
+	// Workers is the number of packages scanned concurrently.
+	// It defaults to the number of CPUs.
+	Workers int
+	// Cache, when set, skips the packages already blamed
+	Cache *Cache
+	// Strict stops the scan on the first file system error
+	// instead of recording it as a diagnostic.
+	Strict bool
+}
+
+// DefaultScanOptions returns the options used by the npm-blame command
+func DefaultScanOptions() ScanOptions {
+	return ScanOptions{
+		Ignore: []string{".bin"},
+	}
+}
+
+// Scanner blames the npm packages found under the root of a file system.
+// Any afero.Fs can be used: the OS, an in-memory fixture, a read-only
+// overlay or a remote host over SFTP.
+type Scanner struct {
+	Fs      afero.Fs
+	Root    string
+	Options ScanOptions
+}
+
+// NewScanner returns a new scanner of the root directory of fs
+func NewScanner(fs afero.Fs, root string, opts ScanOptions) *Scanner {
+	return &Scanner{
+		Fs:      fs,
+		Root:    root,
+		Options: opts,
+	}
+}
+
+// packageDir is a package folder waiting to be scanned
+type packageDir struct {
+	name string
+	// path is the folder location on the scanned file system
+	path string
+	// rel is the folder location relative to the scanner root
+	rel string
+}
+
+// packageResult is the outcome of a packageDir scan
+type packageResult struct {
+	packages NpmPackages
+	instance *Instance
+	// nested are the packages found in the package own node_modules
+	nested []packageDir
+	// modules are the node_modules folders inside the package files,
+	// relative to its path, its top level node_modules left out
+	modules     []string
+	diagnostics []Diagnostic
+	err         error
+}
+
+// skip records a file system error as a diagnostic and carries on,
+// unless the scan is strict.
+func (s *Scanner) skip(res *packageResult, p string, err error) error {
+	if s.Options.Strict {
+		return err
+	}
+	res.diagnostics = append(res.diagnostics, Diagnostic{Path: p, Error: err.Error()})
+	return nil
+}
+
+// Scan walks the scanner root and returns the blamed packages.
+// Every package folder, nested ones included, is scanned separately
+// by a bounded pool of workers and their results merged once done.
+// Unreadable paths are reported as diagnostics of the result, only
+// an unreadable root or a strict scan make it fail.
+func (s *Scanner) Scan() (*Result, error) {
+	return s.ScanContext(context.Background())
+}
+
+// ScanContext is like Scan but stops once ctx is done.
+// The packages blamed until then are returned in a partial result
+// along with the context error.
+func (s *Scanner) ScanContext(ctx context.Context) (*Result, error) {
+	result := NewResult()
+	rootRes := packageResult{}
+	queue, err := s.packageDirs(s.Root, "/", &rootRes)
+	if err != nil {
+		return result, err
+	}
+	result.Diagnostics = append(result.Diagnostics, rootRes.diagnostics...)
+
+	workers := s.Options.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	jobs := make(chan packageDir)
+	results := make(chan packageResult)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for dir := range jobs {
+				results <- s.scanPackage(ctx, dir)
+			}
+		}()
+	}
+
+	done := ctx.Done()
+	pending := 0
+	for len(queue) > 0 || pending > 0 {
+		var next chan packageDir
+		var dir packageDir
+		if len(queue) > 0 {
+			next = jobs
+			dir = queue[0]
+		}
+
+		select {
+		case next <- dir:
+			queue = queue[1:]
+			pending++
+		case res := <-results:
+			pending--
+			result.Packages.merge(res.packages)
+			result.Instances = append(result.Instances, res.instance)
+			result.Diagnostics = append(result.Diagnostics, res.diagnostics...)
+			if res.err != nil && err == nil {
+				err = res.err
+				queue = nil
+			}
+			if err == nil {
+				queue = append(queue, res.nested...)
+			}
+		case <-done:
+			done = nil
+			if err == nil {
+				err = ctx.Err()
+			}
+			queue = nil
+		}
+	}
+	close(jobs)
+	result.sort()
+	if err != nil && ctx.Err() != nil {
+		result.Partial = true
+	}
+	return result, err
+}
+
+// packageDirs lists the packages installed in a node_modules folder
+func (s *Scanner) packageDirs(dir string, rel string, res *packageResult) ([]packageDir, error) {
+	infos, err := afero.ReadDir(s.Fs, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []packageDir
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+		name := info.Name()
+		if strings.HasPrefix(name, "@") {
+			scopePath := filepath.Join(dir, name)
+			scoped, err := s.packageDirs(scopePath, path.Join(rel, name), res)
+			if err != nil {
+				if err := s.skip(res, scopePath, err); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			for _, d := range scoped {
+				d.name = name + "/" + d.name
+				if !s.ignored(d.name) {
+					dirs = append(dirs, d)
+				}
+			}
+			continue
+		}
+		if s.ignored(name) {
+			continue
+		}
+		dirs = append(dirs, packageDir{
+			name: name,
+			path: filepath.Join(dir, name),
+			rel:  path.Join(rel, name),
+		})
+	}
+	return dirs, nil
+}
+
+// scanPackage blames the files of a single package folder.
+// Its nested node_modules are returned to be scanned on their own.
+func (s *Scanner) scanPackage(ctx context.Context, dir packageDir) packageResult {
+	res := packageResult{
+		packages: NewNpmPackages(),
+		instance: &Instance{Name: dir.name, Path: dir.rel},
+	}
+	m, _ := ReadManifest(s.Fs, dir.path)
+	if m != nil {
+		res.instance.Version = m.Version
+	}
+
+	cache := s.Options.Cache
+	var key string
+	if cache != nil {
+		key = s.cacheKey(dir, m)
+	}
+	if key != "" {
+		if entry, ok := cache.Get(key); ok {
+			res.instance.Size = entry.Size
+			res.instance.Errors = copyErrors(entry.Errors)
+			res.instance.Files = entry.Files
+			res.instance.Folders = entry.Folders
+			if entry.Errors != nil {
+				res.packages.merge(NpmPackages{dir.name: entry.Errors})
+			}
+			// The nested packages depend on the install, not on the
+			// integrity: they are always listed from disk
+			for _, module := range append([]string{"node_modules"}, entry.NodeModules...) {
+				modulePath := filepath.Join(dir.path, filepath.FromSlash(module))
+				if info, err := s.Fs.Stat(modulePath); err != nil || !info.IsDir() {
+					continue
+				}
+				res.err = s.appendNested(&res, modulePath, path.Join(dir.rel, module))
+				if res.err != nil {
+					break
+				}
+			}
+			return res
+		}
+	}
+
+	res.err = s.walkPackage(ctx, dir, dir.path, dir.rel, &res)
+	res.instance.Errors = res.packages[dir.name]
+	if key != "" && res.err == nil && len(res.diagnostics) == 0 {
+		cache.Put(key, CacheEntry{
+			Size:        res.instance.Size,
+			Errors:      copyErrors(res.instance.Errors),
+			Files:       res.instance.Files,
+			Folders:     res.instance.Folders,
+			NodeModules: res.modules,
+		})
+	}
+	return res
+}
+
+// cacheKey returns the cache key of a package folder, if it has one.
+// Pruned packages are keyed on their folder, not their integrity.
+func (s *Scanner) cacheKey(dir packageDir, m *Manifest) string {
+	info, err := s.Fs.Stat(dir.path)
+	if err != nil {
+		return ""
+	}
+	if _, err := s.Fs.Stat(filepath.Join(dir.path, PrunedMarkerFile)); err == nil && m != nil {
+		pruned := *m
+		pruned.Integrity = ""
+		m = &pruned
+	}
+	return CacheKey(m, fmt.Sprintf("%d-%d", info.ModTime().UnixNano(), info.Size()))
+}
+
+func (s *Scanner) walkPackage(ctx context.Context, dir packageDir, p string, rel string, res *packageResult) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	infos, err := afero.ReadDir(s.Fs, p)
+	if err != nil {
+		return s.skip(res, p, err)
+	}
+
+	for _, info := range infos {
+		filePath := filepath.Join(p, info.Name())
+		fileRel := path.Join(rel, info.Name())
+		errs := res.packages.blame(strings.TrimPrefix(fileRel, dir.rel+"/"), info, dir.name)
+		if !info.IsDir() && info.Mode()&os.ModeSymlink == 0 {
+			res.instance.Size += info.Size()
+			if len(errs) > 0 {
+				res.instance.Files = append(res.instance.Files, BlamedFile{
+					Path:   strings.TrimPrefix(fileRel, dir.rel+"/"),
+					Size:   info.Size(),
+					Errors: errs,
+				})
+			}
+		}
+		if !info.IsDir() {
+			continue
+		}
+		if len(errs) > 0 {
+			res.instance.Folders = append(res.instance.Folders, BlamedFile{
+				Path:   strings.TrimPrefix(fileRel, dir.rel+"/"),
+				Errors: errs,
+			})
+		}
+
+		if info.Name() == "node_modules" {
+			module, err := filepath.Rel(dir.path, filePath)
+			if err != nil {
+				return err
+			}
+			// The top level node_modules is always read from disk
+			if module != "node_modules" {
+				res.modules = append(res.modules, filepath.ToSlash(module))
+			}
+			if err := s.appendNested(res, filePath, fileRel); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := s.walkPackage(ctx, dir, filePath, fileRel, res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendNested queues the packages of a nested node_modules folder
+func (s *Scanner) appendNested(res *packageResult, p string, rel string) error {
+	nested, err := s.packageDirs(p, rel, res)
+	if err != nil {
+		return s.skip(res, p, err)
+	}
+	res.nested = append(res.nested, nested...)
+	return nil
+}
+
+func (s *Scanner) ignored(pkg string) bool {
+	for _, name := range s.Options.Ignore {
+		if name == pkg {
+			return true
+		}
+	}
+	return false
+}
+
+// copyErrors returns a copy of a package errors count
+func copyErrors(errors map[PackageError]int) map[PackageError]int {
+	if errors == nil {
+		return nil
+	}
+	c := make(map[PackageError]int, len(errors))
+	for err, count := range errors {
+		c[err] = count
+	}
+	return c
+}
+
+// merge adds the errors of other to the packages
+func (np NpmPackages) merge(other NpmPackages) {
+	for name, errors := range other {
+		if np[name] == nil {
+			np[name] = make(map[PackageError]int)
+		}
+		for err, count := range errors {
+			np[name][err] += count
+		}
+	}
+}
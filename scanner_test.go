@@ -0,0 +1,327 @@
+package npmblame
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestNewScanner(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	s := NewScanner(fs, "/", DefaultScanOptions())
+	if s.Fs != fs || s.Root != "/" {
+		t.Errorf("Wrong scanner: %+v", s)
+	}
+}
+
+func TestScan(t *testing.T) {
+	fs, err := createNodeModulesFolder()
+	if err != nil {
+		t.Error("FileSystem error", err)
+	}
+
+	t.Run("Same as Blame", func(t *testing.T) {
+		want := NewNpmPackages()
+		if err := afero.Walk(fs, "/", want.Blame); err != nil {
+			t.Fatal(err)
+		}
+		res, err := NewScanner(fs, "/", DefaultScanOptions()).Scan()
+		if err != nil {
+			t.Fatal(err)
+		}
+		np := res.Packages
+		for pkg, errors := range want {
+			for e, n := range errors {
+				if np[pkg][e] != n {
+					t.Errorf("%s: wrong %d count: expected %d got %d", pkg, e, n, np[pkg][e])
+				}
+			}
+		}
+		if len(np[".bin"]) > 0 {
+			t.Error("Main binary folder should be excluded")
+		}
+	})
+
+	t.Run("Read only", func(t *testing.T) {
+		res, err := NewScanner(afero.NewReadOnlyFs(fs), "/", DefaultScanOptions()).Scan()
+		if err != nil {
+			t.Fatal(err)
+		}
+		np := res.Packages
+		if np["pkg"][ImageError] != 3 {
+			t.Error("No ImageError", np)
+		}
+	})
+
+	t.Run("Ignore", func(t *testing.T) {
+		res, err := NewScanner(fs, "/", ScanOptions{Ignore: []string{"pkg"}}).Scan()
+		if err != nil {
+			t.Fatal(err)
+		}
+		np := res.Packages
+		if len(np["pkg"]) > 0 {
+			t.Error("Ignored package was scanned", np)
+		}
+	})
+
+	t.Run("Nested root", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		fs.MkdirAll("/tests/app/node_modules/pkg", 0755)
+		fs.Create("/tests/app/node_modules/pkg/index.js")
+
+		res, err := NewScanner(fs, "/tests/app/node_modules", DefaultScanOptions()).Scan()
+		if err != nil {
+			t.Fatal(err)
+		}
+		np := res.Packages
+		if _, ok := np["pkg"]; !ok {
+			t.Error("Package not found", np)
+		}
+		if np.TotalErrors("pkg") != 0 {
+			t.Error("Root path should not be blamed", np)
+		}
+	})
+
+	t.Run("Missing root", func(t *testing.T) {
+		if _, err := NewScanner(fs, "/missing", DefaultScanOptions()).Scan(); err == nil {
+			t.Error("Scan should fail on a missing root")
+		}
+	})
+}
+
+// generateNodeModules fills fs with a node_modules tree of packages,
+// each holding files and a nested dependency.
+func generateNodeModules(fs afero.Fs, packages int, files int) {
+	for i := 0; i < packages; i++ {
+		pkg := fmt.Sprintf("/pkg%d", i)
+		if i%10 == 0 {
+			pkg = fmt.Sprintf("/@scope/pkg%d", i)
+		}
+		for _, dir := range []string{pkg, pkg + "/lib", pkg + "/test", pkg + "/node_modules/nested/bench"} {
+			fs.MkdirAll(dir, 0755)
+		}
+		for j := 0; j < files; j++ {
+			fs.Create(fmt.Sprintf("%s/lib/file%d.js", pkg, j))
+		}
+		fs.Create(pkg + "/test/index.js")
+		fs.Create(pkg + "/logo.png")
+		fs.Create(pkg + "/.travis.yml")
+		fs.Create(pkg + "/node_modules/nested/bench/index.js")
+	}
+	fs.MkdirAll("/.bin", 0755)
+	fs.Create("/.bin/bin")
+}
+
+func TestScanParallel(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	generateNodeModules(fs, 50, 5)
+
+	want := NewNpmPackages()
+	if err := afero.Walk(fs, "/", want.Blame); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, workers := range []int{1, 4, 16} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			opts := DefaultScanOptions()
+			opts.Workers = workers
+			res, err := NewScanner(fs, "/", opts).Scan()
+			if err != nil {
+				t.Fatal(err)
+			}
+			np := res.Packages
+			if !reflect.DeepEqual(np, want) {
+				t.Errorf("Scan returned %v, want %v", np, want)
+			}
+		})
+	}
+
+	t.Run("Scoped packages", func(t *testing.T) {
+		res, err := NewScanner(fs, "/", DefaultScanOptions()).Scan()
+		if err != nil {
+			t.Fatal(err)
+		}
+		np := res.Packages
+		if np["@scope/pkg0"][ImageError] != 1 {
+			t.Error("Scoped package not blamed", np)
+		}
+		if np["nested"][BenchError] == 0 {
+			t.Error("Nested package not blamed", np)
+		}
+	})
+}
+
+func BenchmarkScan(b *testing.B) {
+	fs := afero.NewMemMapFs()
+	generateNodeModules(fs, 2000, 50)
+
+	b.Run("Walk", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			np := NewNpmPackages()
+			if err := afero.Walk(fs, "/", np.Blame); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	for _, workers := range []int{1, 4, 0} {
+		b.Run(fmt.Sprintf("Workers-%d", workers), func(b *testing.B) {
+			opts := DefaultScanOptions()
+			opts.Workers = workers
+			s := NewScanner(fs, "/", opts)
+			for i := 0; i < b.N; i++ {
+				if _, err := s.Scan(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// failingFs fails to open the paths listed in fail
+type failingFs struct {
+	afero.Fs
+	fail map[string]bool
+}
+
+func (fs failingFs) Open(name string) (afero.File, error) {
+	if fs.fail[name] {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
+	}
+	return fs.Fs.Open(name)
+}
+
+func TestScanDiagnostics(t *testing.T) {
+	mem := afero.NewMemMapFs()
+	generateNodeModules(mem, 3, 1)
+	fs := failingFs{mem, map[string]bool{"/pkg1/lib": true, "/@scope": true}}
+
+	t.Run("Resilient", func(t *testing.T) {
+		res, err := NewScanner(fs, "/", DefaultScanOptions()).Scan()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []Diagnostic{
+			{Path: "/@scope", Error: "open /@scope: permission denied"},
+			{Path: "/pkg1/lib", Error: "open /pkg1/lib: permission denied"},
+		}
+		if !reflect.DeepEqual(res.Diagnostics, want) {
+			t.Errorf("Diagnostics = %v, want %v", res.Diagnostics, want)
+		}
+		if res.Packages["pkg1"][ImageError] != 1 || res.Packages["pkg2"][ImageError] != 1 {
+			t.Error("Scan should carry on after errors", res.Packages)
+		}
+	})
+
+	t.Run("Strict", func(t *testing.T) {
+		opts := DefaultScanOptions()
+		opts.Strict = true
+		if _, err := NewScanner(fs, "/", opts).Scan(); err == nil {
+			t.Error("Strict scan should stop on errors")
+		}
+	})
+}
+
+// cancelFs cancels a scan when opening the path at
+type cancelFs struct {
+	afero.Fs
+	at     string
+	cancel context.CancelFunc
+}
+
+func (fs cancelFs) Open(name string) (afero.File, error) {
+	if name == fs.at {
+		fs.cancel()
+	}
+	return fs.Fs.Open(name)
+}
+
+func TestScanContext(t *testing.T) {
+	mem := afero.NewMemMapFs()
+	generateNodeModules(mem, 3, 1)
+
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		fs := cancelFs{mem, "/pkg1/lib", cancel}
+		opts := DefaultScanOptions()
+		opts.Workers = 1
+
+		res, err := NewScanner(fs, "/", opts).ScanContext(ctx)
+		if err != context.Canceled {
+			t.Errorf("Expected a cancellation error got %v", err)
+		}
+		if !res.Partial {
+			t.Error("Result should be partial")
+		}
+		if _, ok := res.Packages["@scope/pkg0"]; !ok {
+			t.Error("Packages scanned before cancellation should be kept", res.Packages)
+		}
+		if _, ok := res.Packages["pkg2"]; ok {
+			t.Error("Packages should not be scanned after cancellation", res.Packages)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 0)
+		defer cancel()
+		res, err := NewScanner(mem, "/", DefaultScanOptions()).ScanContext(ctx)
+		if err != context.DeadlineExceeded {
+			t.Errorf("Expected a deadline error got %v", err)
+		}
+		if !res.Partial {
+			t.Error("Result should be partial")
+		}
+	})
+
+	t.Run("Complete", func(t *testing.T) {
+		res, err := NewScanner(mem, "/", DefaultScanOptions()).ScanContext(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Partial {
+			t.Error("Result should not be partial")
+		}
+	})
+}
+
+func TestScanInstances(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	fs.MkdirAll("/pkg/test", 0755)
+	afero.WriteFile(fs, "/pkg/package.json", []byte(`{"name":"pkg","version":"1.2.3"}`), 0644)
+	afero.WriteFile(fs, "/pkg/test/logo.png", []byte("12345"), 0644)
+	afero.WriteFile(fs, "/pkg/index.js", []byte("123"), 0644)
+	fs.MkdirAll("/pkg/node_modules/dep", 0755)
+	afero.WriteFile(fs, "/pkg/node_modules/dep/.travis.yml", []byte("1"), 0644)
+
+	res, err := NewScanner(fs, "/", DefaultScanOptions()).Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Instances) != 2 {
+		t.Fatalf("Expected 2 instances got %d", len(res.Instances))
+	}
+
+	pkg := res.Instances[0]
+	if pkg.Name != "pkg" || pkg.Version != "1.2.3" || pkg.Path != "/pkg" {
+		t.Errorf("Wrong instance: %+v", pkg)
+	}
+	if pkg.Size != int64(len(`{"name":"pkg","version":"1.2.3"}`))+5+3 {
+		t.Errorf("Wrong instance size: %d", pkg.Size)
+	}
+	want := []BlamedFile{{Path: "test/logo.png", Size: 5, Errors: []PackageError{TestError, ImageError}}}
+	if !reflect.DeepEqual(pkg.Files, want) {
+		t.Errorf("Files = %+v, want %+v", pkg.Files, want)
+	}
+	if b := pkg.Bytes(); b[TestError] != 5 || b[ImageError] != 5 || pkg.BlamedBytes() != 5 {
+		t.Errorf("Wrong blamed bytes: %v", b)
+	}
+
+	dep := res.Instances[1]
+	if dep.Name != "dep" || dep.Path != "/pkg/node_modules/dep" || dep.Errors[CIError] != 1 {
+		t.Errorf("Wrong nested instance: %+v", dep)
+	}
+}
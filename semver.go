@@ -0,0 +1,348 @@
+package npmblame
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// version is a semantic version as used by npm
+type version struct {
+	major, minor, patch int
+	pre                 string
+}
+
+// parseVersion parses a full semantic version, build metadata is ignored
+func parseVersion(s string) (version, error) {
+	var v version
+	s = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s), "="), "v")
+	if i := strings.Index(s, "+"); i != -1 {
+		s = s[:i]
+	}
+	if i := strings.Index(s, "-"); i != -1 {
+		v.pre = s[i+1:]
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return v, fmt.Errorf("invalid version %q", s)
+	}
+	var err error
+	if v.major, err = strconv.Atoi(parts[0]); err != nil {
+		return v, fmt.Errorf("invalid version %q", s)
+	}
+	if v.minor, err = strconv.Atoi(parts[1]); err != nil {
+		return v, fmt.Errorf("invalid version %q", s)
+	}
+	if v.patch, err = strconv.Atoi(parts[2]); err != nil {
+		return v, fmt.Errorf("invalid version %q", s)
+	}
+	return v, nil
+}
+
+func (v version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+	if v.pre != "" {
+		s += "-" + v.pre
+	}
+	return s
+}
+
+// compare returns -1, 0 or 1 when v is lower, equal or greater than o
+func (v version) compare(o version) int {
+	for _, d := range []int{v.major - o.major, v.minor - o.minor, v.patch - o.patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+	return comparePrerelease(v.pre, o.pre)
+}
+
+// comparePrerelease compares prerelease tags, a release being greater
+// than any of its prereleases
+func comparePrerelease(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "" {
+		return 1
+	}
+	if b == "" {
+		return -1
+	}
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		case as[i] != bs[i]:
+			if as[i] < bs[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
+
+// comparator is a single version constraint such as >=1.2.0
+type comparator struct {
+	op string
+	v  version
+}
+
+func (c comparator) match(v version) bool {
+	cmp := v.compare(c.v)
+	switch c.op {
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return cmp == 0
+}
+
+// versionRange is a npm version range: a union of comparator sets
+type versionRange [][]comparator
+
+// parseRange parses a npm version range such as "^1.2.0 || >=2.1 <3"
+func parseRange(s string) (versionRange, error) {
+	var r versionRange
+	for _, set := range strings.Split(s, "||") {
+		comparators, err := parseComparatorSet(strings.TrimSpace(set))
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, comparators)
+	}
+	return r, nil
+}
+
+// match reports whether v satisfies the range. Prereleases only match
+// the comparator sets naming a prerelease of the same version.
+func (r versionRange) match(v version) bool {
+	for _, set := range r {
+		if matchSet(set, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSet(set []comparator, v version) bool {
+	for _, c := range set {
+		if !c.match(v) {
+			return false
+		}
+	}
+	if v.pre == "" {
+		return true
+	}
+	for _, c := range set {
+		if c.v.pre != "" && c.v.major == v.major && c.v.minor == v.minor && c.v.patch == v.patch {
+			return true
+		}
+	}
+	return false
+}
+
+func parseComparatorSet(s string) ([]comparator, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 3 && fields[1] == "-" {
+		return parseHyphenRange(fields[0], fields[2])
+	}
+
+	// Operators may be separated from their version: ">= 1.2.0"
+	var tokens []string
+	for i := 0; i < len(fields); i++ {
+		if strings.Trim(fields[i], "<>=^~") == "" && i+1 < len(fields) {
+			tokens = append(tokens, fields[i]+fields[i+1])
+			i++
+			continue
+		}
+		tokens = append(tokens, fields[i])
+	}
+
+	set := []comparator{}
+	for _, token := range tokens {
+		comparators, err := parseComparator(token)
+		if err != nil {
+			return nil, err
+		}
+		set = append(set, comparators...)
+	}
+	return set, nil
+}
+
+// partial is a possibly incomplete version such as 1.x or 1.2
+type partial struct {
+	parts []int
+	pre   string
+}
+
+func parsePartial(s string) (partial, error) {
+	var p partial
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "="), "v")
+	if i := strings.Index(s, "+"); i != -1 {
+		s = s[:i]
+	}
+	if i := strings.Index(s, "-"); i != -1 {
+		p.pre = s[i+1:]
+		s = s[:i]
+	}
+	if s == "" {
+		return p, nil
+	}
+	for _, part := range strings.Split(s, ".") {
+		if part == "x" || part == "X" || part == "*" {
+			break
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return p, fmt.Errorf("invalid version range %q", s)
+		}
+		p.parts = append(p.parts, n)
+	}
+	if len(p.parts) > 3 {
+		return p, fmt.Errorf("invalid version range %q", s)
+	}
+	return p, nil
+}
+
+// floor returns the lowest version of the partial
+func (p partial) floor() version {
+	v := version{pre: p.pre}
+	parts := append(append([]int{}, p.parts...), 0, 0, 0)
+	v.major, v.minor, v.patch = parts[0], parts[1], parts[2]
+	return v
+}
+
+// next returns the lowest version above the partial, or false for "*"
+func (p partial) next() (version, bool) {
+	switch len(p.parts) {
+	case 1:
+		return version{major: p.parts[0] + 1, pre: "0"}, true
+	case 2:
+		return version{major: p.parts[0], minor: p.parts[1] + 1, pre: "0"}, true
+	}
+	return version{}, false
+}
+
+func parseComparator(s string) ([]comparator, error) {
+	op := s[:len(s)-len(strings.TrimLeft(s, "<>=^~"))]
+	p, err := parsePartial(s[len(op):])
+	if err != nil {
+		return nil, err
+	}
+	floor := p.floor()
+	next, bounded := p.next()
+
+	switch op {
+	case "^":
+		if len(p.parts) == 0 {
+			return nil, nil
+		}
+		upper := version{major: floor.major + 1, pre: "0"}
+		switch {
+		case floor.major == 0 && len(p.parts) >= 2 && (floor.minor > 0 || len(p.parts) == 2):
+			upper = version{minor: floor.minor + 1, pre: "0"}
+		case floor.major == 0 && len(p.parts) == 3:
+			upper = version{patch: floor.patch + 1, pre: "0"}
+		}
+		return []comparator{{">=", floor}, {"<", upper}}, nil
+	case "~", "~>":
+		if len(p.parts) == 0 {
+			return nil, nil
+		}
+		upper := version{major: floor.major, minor: floor.minor + 1, pre: "0"}
+		if len(p.parts) == 1 {
+			upper = version{major: floor.major + 1, pre: "0"}
+		}
+		return []comparator{{">=", floor}, {"<", upper}}, nil
+	case ">":
+		if bounded {
+			return []comparator{{">=", next}}, nil
+		}
+		if len(p.parts) == 0 {
+			return []comparator{{"<", version{}}}, nil
+		}
+		return []comparator{{">", floor}}, nil
+	case ">=":
+		return []comparator{{">=", floor}}, nil
+	case "<":
+		return []comparator{{"<", floor}}, nil
+	case "<=":
+		if bounded {
+			return []comparator{{"<", next}}, nil
+		}
+		if len(p.parts) == 0 {
+			return nil, nil
+		}
+		return []comparator{{"<=", floor}}, nil
+	case "", "=":
+		if len(p.parts) == 0 {
+			return nil, nil
+		}
+		if bounded {
+			return []comparator{{">=", floor}, {"<", next}}, nil
+		}
+		return []comparator{{"=", floor}}, nil
+	}
+	return nil, fmt.Errorf("invalid version range operator %q", op)
+}
+
+func parseHyphenRange(from, to string) ([]comparator, error) {
+	low, err := parsePartial(from)
+	if err != nil {
+		return nil, err
+	}
+	high, err := parsePartial(to)
+	if err != nil {
+		return nil, err
+	}
+	set := []comparator{{">=", low.floor()}}
+	if next, bounded := high.next(); bounded {
+		set = append(set, comparator{"<", next})
+	} else if len(high.parts) == 3 {
+		set = append(set, comparator{"<=", high.floor()})
+	}
+	return set, nil
+}
+
+// satisfies reports whether the version v is in the npm range r.
+// Invalid versions or ranges never match.
+func satisfies(v string, r string) bool {
+	ver, err := parseVersion(v)
+	if err != nil {
+		return false
+	}
+	vr, err := parseRange(r)
+	if err != nil {
+		return false
+	}
+	return vr.match(ver)
+}
@@ -0,0 +1,88 @@
+package npmblame
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	v, err := parseVersion("v1.2.3-beta.1+build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.String() != "1.2.3-beta.1" {
+		t.Errorf("Wrong version: %s", v)
+	}
+	for _, invalid := range []string{"", "1.2", "1.2.x", "a.b.c"} {
+		if _, err := parseVersion(invalid); err == nil {
+			t.Errorf("%q should be invalid", invalid)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.2.3", "1.10.0", -1},
+		{"2.0.0", "1.99.99", 1},
+		{"1.0.0-alpha", "1.0.0", -1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-alpha.2", "1.0.0-alpha.10", -1},
+		{"1.0.0-beta", "1.0.0-alpha", 1},
+		{"1.0.0-1", "1.0.0-alpha", -1},
+	}
+	for _, test := range tests {
+		a, _ := parseVersion(test.a)
+		b, _ := parseVersion(test.b)
+		if got := a.compare(b); got != test.want {
+			t.Errorf("compare(%s, %s) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestSatisfies(t *testing.T) {
+	tests := []struct {
+		version, rng string
+		want         bool
+	}{
+		{"1.2.3", "", true},
+		{"1.2.3", "*", true},
+		{"1.2.3", "1.2.3", true},
+		{"1.2.4", "=1.2.3", false},
+		{"1.9.0", "1.x", true},
+		{"2.0.0", "1", false},
+		{"1.2.9", "1.2", true},
+		{"1.9.0", "^1.2.3", true},
+		{"2.0.0", "^1.2.3", false},
+		{"1.2.2", "^1.2.3", false},
+		{"0.2.9", "^0.2.3", true},
+		{"0.3.0", "^0.2.3", false},
+		{"0.0.3", "^0.0.3", true},
+		{"0.0.4", "^0.0.3", false},
+		{"0.9.0", "^0.x", true},
+		{"1.2.9", "~1.2.3", true},
+		{"1.3.0", "~1.2.3", false},
+		{"1.9.0", "~1", true},
+		{"1.3.0", ">1.2", true},
+		{"1.2.9", ">1.2", false},
+		{"1.2.9", "<=1.2", true},
+		{"1.3.0", "<=1.2", false},
+		{"2.0.0", ">= 1.2.0 < 3", true},
+		{"3.0.0", ">=1.2.0 <3", false},
+		{"1.5.0", "1.2.3 - 2", true},
+		{"3.0.0", "1.2.3 - 2", false},
+		{"2.3.4", "1.2.3 - 2.3.4", true},
+		{"2.3.5", "1.2.3 - 2.3.4", false},
+		{"3.1.0", "^1.0.0 || ^3.0.0", true},
+		{"2.1.0", "^1.0.0 || ^3.0.0", false},
+		{"1.3.0-beta", "^1.2.0", false},
+		{"1.2.0-beta.2", ">=1.2.0-beta.1 <2", true},
+		{"not-a-version", "*", false},
+		{"1.0.0", "^a.b", false},
+	}
+	for _, test := range tests {
+		if got := satisfies(test.version, test.rng); got != test.want {
+			t.Errorf("satisfies(%s, %q) = %v, want %v", test.version, test.rng, got, test.want)
+		}
+	}
+}
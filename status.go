@@ -0,0 +1,218 @@
+package npmblame
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/gosuri/uitable"
+)
+
+// Report statuses
+const (
+	// StatusFixed reports no longer apply to a newer installed version
+	StatusFixed = "fixed"
+	// StatusIgnored reports were closed while the installed version is
+	// still blamed
+	StatusIgnored = "ignored"
+	// StatusOpen reports are waiting for a fix
+	StatusOpen = "open"
+	// StatusClosed reports were closed, the package being no longer
+	// installed
+	StatusClosed = "closed"
+)
+
+// statusOrder is the display order of the report statuses
+var statusOrder = map[string]int{StatusFixed: 0, StatusIgnored: 1, StatusOpen: 2, StatusClosed: 3}
+
+// ReportStatus is the refreshed status of a sent report
+type ReportStatus struct {
+	Package string `json:"package"`
+	// Reported and Installed are the reported and installed versions,
+	// Installed being empty when the package is no longer installed
+	Reported   string `json:"reported"`
+	Installed  string `json:"installed,omitempty"`
+	IssueState string `json:"issue_state,omitempty"`
+	URL        string `json:"url"`
+	Status     string `json:"status"`
+	// Thanked is set when a thanks comment was posted by the refresh
+	Thanked bool `json:"thanked,omitempty"`
+	// Error is the tracker error of the refresh, the last known issue
+	// state being used
+	Error string `json:"error,omitempty"`
+}
+
+// ReportStatuses are the statuses of the sent reports, ordered by status
+type ReportStatuses []*ReportStatus
+
+// RefreshOptions configure Outbox.Refresh
+type RefreshOptions struct {
+	// Thank posts a thanks comment on the open issues of fixed reports
+	Thank bool
+}
+
+// Refresh updates the issue state of every sent report with the trackers
+// returned by trackerFor and compares the reported versions with the
+// installed ones: reports are fixed when a newer installed version no
+// longer has their findings. The outbox is saved afterwards.
+func (o *Outbox) Refresh(r *Result, trackerFor func(host string) (Tracker, error), opts RefreshOptions) (ReportStatuses, error) {
+	var statuses ReportStatuses
+	for _, e := range o.entries {
+		if e.Issue == nil {
+			continue
+		}
+		s := &ReportStatus{Package: e.Package, Reported: e.Version, URL: e.Issue.URL}
+		statuses = append(statuses, s)
+
+		tracker, err := trackerFor(e.Host)
+		if err == nil {
+			var state string
+			if state, err = tracker.IssueState(e.Report.Owner, e.Report.Repository, e.Issue.Number); err == nil {
+				e.IssueState = state
+				e.CheckedAt = o.now()
+			}
+		}
+		if err != nil {
+			s.Error = err.Error()
+		}
+		s.IssueState = e.IssueState
+
+		installed := installedVersion(r, e.Package)
+		switch {
+		case installed != nil && fixedIn(e, installed.Version, blamedErrors(r, installed)):
+			s.Status = StatusFixed
+			if e.FixedIn == "" {
+				e.FixedIn = installed.Version
+			}
+		case e.IssueState == IssueClosed && installed == nil:
+			s.Status = StatusClosed
+		case e.IssueState == IssueClosed:
+			s.Status = StatusIgnored
+		default:
+			s.Status = StatusOpen
+		}
+		if installed != nil {
+			s.Installed = installed.Version
+		}
+
+		// The issue state is stale when the refresh failed, it may have
+		// been closed since
+		if opts.Thank && s.Error == "" && s.Status == StatusFixed && e.IssueState == IssueOpen && !e.Thanked {
+			body := fmt.Sprintf("Fixed in %s@%s, thanks! The files reported here are no longer published.\n\nChecked by [npm-blame](https://github.com/talend-glorieux/npm-blame) %s.",
+				e.Package, installed.Version, Version)
+			if err := tracker.Comment(e.Report.Owner, e.Report.Repository, e.Issue.Number, body); err != nil {
+				s.Error = err.Error()
+			} else {
+				e.Thanked, s.Thanked = true, true
+			}
+		}
+	}
+
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return statusOrder[statuses[i].Status] < statusOrder[statuses[j].Status]
+	})
+	return statuses, o.Save()
+}
+
+// installedVersion returns the newest installed instance of a package
+func installedVersion(r *Result, name string) *Instance {
+	var newest *Instance
+	for _, i := range r.Instances {
+		if i.Name != name {
+			continue
+		}
+		if newest == nil || newerVersion(i.Version, newest.Version) {
+			newest = i
+		}
+	}
+	return newest
+}
+
+// newerVersion reports whether a is newer than b, comparing them as
+// strings when they are not semantic versions
+func newerVersion(a, b string) bool {
+	va, errA := parseVersion(a)
+	vb, errB := parseVersion(b)
+	if errA != nil || errB != nil {
+		return a > b
+	}
+	return va.compare(vb) > 0
+}
+
+// fixedIn reports whether an installed version, newer than the reported
+// one, has none of the reported findings
+func fixedIn(e *OutboxEntry, version string, errors map[PackageError]int) bool {
+	if !newerVersion(version, e.Version) {
+		return false
+	}
+	if len(e.Findings) == 0 {
+		return len(errors) == 0
+	}
+	for err, count := range e.Findings {
+		if count > 0 && errors[err] > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// blamedErrors returns the errors of an instance, its suppressed ones
+// included: suppressing a reported category does not fix it
+func blamedErrors(r *Result, i *Instance) map[PackageError]int {
+	errors := copyErrors(i.Errors)
+	for _, hit := range r.Suppressed {
+		if hit.Package != i.Name || hit.Version != i.Version {
+			continue
+		}
+		if errors == nil {
+			errors = make(map[PackageError]int)
+		}
+		errors[hit.Error] += hit.Count
+	}
+	return errors
+}
+
+// WriteJSON writes the statuses as indented JSON
+func (s ReportStatuses) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// String returns the printable representation of the ReportStatuses
+func (s ReportStatuses) String() string {
+	buf := &bytes.Buffer{}
+	if len(s) == 0 {
+		fmt.Fprintln(buf, "No report sent.")
+		return buf.String()
+	}
+	table := uitable.New()
+	table.MaxColWidth = 80
+	table.AddRow("PACKAGE", "REPORTED", "INSTALLED", "ISSUE", "STATUS", "URL")
+	counts := make(map[string]int)
+	for _, rs := range s {
+		installed, state, status := rs.Installed, rs.IssueState, rs.Status
+		if installed == "" {
+			installed = "-"
+		}
+		if state == "" {
+			state = "unknown"
+		}
+		if rs.Thanked {
+			status += ", thanked"
+		}
+		table.AddRow(rs.Package, rs.Reported, installed, state, status, rs.URL)
+		counts[rs.Status]++
+	}
+	fmt.Fprintln(buf, table)
+	fmt.Fprintf(buf, "\n%d fixed, %d ignored, %d open and %d closed reports.\n",
+		counts[StatusFixed], counts[StatusIgnored], counts[StatusOpen], counts[StatusClosed])
+	for _, rs := range s {
+		if rs.Error != "" {
+			fmt.Fprintf(buf, "%s: refresh error. %s\n", rs.Package, rs.Error)
+		}
+	}
+	return buf.String()
+}
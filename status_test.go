@@ -0,0 +1,166 @@
+package npmblame
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// sentOutbox returns an outbox of reports sent for the instances
+func sentOutbox(t *testing.T, fs afero.Fs, tracker *fakeTracker, instances ...*Instance) *Outbox {
+	o, _ := newTestOutbox(t, fs)
+	for _, i := range instances {
+		o.Queue(i, "github.com", NewReport("owner", i.Name, nil))
+	}
+	if err := o.Flush(func(host string) (Tracker, error) { return tracker, nil }, nil); err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func blamedInstance(name, version string, errors map[PackageError]int) *Instance {
+	return &Instance{Name: name, Version: version, Path: "/" + name, Errors: errors}
+}
+
+func TestRefresh(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	tracker := &fakeTracker{}
+	tests := map[PackageError]int{TestError: 2}
+	sentOutbox(t, fs, tracker,
+		blamedInstance("fixed", "1.0.0", tests),
+		blamedInstance("ignored", "1.0.0", tests),
+		blamedInstance("open", "1.0.0", tests),
+		blamedInstance("removed", "1.0.0", tests),
+		blamedInstance("partly", "1.0.0", map[PackageError]int{TestError: 1, ImageError: 1}),
+	)
+	// Issues are numbered in sending order
+	tracker.closed = map[int]bool{2: true, 4: true}
+
+	result := &Result{Instances: []*Instance{
+		blamedInstance("fixed", "1.0.0", tests),
+		// Only the newest version counts, and its new findings do not
+		blamedInstance("fixed", "2.0.0", map[PackageError]int{DotfileError: 1}),
+		blamedInstance("ignored", "1.1.0", tests),
+		blamedInstance("open", "1.0.0", tests),
+		blamedInstance("partly", "1.1.0", map[PackageError]int{ImageError: 1}),
+	}}
+	o, _ := newTestOutbox(t, fs)
+	statuses, err := o.Refresh(result, func(host string) (Tracker, error) { return tracker, nil }, RefreshOptions{Thank: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, s := range statuses {
+		got = append(got, s.Package+" "+s.Status+" "+s.IssueState+" "+s.Installed)
+	}
+	expected := []string{
+		"fixed fixed open 2.0.0",
+		"ignored ignored closed 1.1.0",
+		"open open open 1.0.0",
+		"partly open open 1.1.0",
+		"removed closed closed ",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected statuses\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	if len(tracker.comments) != 1 || !strings.HasPrefix(tracker.comments[1][0], "Fixed in fixed@2.0.0, thanks!") {
+		t.Errorf("Expected a single thanks comment got %v", tracker.comments)
+	}
+	if !statuses[0].Thanked || !strings.Contains(statuses.String(), "fixed, thanked") {
+		t.Errorf("The thanks should be reported:\n%s", statuses)
+	}
+
+	// The ledger remembers the fix and the thanks
+	reopened, _ := newTestOutbox(t, fs)
+	if e := reopened.Entry("fixed"); e.FixedIn != "2.0.0" || !e.Thanked || e.IssueState != IssueOpen || e.Findings[TestError] != 2 {
+		t.Errorf("Wrong ledger entry %+v", e)
+	}
+	if _, err := reopened.Refresh(result, func(host string) (Tracker, error) { return tracker, nil }, RefreshOptions{Thank: true}); err != nil {
+		t.Fatal(err)
+	}
+	if len(tracker.comments[1]) != 1 {
+		t.Error("Fixed reports should be thanked once")
+	}
+}
+
+func TestRefreshErrors(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	tracker := &fakeTracker{}
+	sentOutbox(t, fs, tracker, blamedInstance("pkg", "1.0.0", map[PackageError]int{TestError: 1}))
+	o, _ := newTestOutbox(t, fs)
+	statuses, err := o.Refresh(&Result{}, func(host string) (Tracker, error) {
+		return nil, &TrackerError{StatusCode: 502, Message: "Bad Gateway"}
+	}, RefreshOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statuses[0].Status != StatusOpen || statuses[0].Error != "502 Bad Gateway" {
+		t.Errorf("Wrong status %+v", statuses[0])
+	}
+	if !strings.Contains(statuses.String(), "pkg: refresh error. 502 Bad Gateway") {
+		t.Errorf("The error should be reported:\n%s", statuses)
+	}
+
+	// Fixed reports are not thanked on their stale issue state
+	if _, err := o.Refresh(&Result{}, func(host string) (Tracker, error) { return tracker, nil }, RefreshOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	tracker.stateErr = &TrackerError{StatusCode: 502, Message: "Bad Gateway"}
+	fixed := &Result{Instances: []*Instance{blamedInstance("pkg", "2.0.0", nil)}}
+	statuses, err = o.Refresh(fixed, func(host string) (Tracker, error) { return tracker, nil }, RefreshOptions{Thank: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statuses[0].Status != StatusFixed || statuses[0].Thanked || statuses[0].Error == "" || len(tracker.comments) != 0 {
+		t.Errorf("Expected an unthanked fix got %+v, comments %v", statuses[0], tracker.comments)
+	}
+}
+
+func TestRefreshSuppressed(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	tracker := &fakeTracker{}
+	sentOutbox(t, fs, tracker, blamedInstance("pkg", "1.0.0", map[PackageError]int{TestError: 1}))
+	o, _ := newTestOutbox(t, fs)
+
+	// Suppressing the reported findings does not fix them
+	result := NewResult()
+	result.Packages = NpmPackages{"pkg": {TestError: 1}}
+	result.Instances = []*Instance{blamedInstance("pkg", "2.0.0", map[PackageError]int{TestError: 1})}
+	category := TestError
+	sups := &Suppressions{Suppressions: []*Suppression{{Package: "pkg", Category: &category, Justification: "Accepted"}}}
+	sups.Apply(result, time.Now())
+
+	statuses, err := o.Refresh(result, func(host string) (Tracker, error) { return tracker, nil }, RefreshOptions{Thank: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statuses[0].Status != StatusOpen || len(tracker.comments) != 0 {
+		t.Errorf("Expected an open report got %+v, comments %v", statuses[0], tracker.comments)
+	}
+}
+
+func TestReportStatusesString(t *testing.T) {
+	statuses := ReportStatuses{
+		{Package: "a", Reported: "1.0.0", Installed: "2.0.0", IssueState: IssueClosed, Status: StatusFixed, URL: "https://github.com/o/a/issues/1"},
+		{Package: "b", Reported: "1.0.0", Status: StatusOpen, URL: "https://github.com/o/b/issues/2"},
+	}
+	s := statuses.String()
+	for _, expected := range []string{"PACKAGE", "2.0.0", "unknown", "1 fixed, 0 ignored, 1 open and 0 closed reports."} {
+		if !strings.Contains(s, expected) {
+			t.Errorf("Expected %q in:\n%s", expected, s)
+		}
+	}
+	if ReportStatuses(nil).String() != "No report sent.\n" {
+		t.Error("Expected no report")
+	}
+
+	buf := &bytes.Buffer{}
+	if err := statuses.WriteJSON(buf); err != nil || !strings.Contains(buf.String(), `"status": "fixed"`) {
+		t.Errorf("Wrong JSON %s %v", buf, err)
+	}
+}
@@ -0,0 +1,290 @@
+package npmblame
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// DefaultSuppressionsFile is the suppression file looked up in a project
+const DefaultSuppressionsFile = ".npm-blame-suppressions.json"
+
+// Suppression accepts the blame of a package, for instance the images of
+// an icon library. Empty fields match everything.
+type Suppression struct {
+	// Package is the package name, it may use * wildcards
+	Package string `json:"package"`
+	// Version is a npm version range of the package
+	Version string `json:"version,omitempty"`
+	// Category is the accepted package error
+	Category *PackageError `json:"category,omitempty"`
+	// Path is a pattern of the accepted files relative to the package
+	// folder. * and ? do not match /, ** matches any folders.
+	Path          string `json:"path,omitempty"`
+	Justification string `json:"justification"`
+	// Expires is the date, formatted as 2006-01-02, after which
+	// the suppression is ignored.
+	Expires string `json:"expires,omitempty"`
+
+	pkg     *regexp.Regexp
+	path    *regexp.Regexp
+	expires time.Time
+}
+
+// Suppressions is a checked-in list of accepted package errors
+type Suppressions struct {
+	Suppressions []*Suppression `json:"suppressions"`
+}
+
+// SuppressedHit is a blame hidden by a suppression
+type SuppressedHit struct {
+	Package string       `json:"package"`
+	Version string       `json:"version,omitempty"`
+	Error   PackageError `json:"error"`
+	// Path is the suppressed file, empty when a whole category is
+	Path          string `json:"path,omitempty"`
+	Count         int    `json:"count"`
+	Justification string `json:"justification"`
+}
+
+// LoadSuppressions reads a JSON suppression file.
+// A missing file gives no suppressions.
+func LoadSuppressions(fs afero.Fs, p string) (*Suppressions, error) {
+	s := new(Suppressions)
+	data, err := afero.ReadFile(fs, p)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("invalid suppressions %s: %v", p, err)
+	}
+	for i, sup := range s.Suppressions {
+		if err := sup.compile(); err != nil {
+			return nil, fmt.Errorf("invalid suppression %d in %s: %v", i, p, err)
+		}
+	}
+	return s, nil
+}
+
+// compile validates the suppression and prepares its matchers
+func (s *Suppression) compile() error {
+	if s.Justification == "" {
+		return fmt.Errorf("a justification is required")
+	}
+	if s.Version != "" {
+		if _, err := parseRange(s.Version); err != nil {
+			return err
+		}
+	}
+	if s.Expires != "" {
+		expires, err := time.Parse("2006-01-02", s.Expires)
+		if err != nil {
+			return err
+		}
+		s.expires = expires
+	}
+	var err error
+	if s.pkg, err = globRegexp(s.Package); err != nil {
+		return err
+	}
+	if s.Path != "" {
+		s.path, err = globRegexp(s.Path)
+	}
+	return err
+}
+
+// globRegexp compiles a path pattern. * and ? do not match /,
+// ** matches any number of folders.
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		pattern = "**"
+	}
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	return regexp.Compile(re.String())
+}
+
+// Expired reports whether the suppression expired at the given time
+func (s *Suppression) Expired(now time.Time) bool {
+	return !s.expires.IsZero() && now.After(s.expires)
+}
+
+// matchInstance reports whether the suppression applies to a package
+func (s *Suppression) matchInstance(i *Instance) bool {
+	if s.pkg == nil {
+		if err := s.compile(); err != nil {
+			return false
+		}
+	}
+	if !s.pkg.MatchString(i.Name) {
+		return false
+	}
+	return s.Version == "" || satisfies(i.Version, s.Version)
+}
+
+func (s *Suppression) matchError(err PackageError) bool {
+	return s.Category == nil || *s.Category == err
+}
+
+// Apply hides the suppressed blame from a scan result, its totals and
+// therefore its policy checks. Expired suppressions are not applied
+// and reported as warnings of the result.
+func (s *Suppressions) Apply(r *Result, now time.Time) {
+	var active []*Suppression
+	for _, sup := range s.Suppressions {
+		if sup.Expired(now) {
+			r.Warnings = append(r.Warnings, fmt.Sprintf(
+				"suppression of %s expired on %s: %s", sup.describe(), sup.Expires, sup.Justification))
+			continue
+		}
+		active = append(active, sup)
+	}
+
+	for _, i := range r.Instances {
+		var matching []*Suppression
+		for _, sup := range active {
+			if sup.matchInstance(i) {
+				matching = append(matching, sup)
+			}
+		}
+		if len(matching) > 0 {
+			r.suppress(i, matching)
+		}
+	}
+	sort.SliceStable(r.Suppressed, func(i, j int) bool {
+		return r.Suppressed[i].Package < r.Suppressed[j].Package
+	})
+}
+
+// suppress removes the errors of an instance matched by suppressions
+func (r *Result) suppress(i *Instance, sups []*Suppression) {
+	// Whole categories first, so that their files are not counted twice
+	for _, sup := range sups {
+		if sup.path != nil {
+			continue
+		}
+		for _, err := range PackageErrors {
+			if count := i.Errors[err]; count > 0 && sup.matchError(err) {
+				r.hide(i, err, count)
+				r.Suppressed = append(r.Suppressed, SuppressedHit{
+					Package: i.Name, Version: i.Version, Error: err,
+					Count: count, Justification: sup.Justification,
+				})
+			}
+		}
+	}
+
+	i.Files = r.suppressFiles(i, i.Files, sups, false)
+	i.Folders = r.suppressFiles(i, i.Folders, sups, true)
+}
+
+// suppressFiles removes the file, or folder, errors matched by
+// suppressions and returns the files keeping errors
+func (r *Result) suppressFiles(i *Instance, files []BlamedFile, sups []*Suppression, folders bool) []BlamedFile {
+	var kept []BlamedFile
+	for _, f := range files {
+		var errs []PackageError
+		for _, err := range f.Errors {
+			sup := matchFile(sups, f.Path, folders, err)
+			if sup == nil {
+				errs = append(errs, err)
+				continue
+			}
+			if sup.path == nil {
+				// Already counted with its whole category
+				continue
+			}
+			r.hide(i, err, 1)
+			r.Suppressed = append(r.Suppressed, SuppressedHit{
+				Package: i.Name, Version: i.Version, Error: err,
+				Path: path.Join(i.Path, f.Path), Count: 1, Justification: sup.Justification,
+			})
+		}
+		if len(errs) > 0 {
+			f.Errors = errs
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// matchFile returns the suppression accepting a file error,
+// preferring the ones accepting a whole category. Folders also match
+// with a trailing slash, so that test/** accepts the test folder.
+func matchFile(sups []*Suppression, p string, folder bool, err PackageError) *Suppression {
+	var match *Suppression
+	for _, sup := range sups {
+		if !sup.matchError(err) {
+			continue
+		}
+		if sup.path == nil {
+			return sup
+		}
+		if match == nil && (sup.path.MatchString(p) || folder && sup.path.MatchString(p+"/")) {
+			match = sup
+		}
+	}
+	return match
+}
+
+// hide removes count errors from an instance and its package totals
+func (r *Result) hide(i *Instance, err PackageError, count int) {
+	if i.Errors[err] < count {
+		count = i.Errors[err]
+	}
+	if count == 0 {
+		return
+	}
+	i.Errors[err] -= count
+	if i.Errors[err] == 0 {
+		delete(i.Errors, err)
+	}
+	if errors := r.Packages[i.Name]; errors != nil {
+		errors[err] -= count
+		if errors[err] <= 0 {
+			delete(errors, err)
+		}
+	}
+}
+
+// describe returns a short description of what the suppression accepts
+func (s *Suppression) describe() string {
+	d := s.Package
+	if s.Version != "" {
+		d += "@" + s.Version
+	}
+	if s.Category != nil {
+		d += " " + s.Category.String()
+	}
+	if s.Path != "" {
+		d += " " + s.Path
+	}
+	return d
+}
@@ -0,0 +1,164 @@
+package npmblame
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func suppressionResult() *Result {
+	r := NewResult()
+	r.Packages = NpmPackages{
+		"icons": {ImageError: 3, TestError: 1},
+		"tool":  {ExecError: 2},
+	}
+	r.Instances = []*Instance{
+		{Name: "icons", Version: "5.1.0", Path: "/icons",
+			Errors: map[PackageError]int{ImageError: 3, TestError: 1},
+			Files: []BlamedFile{
+				{Path: "svgs/a/logo.png", Size: 10, Errors: []PackageError{ImageError}},
+				{Path: "svgs/b.png", Size: 10, Errors: []PackageError{ImageError}},
+				{Path: "test/c.png", Size: 10, Errors: []PackageError{TestError, ImageError}},
+			}},
+		{Name: "tool", Version: "1.0.0", Path: "/tool",
+			Errors: map[PackageError]int{ExecError: 2},
+			Files: []BlamedFile{
+				{Path: "bin/a", Size: 10, Errors: []PackageError{ExecError}},
+				{Path: "bin/b", Size: 10, Errors: []PackageError{ExecError}},
+			}},
+	}
+	return r
+}
+
+func TestLoadSuppressions(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/valid.json", []byte(`{"suppressions": [
+		{"package": "icons", "version": "^5.0.0", "category": "image", "path": "svgs/**", "justification": "icon library"}
+	]}`), 0644)
+
+	s, err := LoadSuppressions(fs, "/valid.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Suppressions) != 1 || *s.Suppressions[0].Category != ImageError {
+		t.Errorf("Wrong suppressions: %+v", s)
+	}
+
+	t.Run("Missing file", func(t *testing.T) {
+		s, err := LoadSuppressions(fs, "/missing.json")
+		if err != nil || len(s.Suppressions) != 0 {
+			t.Errorf("Expected no suppressions got %v, %v", s, err)
+		}
+	})
+
+	for name, content := range map[string]string{
+		"No justification": `{"suppressions": [{"package": "icons"}]}`,
+		"Invalid category": `{"suppressions": [{"package": "icons", "category": "nope", "justification": "j"}]}`,
+		"Invalid version":  `{"suppressions": [{"package": "icons", "version": "^a", "justification": "j"}]}`,
+		"Invalid expiry":   `{"suppressions": [{"package": "icons", "expires": "tomorrow", "justification": "j"}]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			afero.WriteFile(fs, "/invalid.json", []byte(content), 0644)
+			if _, err := LoadSuppressions(fs, "/invalid.json"); err == nil {
+				t.Error("Expected an invalid suppression error")
+			}
+		})
+	}
+}
+
+func TestGlobRegexp(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"svgs/**", "svgs/a/b.svg", true},
+		{"**/*.png", "logo.png", true},
+		{"**/*.png", "a/b/logo.png", true},
+		{"*.png", "a/logo.png", false},
+		{"bin/?", "bin/a", true},
+		{"@types/*", "@types/node", true},
+		{"icons.+", "iconsss", false},
+	}
+	for _, test := range tests {
+		re, err := globRegexp(test.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := re.MatchString(test.path); got != test.want {
+			t.Errorf("%s matching %s = %v, want %v", test.pattern, test.path, got, test.want)
+		}
+	}
+}
+
+func TestApplySuppressions(t *testing.T) {
+	image, exec := ImageError, ExecError
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := &Suppressions{Suppressions: []*Suppression{
+		{Package: "icons", Version: "^5.0.0", Category: &image, Path: "svgs/**", Justification: "icon library"},
+		{Package: "tool", Category: &exec, Justification: "cli tool"},
+		{Package: "*", Category: &image, Justification: "old", Expires: "2025-06-01"},
+		{Package: "icons", Version: "^6.0.0", Justification: "other version"},
+	}}
+	for _, sup := range s.Suppressions {
+		if err := sup.compile(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := suppressionResult()
+	s.Apply(r, now)
+
+	if want := (map[PackageError]int{ImageError: 1, TestError: 1}); !reflect.DeepEqual(r.Packages["icons"], want) {
+		t.Errorf("icons errors = %v, want %v", r.Packages["icons"], want)
+	}
+	if len(r.Packages["tool"]) != 0 || len(r.Instances[1].Errors) != 0 || len(r.Instances[1].Files) != 0 {
+		t.Errorf("tool should be fully suppressed: %v %+v", r.Packages["tool"], r.Instances[1])
+	}
+	if files := r.Instances[0].Files; len(files) != 1 || files[0].Path != "test/c.png" {
+		t.Errorf("Wrong remaining files: %+v", files)
+	}
+
+	want := []SuppressedHit{
+		{Package: "icons", Version: "5.1.0", Error: ImageError, Path: "/icons/svgs/a/logo.png", Count: 1, Justification: "icon library"},
+		{Package: "icons", Version: "5.1.0", Error: ImageError, Path: "/icons/svgs/b.png", Count: 1, Justification: "icon library"},
+		{Package: "tool", Version: "1.0.0", Error: ExecError, Count: 2, Justification: "cli tool"},
+	}
+	if !reflect.DeepEqual(r.Suppressed, want) {
+		t.Errorf("Suppressed = %+v, want %+v", r.Suppressed, want)
+	}
+
+	if len(r.Warnings) != 1 || !strings.Contains(r.Warnings[0], "expired on 2025-06-01") {
+		t.Errorf("Expected an expiry warning got %v", r.Warnings)
+	}
+	if !strings.Contains(r.SuppressedString(), "4 suppressed errors") {
+		t.Error("Wrong suppressed listing", r.SuppressedString())
+	}
+}
+
+func TestApplySuppressionsFolders(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	for p, data := range map[string]string{
+		"/nm/pkg/package.json": `{"name": "pkg", "version": "1.0.0"}`,
+		"/nm/pkg/index.js":     "main",
+		"/nm/pkg/test/a.js":    "test",
+	} {
+		afero.WriteFile(fs, p, []byte(data), 0644)
+	}
+	r, err := NewScanner(fs, "/nm", DefaultScanOptions()).Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := r.Instances[0]
+	if len(i.Folders) != 1 || i.Folders[0].Path != "test" || i.Errors[TestError] != 2 {
+		t.Fatalf("Expected the blamed test folder got %+v", i)
+	}
+
+	s := &Suppressions{Suppressions: []*Suppression{{Package: "pkg", Path: "test/**", Justification: "fixtures"}}}
+	s.Apply(r, time.Now())
+	if len(i.Errors) != 0 || len(i.Files) != 0 || len(i.Folders) != 0 || len(r.Packages["pkg"]) != 0 {
+		t.Errorf("The test folder should be suppressed with its files %v %+v", r.Packages["pkg"], i)
+	}
+}
@@ -0,0 +1,193 @@
+package npmblame
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Target actions, deciding what happens to the reports of repositories
+// that do not accept them
+const (
+	// ReportAction reports to the repository anyway
+	ReportAction = "report"
+	// BugsAction reports to the bugs URL of the package instead
+	BugsAction = "bugs"
+	// SkipAction does not report the package
+	SkipAction = "skip"
+)
+
+// TargetRules are the actions of the repositories not accepting reports.
+// Empty actions report anyway.
+type TargetRules struct {
+	Archived string
+	// Disabled repositories are blocked by their host
+	Disabled string
+	// Missing repositories are not found by their tracker
+	Missing string
+	// NoIssues repositories have their issues disabled
+	NoIssues string
+	// Inactive repositories had no push for InactiveAfter, zero never
+	// making them inactive
+	Inactive      string
+	InactiveAfter time.Duration
+}
+
+// DefaultTargetRules report to the bugs URL instead of archived, disabled,
+// missing and issueless repositories, and skip the repositories without a
+// push for two years
+func DefaultTargetRules() TargetRules {
+	return TargetRules{
+		Archived:      BugsAction,
+		Disabled:      BugsAction,
+		Missing:       BugsAction,
+		NoIssues:      BugsAction,
+		Inactive:      SkipAction,
+		InactiveAfter: 2 * 365 * 24 * time.Hour,
+	}
+}
+
+// ParseTargetRules parses comma separated rule=action pairs, such as
+// "archived=skip,inactive=report", over the default rules
+func ParseTargetRules(s string) (TargetRules, error) {
+	rules := DefaultTargetRules()
+	fields := map[string]*string{
+		"archived": &rules.Archived,
+		"disabled": &rules.Disabled,
+		"missing":  &rules.Missing,
+		"noissues": &rules.NoIssues,
+		"inactive": &rules.Inactive,
+	}
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		field, ok := fields[strings.TrimSpace(parts[0])]
+		if !ok || len(parts) != 2 {
+			return rules, fmt.Errorf("invalid target rule %q, expecting archived, disabled, missing, noissues or inactive=action", pair)
+		}
+		switch action := strings.TrimSpace(parts[1]); action {
+		case ReportAction, BugsAction, SkipAction:
+			*field = action
+		default:
+			return rules, fmt.Errorf("invalid target action %q, expecting report, bugs or skip", action)
+		}
+	}
+	return rules, nil
+}
+
+// check returns the action of the first rule the repository of a target
+// breaks, and why, or an empty action. The repository metadata is kept
+// in the target.
+func (r TargetRules) check(t *Target) (string, string, error) {
+	repo := t.Repository
+	info, err := t.Tracker.RepositoryInfo(repo.Owner, repo.Name)
+	if e, ok := err.(*TrackerError); ok && e.StatusCode == http.StatusNotFound {
+		return r.Missing, repo.String() + " is not found", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	t.Info = info
+	switch {
+	case info.Disabled:
+		return r.Disabled, repo.String() + " is disabled", nil
+	case info.Archived:
+		return r.Archived, repo.String() + " is archived", nil
+	case !info.HasIssues:
+		return r.NoIssues, repo.String() + " has no issues", nil
+	case r.InactiveAfter > 0 && !info.PushedAt.IsZero() && time.Since(info.PushedAt) > r.InactiveAfter:
+		return r.Inactive, fmt.Sprintf("%s is inactive since %s", repo, info.PushedAt.Format("2006-01-02")), nil
+	}
+	return "", "", nil
+}
+
+// Target is the tracker and repository a package report is sent to
+type Target struct {
+	Tracker    Tracker
+	Repository *Repository
+	// Info is the repository metadata checked against the rules, nil
+	// when unchecked
+	Info *RepositoryInfo
+	// Notes explain why the repository field was passed over for the bugs
+	// URL, or which rule was broken by a repository reported anyway
+	Notes []string
+}
+
+// ReportTarget returns where the report of a package is sent. The
+// repository field is tried first, then the bugs URL, their metadata
+// being checked against the rules. A *NoTrackerError is returned when
+// the package is skipped or neither leads to a supported tracker.
+func ReportTarget(m *Manifest, opts TrackerOptions, rules TargetRules) (*Target, error) {
+	return reportTarget(m, opts, rules.check)
+}
+
+// reportTarget returns the target of a package, the repositories being
+// checked by check unless it is nil
+func reportTarget(m *Manifest, opts TrackerOptions, check func(*Target) (string, string, error)) (*Target, error) {
+	noTracker := &NoTrackerError{Package: m.Name}
+	repo, err := m.SourceRepository()
+	if err == nil {
+		var t *Target
+		var action string
+		if t, action, err = checkTarget(repo, opts, check); t != nil {
+			return t, nil
+		}
+		if action == SkipAction {
+			noTracker.Reasons = append(noTracker.Reasons, "repository: "+err.Error()+", skipped")
+			return nil, noTracker
+		}
+	}
+	reason := "repository: " + err.Error()
+	noTracker.Reasons = append(noTracker.Reasons, reason)
+
+	bugs := m.BugsURL()
+	if bugs == "" {
+		noTracker.Reasons = append(noTracker.Reasons, "bugs: no bugs URL")
+		return nil, noTracker
+	}
+	bugsRepo, err := ParseRepository(bugs)
+	if err != nil {
+		noTracker.Reasons = append(noTracker.Reasons, "bugs: "+err.Error())
+		return nil, noTracker
+	}
+	if repo != nil && bugsRepo.String() == repo.String() {
+		noTracker.Reasons = append(noTracker.Reasons, "bugs: same repository")
+		return nil, noTracker
+	}
+	// The bugs URL has no fallback, its broken rules skip the package
+	t, _, err := checkTarget(bugsRepo, opts, check)
+	if t == nil {
+		noTracker.Reasons = append(noTracker.Reasons, "bugs: "+err.Error())
+		return nil, noTracker
+	}
+	t.Notes = append([]string{reason}, t.Notes...)
+	return t, nil
+}
+
+// checkTarget returns the target of a repository when its action is to
+// report it, or the action and why otherwise. Metadata errors skip the
+// package.
+func checkTarget(repo *Repository, opts TrackerOptions, check func(*Target) (string, string, error)) (*Target, string, error) {
+	tracker, err := NewTracker(repo.Host, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	t := &Target{Tracker: tracker, Repository: repo}
+	if check == nil {
+		return t, ReportAction, nil
+	}
+	action, reason, err := check(t)
+	if err != nil {
+		return nil, SkipAction, fmt.Errorf("metadata error %v", err)
+	}
+	if action == "" || action == ReportAction {
+		if reason != "" {
+			t.Notes = append(t.Notes, reason+", reported anyway")
+		}
+		return t, ReportAction, nil
+	}
+	return nil, action, fmt.Errorf("%s", reason)
+}
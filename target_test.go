@@ -0,0 +1,141 @@
+package npmblame
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTargetRules(t *testing.T) {
+	rules, err := ParseTargetRules("archived=skip, inactive=report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := DefaultTargetRules()
+	expected.Archived, expected.Inactive = SkipAction, ReportAction
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("Expected %+v got %+v", expected, rules)
+	}
+	if rules, _ := ParseTargetRules(""); !reflect.DeepEqual(rules, DefaultTargetRules()) {
+		t.Errorf("Expected the default rules got %+v", rules)
+	}
+	for _, invalid := range []string{"archived", "forked=skip", "archived=ignore"} {
+		if _, err := ParseTargetRules(invalid); err == nil {
+			t.Errorf("%s: expected an error", invalid)
+		}
+	}
+}
+
+func TestTargetRulesCheck(t *testing.T) {
+	tracker := &fakeTracker{repositories: map[string]*RepositoryInfo{
+		"user/active":   {HasIssues: true, PushedAt: time.Now().Add(-24 * time.Hour)},
+		"user/archived": {Archived: true, Disabled: true, HasIssues: true},
+		"user/issues":   {},
+		"user/inactive": {HasIssues: true, PushedAt: time.Date(2015, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}}
+	rules := DefaultTargetRules()
+	for _, tc := range []struct {
+		repo   string
+		action string
+		reason string
+	}{
+		{"active", "", ""},
+		{"archived", BugsAction, "github.com/user/archived is disabled"},
+		{"issues", BugsAction, "github.com/user/issues has no issues"},
+		{"inactive", SkipAction, "github.com/user/inactive is inactive since 2015-03-01"},
+		{"missing", BugsAction, "github.com/user/missing is not found"},
+	} {
+		action, reason, err := rules.check(&Target{Tracker: tracker, Repository: &Repository{Host: "github.com", Owner: "user", Name: tc.repo}})
+		if err != nil || action != tc.action || reason != tc.reason {
+			t.Errorf("%s: expected %q %q got %q %q %v", tc.repo, tc.action, tc.reason, action, reason, err)
+		}
+	}
+
+	rules.InactiveAfter = 0
+	if action, _, _ := rules.check(&Target{Tracker: tracker, Repository: &Repository{Host: "github.com", Owner: "user", Name: "inactive"}}); action != "" {
+		t.Errorf("Expected inactivity to be ignored got %q", action)
+	}
+}
+
+func TestReportTarget(t *testing.T) {
+	tracker := &fakeTracker{repositories: map[string]*RepositoryInfo{
+		"user/a":      {HasIssues: true},
+		"user/old":    {Archived: true, HasIssues: true},
+		"user/issues": {HasIssues: true},
+	}}
+	rules := DefaultTargetRules()
+	rules.Archived = BugsAction
+	check := func(target *Target) (string, string, error) {
+		target.Tracker = tracker
+		return rules.check(target)
+	}
+
+	for _, tc := range []struct {
+		manifest string
+		repo     string
+		notes    []string
+		reasons  []string
+	}{
+		{
+			manifest: `{"name": "a", "repository": "github:user/a"}`,
+			repo:     "github.com/user/a",
+		},
+		{
+			manifest: `{"name": "a", "repository": "github:user/old", "bugs": "https://gitlab.com/user/issues/-/issues"}`,
+			repo:     "gitlab.com/user/issues",
+			notes:    []string{"repository: github.com/user/old is archived"},
+		},
+		{
+			manifest: `{"name": "a", "repository": "github:user/old", "bugs": "https://github.com/user/old/issues"}`,
+			reasons:  []string{"repository: github.com/user/old is archived", "bugs: same repository"},
+		},
+		{
+			manifest: `{"name": "a", "repository": "github:user/gone", "bugs": "https://github.com/user/old/issues"}`,
+			reasons:  []string{"repository: github.com/user/gone is not found", "bugs: github.com/user/old is archived"},
+		},
+	} {
+		var m Manifest
+		json.Unmarshal([]byte(tc.manifest), &m)
+		target, err := reportTarget(&m, TrackerOptions{}, check)
+		if tc.reasons != nil {
+			noTracker, ok := err.(*NoTrackerError)
+			if !ok || !reflect.DeepEqual(noTracker.Reasons, tc.reasons) {
+				t.Errorf("%s: expected %v got %v", tc.manifest, tc.reasons, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.manifest, err)
+			continue
+		}
+		if target.Repository.String() != tc.repo || !reflect.DeepEqual(target.Notes, tc.notes) || target.Info == nil {
+			t.Errorf("%s: expected %s %v got %s %v", tc.manifest, tc.repo, tc.notes, target.Repository, target.Notes)
+		}
+	}
+
+	rules.Archived = ReportAction
+	var m Manifest
+	json.Unmarshal([]byte(`{"name": "a", "repository": "github:user/old"}`), &m)
+	target, err := reportTarget(&m, TrackerOptions{}, check)
+	if err != nil || len(target.Notes) != 1 || !strings.HasSuffix(target.Notes[0], "reported anyway") {
+		t.Errorf("Expected a reported anyway note got %+v %v", target, err)
+	}
+
+	rules.Inactive = SkipAction
+	tracker.repositories["user/a"].PushedAt = time.Now().Add(-10 * 365 * 24 * time.Hour)
+	json.Unmarshal([]byte(`{"name": "a", "repository": "github:user/a", "bugs": "https://gitlab.com/user/issues/-/issues"}`), &m)
+	if _, err := reportTarget(&m, TrackerOptions{}, check); err == nil || !strings.Contains(err.Error(), "skipped") {
+		t.Errorf("Expected the inactive repository to be skipped got %v", err)
+	}
+
+	tracker.repositories = nil
+	failing := func(*Target) (string, string, error) {
+		return "", "", &TrackerError{StatusCode: http.StatusBadGateway, Message: "Bad Gateway"}
+	}
+	if _, err := reportTarget(&m, TrackerOptions{}, failing); err == nil || !strings.Contains(err.Error(), "metadata error") {
+		t.Errorf("Expected a metadata error got %v", err)
+	}
+}
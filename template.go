@@ -0,0 +1,215 @@
+package npmblame
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// DefaultTitleTemplate is the default title of the package reports
+const DefaultTitleTemplate = `{{.Name}}: the published package includes {{bytes .BlamedBytes}} of development files`
+
+// DefaultBodyTemplate is the default markdown body of the package reports
+const DefaultBodyTemplate = `Hi! The tarball of ` + "`{{.Name}}@{{.Version}}`" + ` ships files its users do not need: {{bytes .BlamedBytes}} of its {{bytes .Size}}.
+{{range .Findings}}
+### {{.Title}}: {{.Count}} {{if eq .Count 1}}file{{else}}files{{end}}, {{bytes .Bytes}}{{if .FixedUpstream}} ({{$.FixedUpstreamLabel}} on ` + "`{{$.UpstreamBranch}}`" + `){{end}}
+
+{{.Remediation}}
+
+{{range first 10 .Files}}- ` + "`{{.}}`" + `
+{{end}}{{with more 10 .Files}}- and {{.}} more
+{{end}}{{end}}
+The [files field](https://docs.npmjs.com/cli/configuring-npm/package-json#files) of package.json, or a ` + "`.npmignore`" + `, controls what ` + "`npm publish`" + ` includes, and ` + "`npm pack --dry-run`" + ` lists it. Leaving these files out makes every install of {{.Name}} smaller and faster.
+
+---
+Found by [npm-blame](https://github.com/talend-glorieux/npm-blame) {{.NpmBlameVersion}}.
+`
+
+// Finding is the blame of a package for a package error
+type Finding struct {
+	Error PackageError
+	// Title is the readable name of the package error
+	Title string
+	// Count is the number of blamed files
+	Count int
+	Bytes int64
+	// Files are the blamed paths, relative to the package folder
+	Files []string
+	// Remediation suggests how to fix the package
+	Remediation string
+	// FixedUpstream is set when the default branch of the repository no
+	// longer publishes the files
+	FixedUpstream bool
+}
+
+// ReportData is the data of the report templates
+type ReportData struct {
+	Name    string
+	Version string
+	// Path is the package folder relative to the scan root
+	Path       string
+	Repository *Repository
+	// Size is the total size of the package files
+	Size        int64
+	BlamedBytes int64
+	Findings    []Finding
+	// UpstreamBranch is the default branch checked by CheckUpstream,
+	// empty when unchecked
+	UpstreamBranch     string
+	FixedUpstreamLabel string
+	// NpmBlameVersion is the version of npm-blame
+	NpmBlameVersion string
+}
+
+var findingTitles = map[PackageError]string{
+	ExecError:    "Executable files",
+	TestError:    "Tests",
+	BenchError:   "Benchmarks",
+	ImageError:   "Images",
+	CIError:      "Continuous integration configuration",
+	DotfileError: "Editor and linter configuration",
+	SecretError:  "Credentials and private keys",
+	VCSError:     "Version control folders",
+}
+
+var remediations = map[PackageError]string{
+	ExecError:    "Only the scripts of the `bin` field need the executable bit.",
+	TestError:    "Tests and coverage reports are only useful in the repository, they can be left out of the tarball.",
+	BenchError:   "Benchmarks are only useful in the repository, they can be left out of the tarball.",
+	ImageError:   "Images shown by the README can be linked from the repository instead of being published.",
+	CIError:      "Continuous integration configuration is of no use to the package users.",
+	DotfileError: "Editor and linter configuration is of no use to the package users.",
+	SecretError:  "These files may hold credentials. They should be left out of the tarball, and any published secret rotated.",
+	VCSError:     "Version control folders should never be published. Publishing from a clean checkout, or a files field, keeps them out.",
+}
+
+// NewReportData returns the template data of a blamed package
+func NewReportData(i *Instance, repo *Repository) *ReportData {
+	data := &ReportData{
+		Name:               i.Name,
+		Version:            i.Version,
+		Path:               i.Path,
+		Repository:         repo,
+		Size:               i.Size,
+		BlamedBytes:        i.BlamedBytes(),
+		FixedUpstreamLabel: FixedUpstreamLabel,
+		NpmBlameVersion:    Version,
+	}
+	sizes := i.Bytes()
+	for _, err := range PackageErrors {
+		if i.Errors[err] == 0 {
+			continue
+		}
+		f := Finding{
+			Error:       err,
+			Title:       findingTitles[err],
+			Bytes:       sizes[err],
+			Remediation: remediations[err],
+		}
+		for _, file := range i.Files {
+			if hasError(file.Errors, err) {
+				f.Files = append(f.Files, file.Path)
+			}
+		}
+		// The blamed folders are counted by the errors, not listed
+		if f.Count = len(f.Files); f.Count == 0 {
+			continue
+		}
+		data.Findings = append(data.Findings, f)
+	}
+	return data
+}
+
+var templateFuncs = template.FuncMap{
+	"bytes": formatBytes,
+	"join":  strings.Join,
+	// first returns the n first elements of a list
+	"first": func(n int, list []string) []string {
+		if len(list) > n {
+			return list[:n]
+		}
+		return list
+	},
+	// more returns the number of elements past the n first of a list
+	"more": func(n int, list []string) int {
+		if len(list) > n {
+			return len(list) - n
+		}
+		return 0
+	},
+}
+
+// ReportTemplate renders the title and body of package reports
+type ReportTemplate struct {
+	title *template.Template
+	body  *template.Template
+}
+
+// NewReportTemplate parses the title and body templates of the reports.
+// They are given a *ReportData, along with the bytes, join, first and
+// more functions, and are validated by rendering a sample package.
+func NewReportTemplate(title, body string) (*ReportTemplate, error) {
+	t := &ReportTemplate{}
+	var err error
+	if t.title, err = template.New("title").Funcs(templateFuncs).Parse(title); err != nil {
+		return nil, err
+	}
+	if t.body, err = template.New("body").Funcs(templateFuncs).Parse(body); err != nil {
+		return nil, err
+	}
+
+	sample := &Instance{Name: "sample", Version: "1.0.0", Path: "/sample", Size: 2048, Errors: make(map[PackageError]int)}
+	for _, err := range PackageErrors {
+		sample.Errors[err] = 1
+		sample.Files = append(sample.Files, BlamedFile{Path: err.String(), Size: 1, Errors: []PackageError{err}})
+	}
+	data := NewReportData(sample, &Repository{Host: "github.com", Owner: "owner", Name: "sample"})
+	data.UpstreamBranch = "main"
+	data.Findings[0].FixedUpstream = true
+	if _, err := t.RenderData(data); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// defaultReportTemplate is parsed once, the default templates being
+// constants covered by the tests
+var defaultReportTemplate = &ReportTemplate{
+	title: template.Must(template.New("title").Funcs(templateFuncs).Parse(DefaultTitleTemplate)),
+	body:  template.Must(template.New("body").Funcs(templateFuncs).Parse(DefaultBodyTemplate)),
+}
+
+// DefaultReportTemplate returns the report template of the default title
+// and body templates
+func DefaultReportTemplate() *ReportTemplate {
+	return defaultReportTemplate
+}
+
+// Render returns the report of a blamed package, sent to its repository
+func (t *ReportTemplate) Render(i *Instance, repo *Repository) (*Report, error) {
+	return t.RenderData(NewReportData(i, repo))
+}
+
+// RenderData returns the report of template data, such as the data of
+// NewReportData labeled by an UpstreamStatus
+func (t *ReportTemplate) RenderData(data *ReportData) (*Report, error) {
+	repo := data.Repository
+	title := &bytes.Buffer{}
+	if err := t.title.Execute(title, data); err != nil {
+		return nil, err
+	}
+	body := &bytes.Buffer{}
+	if err := t.body.Execute(body, data); err != nil {
+		return nil, err
+	}
+	r := NewReport(repo.Owner, repo.Name, nil)
+	r.Title = strings.TrimSpace(title.String())
+	r.Body = strings.TrimSpace(body.String())
+	r.Directory = repo.Directory
+	r.Marker = &ReportMarker{NpmBlameVersion: data.NpmBlameVersion, Package: data.Name, Version: data.Version}
+	if r.Title == "" {
+		return nil, fmt.Errorf("empty report title for %s", data.Name)
+	}
+	return r, nil
+}
@@ -0,0 +1,99 @@
+package npmblame
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func templateInstance() *Instance {
+	i := &Instance{
+		Name:    "pkg",
+		Version: "1.2.3",
+		Path:    "/pkg",
+		Size:    40000,
+		// The blamed test/ folder is counted by the errors
+		Errors: map[PackageError]int{TestError: 13, SecretError: 1},
+		Files:  []BlamedFile{{Path: ".env", Size: 100, Errors: []PackageError{SecretError}}},
+	}
+	for n := 0; n < 12; n++ {
+		i.Files = append(i.Files, BlamedFile{Path: fmt.Sprintf("test/%02d.js", n), Size: 1000, Errors: []PackageError{TestError}})
+	}
+	return i
+}
+
+func TestNewReportData(t *testing.T) {
+	data := NewReportData(templateInstance(), &Repository{Host: "github.com", Owner: "owner", Name: "pkg"})
+	if data.BlamedBytes != 12100 || data.NpmBlameVersion != Version || len(data.Findings) != 2 {
+		t.Fatalf("Wrong data %+v", data)
+	}
+	tests, secrets := data.Findings[0], data.Findings[1]
+	if tests.Error != TestError || tests.Title != "Tests" || tests.Count != 12 || tests.Bytes != 12000 || len(tests.Files) != 12 {
+		t.Errorf("Wrong test finding %+v", tests)
+	}
+	if secrets.Error != SecretError || len(secrets.Files) != 1 || secrets.Files[0] != ".env" || secrets.Remediation == "" {
+		t.Errorf("Wrong secret finding %+v", secrets)
+	}
+
+	// Errors of blamed folders alone have no file to report
+	i := templateInstance()
+	i.Errors[CIError] = 1
+	if data := NewReportData(i, &Repository{Host: "github.com", Owner: "owner", Name: "pkg"}); len(data.Findings) != 2 {
+		t.Errorf("Expected no finding without files got %+v", data.Findings)
+	}
+}
+
+func TestDefaultReportTemplate(t *testing.T) {
+	r, err := DefaultReportTemplate().Render(templateInstance(), &Repository{Host: "github.com", Owner: "owner", Name: "mono", Directory: "packages/pkg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Owner != "owner" || r.Repository != "mono" || r.Directory != "packages/pkg" {
+		t.Errorf("Wrong report target %+v", r)
+	}
+	if r.Title != "pkg: the published package includes 12.1 kB of development files" {
+		t.Errorf("Wrong title %q", r.Title)
+	}
+	for _, expected := range []string{
+		"The tarball of `pkg@1.2.3` ships files its users do not need: 12.1 kB of its 40.0 kB.",
+		"### Tests: 12 files, 12.0 kB",
+		"- `test/09.js`\n- and 2 more\n",
+		"### Credentials and private keys: 1 file, 100 B",
+		"- `.env`\n",
+		"Found by [npm-blame](https://github.com/talend-glorieux/npm-blame) " + Version + ".",
+	} {
+		if !strings.Contains(r.Body, expected) {
+			t.Errorf("Expected %q in:\n%s", expected, r.Body)
+		}
+	}
+	if strings.Contains(r.Body, "test/10.js") {
+		t.Errorf("Expected the file list to be truncated:\n%s", r.Body)
+	}
+}
+
+func TestNewReportTemplate(t *testing.T) {
+	tmpl, err := NewReportTemplate(`[npm-blame] {{.Name}}`, `{{range .Findings}}{{.Error}} {{join .Files ", "}}
+{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := tmpl.Render(templateInstance(), &Repository{Host: "github.com", Owner: "owner", Name: "pkg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Title != "[npm-blame] pkg" || !strings.HasPrefix(r.Body, "test test/00.js, test/01.js") || !strings.HasSuffix(r.Body, "secret .env") {
+		t.Errorf("Wrong report %q %q", r.Title, r.Body)
+	}
+
+	for _, invalid := range [][2]string{
+		{`{{.Name`, `body`},
+		{`title`, `{{.Unknown}}`},
+		{`title`, `{{range .Findings}}{{.Files.Size}}{{end}}`},
+		{`title`, `{{unknown .Name}}`},
+		{`{{if false}}{{end}}`, `body`},
+	} {
+		if _, err := NewReportTemplate(invalid[0], invalid[1]); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+}
@@ -0,0 +1,982 @@
+package npmblame
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// Issue is an issue created on a tracker
+type Issue struct {
+	Number int    `json:"number"`
+	URL    string `json:"url"`
+}
+
+// NewIssue is an issue to create
+type NewIssue struct {
+	Title string
+	Body  string
+	// Labels are created when missing, if the tracker allows it
+	Labels []string
+	// Milestone is the title of an open milestone, ignored when the
+	// repository has none of this title
+	Milestone string
+	// Assignees are user names
+	Assignees []string
+}
+
+// FoundIssue is an issue returned by Tracker.OwnIssues, with its body
+type FoundIssue struct {
+	Issue
+	Body string
+}
+
+// labelColor is the color of the created labels
+const labelColor = "ededed"
+
+// Issue states, as returned by Tracker.IssueState
+const (
+	IssueOpen   = "open"
+	IssueClosed = "closed"
+)
+
+// Tracker is an issue tracker reports are sent to
+type Tracker interface {
+	// CreateIssue opens an issue on the owner/repo repository
+	CreateIssue(owner, repo string, issue *NewIssue) (*Issue, error)
+	// IssueState returns whether an issue is open or closed
+	IssueState(owner, repo string, number int) (string, error)
+	// Comment adds a comment to an issue
+	Comment(owner, repo string, number int, body string) error
+	// RepositoryInfo returns the metadata of the owner/repo repository
+	RepositoryInfo(owner, repo string) (*RepositoryInfo, error)
+	// FileContent returns a file of the owner/repo repository at a
+	// branch, or nil when it does not exist
+	FileContent(owner, repo, ref, path string) ([]byte, error)
+	// OwnIssues returns the newest open and closed issues of the
+	// owner/repo repository created by the authenticated user, those
+	// having every label when the tracker keeps the labels of its users
+	OwnIssues(owner, repo string, labels []string) ([]*FoundIssue, error)
+	// UpdateIssue replaces the title and body of an issue
+	UpdateIssue(owner, repo string, number int, title, body string) error
+}
+
+// RepositoryInfo is the repository metadata telling whether it still
+// accepts reports
+type RepositoryInfo struct {
+	Archived bool
+	// Disabled repositories are blocked by their host
+	Disabled  bool
+	HasIssues bool
+	// PushedAt is the last push, or activity, zero when unknown
+	PushedAt      time.Time
+	DefaultBranch string
+}
+
+// Tracker kinds
+const (
+	GitHub    = "github"
+	GitLab    = "gitlab"
+	Bitbucket = "bitbucket"
+	Gitea     = "gitea"
+)
+
+// TrackerOptions configure the trackers picked by NewTracker
+type TrackerOptions struct {
+	// Tokens are the API tokens by tracker host
+	Tokens map[string]string
+	// Hosts maps self-hosted tracker hosts to their kind,
+	// such as "git.example.com": "gitea"
+	Hosts map[string]string
+	// GitHub holds the authentication and API URLs of GitHub hosts,
+	// such as GitHub App installations and GitHub Enterprise servers.
+	// Their token defaults to the one of Tokens.
+	GitHub map[string]GitHubAuth
+	// HTTPClient is used by the trackers, http.DefaultClient by default
+	HTTPClient *http.Client
+}
+
+// trackerHosts are the kinds of the public tracker hosts
+var trackerHosts = map[string]string{
+	"github.com":    GitHub,
+	"gitlab.com":    GitLab,
+	"bitbucket.org": Bitbucket,
+	"codeberg.org":  Gitea,
+	"gitea.com":     Gitea,
+}
+
+// NewTracker returns the tracker of a repository host
+func NewTracker(host string, opts TrackerOptions) (Tracker, error) {
+	host = strings.ToLower(host)
+	kind, ok := opts.Hosts[host]
+	if !ok {
+		kind, ok = trackerHosts[host]
+	}
+	if _, enterprise := opts.GitHub[host]; !ok && enterprise {
+		kind, ok = GitHub, true
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown tracker host %s", host)
+	}
+	token := opts.Tokens[host]
+	client := opts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	switch kind {
+	case GitHub:
+		auth := opts.GitHub[host]
+		auth.Host = host
+		if auth.Token == "" {
+			auth.Token = token
+		}
+		if auth.HTTPClient == nil {
+			auth.HTTPClient = client
+		}
+		gc, err := NewGitHubClient(auth)
+		if err != nil {
+			return nil, err
+		}
+		return NewGitHubTracker(gc), nil
+	case GitLab:
+		return &GitLabTracker{BaseURL: "https://" + host, Token: token, Client: client}, nil
+	case Bitbucket:
+		base := "https://api.bitbucket.org"
+		if host != "bitbucket.org" {
+			base = "https://" + host
+		}
+		return &BitbucketTracker{BaseURL: base, Token: token, Client: client}, nil
+	case Gitea:
+		return &GiteaTracker{BaseURL: "https://" + host, Token: token, Client: client}, nil
+	}
+	return nil, fmt.Errorf("unknown tracker kind %s for %s", kind, host)
+}
+
+// TrackerFor returns the tracker of a repository or bugs URL such as
+// https://gitlab.com/group/project/-/issues, with the repository owner
+// and name. Any repository format of ParseRepository is accepted.
+func TrackerFor(repository string, opts TrackerOptions) (Tracker, string, string, error) {
+	repo, err := ParseRepository(repository)
+	if err != nil {
+		return nil, "", "", err
+	}
+	t, err := NewTracker(repo.Host, opts)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return t, repo.Owner, repo.Name, nil
+}
+
+// GitHubTracker creates GitHub issues
+type GitHubTracker struct {
+	Client *github.Client
+}
+
+// NewGitHubTracker returns a GitHub tracker using a GitHub client
+func NewGitHubTracker(client *github.Client) *GitHubTracker {
+	return &GitHubTracker{Client: client}
+}
+
+// CreateIssue implements Tracker
+func (t *GitHubTracker) CreateIssue(owner, repo string, issue *NewIssue) (*Issue, error) {
+	req := &github.IssueRequest{
+		Title: &issue.Title,
+		Body:  &issue.Body,
+	}
+	// GitHub drops the labels, milestone and assignees of the users
+	// without push access
+	if len(issue.Labels) > 0 {
+		if err := t.ensureLabels(owner, repo, issue.Labels); err != nil {
+			return nil, err
+		}
+		req.Labels = &issue.Labels
+	}
+	if issue.Milestone != "" {
+		number, err := t.milestone(owner, repo, issue.Milestone)
+		if err != nil {
+			return nil, err
+		}
+		if number != 0 {
+			req.Milestone = &number
+		}
+	}
+	if len(issue.Assignees) > 0 {
+		req.Assignees = &issue.Assignees
+	}
+	created, _, err := t.Client.Issues.Create(owner, repo, req)
+	if err != nil {
+		return nil, githubError(err)
+	}
+	i := new(Issue)
+	if created.Number != nil {
+		i.Number = *created.Number
+	}
+	if created.HTMLURL != nil {
+		i.URL = *created.HTMLURL
+	}
+	return i, nil
+}
+
+// ensureLabels creates the missing labels of a repository, those the
+// user is not allowed to create being left to the maintainers
+func (t *GitHubTracker) ensureLabels(owner, repo string, labels []string) error {
+	existing, _, err := t.Client.Issues.ListLabels(owner, repo, &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return githubError(err)
+	}
+	names := make(map[string]bool)
+	for _, l := range existing {
+		if l.Name != nil {
+			names[strings.ToLower(*l.Name)] = true
+		}
+	}
+	for _, name := range labels {
+		if names[strings.ToLower(name)] {
+			continue
+		}
+		_, _, err := t.Client.Issues.CreateLabel(owner, repo, &github.Label{Name: github.String(name), Color: github.String(labelColor)})
+		if err = githubError(err); err != nil && !labelRefused(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// milestone returns the number of an open milestone, 0 when missing
+func (t *GitHubTracker) milestone(owner, repo, title string) (int, error) {
+	milestones, _, err := t.Client.Issues.ListMilestones(owner, repo, &github.MilestoneListOptions{
+		State:       "open",
+		ListOptions: github.ListOptions{PerPage: 100},
+	})
+	if err != nil {
+		return 0, githubError(err)
+	}
+	for _, m := range milestones {
+		if m.Title != nil && *m.Title == title && m.Number != nil {
+			return *m.Number, nil
+		}
+	}
+	return 0, nil
+}
+
+// IssueState implements Tracker
+func (t *GitHubTracker) IssueState(owner, repo string, number int) (string, error) {
+	issue, _, err := t.Client.Issues.Get(owner, repo, number)
+	if err != nil {
+		return "", githubError(err)
+	}
+	if issue.State != nil && *issue.State == "closed" {
+		return IssueClosed, nil
+	}
+	return IssueOpen, nil
+}
+
+// Comment implements Tracker
+func (t *GitHubTracker) Comment(owner, repo string, number int, body string) error {
+	_, _, err := t.Client.Issues.CreateComment(owner, repo, number, &github.IssueComment{Body: &body})
+	return githubError(err)
+}
+
+// RepositoryInfo implements Tracker
+func (t *GitHubTracker) RepositoryInfo(owner, repo string) (*RepositoryInfo, error) {
+	// The archived and disabled fields are missing from github.Repository
+	req, err := t.Client.NewRequest("GET", fmt.Sprintf("repos/%s/%s", owner, repo), nil)
+	if err != nil {
+		return nil, err
+	}
+	var r struct {
+		Archived      bool      `json:"archived"`
+		Disabled      bool      `json:"disabled"`
+		HasIssues     bool      `json:"has_issues"`
+		PushedAt      time.Time `json:"pushed_at"`
+		DefaultBranch string    `json:"default_branch"`
+	}
+	if _, err := t.Client.Do(req, &r); err != nil {
+		return nil, githubError(err)
+	}
+	return &RepositoryInfo{
+		Archived:      r.Archived,
+		Disabled:      r.Disabled,
+		HasIssues:     r.HasIssues,
+		PushedAt:      r.PushedAt,
+		DefaultBranch: r.DefaultBranch,
+	}, nil
+}
+
+// FileContent implements Tracker
+func (t *GitHubTracker) FileContent(owner, repo, ref, path string) ([]byte, error) {
+	content, _, err := getContent(t.Client, owner, repo, path, ref)
+	return content, githubError(err)
+}
+
+// OwnIssues implements Tracker. GitHub drops the labels of the users
+// without push access, so issues are only filtered by creator. GitHub App
+// installations can not read their user, their issues are not filtered.
+func (t *GitHubTracker) OwnIssues(owner, repo string, labels []string) ([]*FoundIssue, error) {
+	opts := &github.IssueListByRepoOptions{
+		State:       "all",
+		Sort:        "created",
+		Direction:   "desc",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	user, _, err := t.Client.Users.Get("")
+	switch e := githubError(err).(type) {
+	case nil:
+		if user.Login != nil {
+			opts.Creator = *user.Login
+		}
+	case *TrackerError:
+		if e.StatusCode != http.StatusForbidden && e.StatusCode != http.StatusNotFound {
+			return nil, e
+		}
+	default:
+		return nil, e
+	}
+	issues, _, err := t.Client.Issues.ListByRepo(owner, repo, opts)
+	if err != nil {
+		return nil, githubError(err)
+	}
+	var found []*FoundIssue
+	for _, i := range issues {
+		if i.PullRequestLinks != nil {
+			continue
+		}
+		f := new(FoundIssue)
+		if i.Number != nil {
+			f.Number = *i.Number
+		}
+		if i.HTMLURL != nil {
+			f.URL = *i.HTMLURL
+		}
+		if i.Body != nil {
+			f.Body = *i.Body
+		}
+		found = append(found, f)
+	}
+	return found, nil
+}
+
+// UpdateIssue implements Tracker
+func (t *GitHubTracker) UpdateIssue(owner, repo string, number int, title, body string) error {
+	_, _, err := t.Client.Issues.Edit(owner, repo, number, &github.IssueRequest{Title: &title, Body: &body})
+	return githubError(err)
+}
+
+// labelRefused reports whether a label creation was refused, the user
+// lacking the permission or the label existing already
+func labelRefused(err error) bool {
+	e, ok := err.(*TrackerError)
+	if !ok {
+		return false
+	}
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+// githubError returns the TrackerError of a GitHub API error
+func githubError(err error) error {
+	switch e := err.(type) {
+	case *github.ErrorResponse:
+		return newTrackerError(e.Response, e.Message)
+	case *github.RateLimitError:
+		return newTrackerError(e.Response, e.Message)
+	}
+	return err
+}
+
+// GitLabTracker creates GitLab issues
+type GitLabTracker struct {
+	// BaseURL is the GitLab instance URL, such as https://gitlab.com
+	BaseURL string
+	Token   string
+	Client  *http.Client
+}
+
+// CreateIssue implements Tracker. GitLab creates the missing labels.
+func (t *GitLabTracker) CreateIssue(owner, repo string, issue *NewIssue) (*Issue, error) {
+	params := map[string]interface{}{"title": issue.Title, "description": issue.Body}
+	if len(issue.Labels) > 0 {
+		params["labels"] = strings.Join(issue.Labels, ",")
+	}
+	if issue.Milestone != "" {
+		var milestones []struct {
+			ID int `json:"id"`
+		}
+		u := fmt.Sprintf("%s/milestones?state=active&title=%s", t.projectURL(owner, repo), url.QueryEscape(issue.Milestone))
+		if err := doJSON(t.Client, "GET", u, t.headers(), nil, &milestones); err != nil {
+			return nil, err
+		}
+		if len(milestones) > 0 {
+			params["milestone_id"] = milestones[0].ID
+		}
+	}
+	var assignees []int
+	for _, name := range issue.Assignees {
+		var users []struct {
+			ID int `json:"id"`
+		}
+		u := fmt.Sprintf("%s/api/v4/users?username=%s", t.BaseURL, url.QueryEscape(name))
+		if err := doJSON(t.Client, "GET", u, t.headers(), nil, &users); err != nil {
+			return nil, err
+		}
+		if len(users) > 0 {
+			assignees = append(assignees, users[0].ID)
+		}
+	}
+	if len(assignees) > 0 {
+		params["assignee_ids"] = assignees
+	}
+
+	var created struct {
+		IID    int    `json:"iid"`
+		WebURL string `json:"web_url"`
+	}
+	if err := doJSON(t.Client, "POST", t.issuesURL(owner, repo), t.headers(), params, &created); err != nil {
+		return nil, err
+	}
+	return &Issue{Number: created.IID, URL: created.WebURL}, nil
+}
+
+// IssueState implements Tracker
+func (t *GitLabTracker) IssueState(owner, repo string, number int) (string, error) {
+	var issue struct {
+		State string `json:"state"`
+	}
+	u := fmt.Sprintf("%s/%d", t.issuesURL(owner, repo), number)
+	if err := doJSON(t.Client, "GET", u, t.headers(), nil, &issue); err != nil {
+		return "", err
+	}
+	if issue.State == "closed" {
+		return IssueClosed, nil
+	}
+	return IssueOpen, nil
+}
+
+// Comment implements Tracker
+func (t *GitLabTracker) Comment(owner, repo string, number int, body string) error {
+	u := fmt.Sprintf("%s/%d/notes", t.issuesURL(owner, repo), number)
+	return doJSON(t.Client, "POST", u, t.headers(), map[string]string{"body": body}, &struct{}{})
+}
+
+// RepositoryInfo implements Tracker
+func (t *GitLabTracker) RepositoryInfo(owner, repo string) (*RepositoryInfo, error) {
+	var project struct {
+		Archived       bool      `json:"archived"`
+		IssuesEnabled  bool      `json:"issues_enabled"`
+		LastActivityAt time.Time `json:"last_activity_at"`
+		DefaultBranch  string    `json:"default_branch"`
+	}
+	if err := doJSON(t.Client, "GET", t.projectURL(owner, repo), t.headers(), nil, &project); err != nil {
+		return nil, err
+	}
+	return &RepositoryInfo{
+		Archived:      project.Archived,
+		HasIssues:     project.IssuesEnabled,
+		PushedAt:      project.LastActivityAt,
+		DefaultBranch: project.DefaultBranch,
+	}, nil
+}
+
+// FileContent implements Tracker
+func (t *GitLabTracker) FileContent(owner, repo, ref, path string) ([]byte, error) {
+	u := fmt.Sprintf("%s/repository/files/%s/raw?ref=%s", t.projectURL(owner, repo), url.PathEscape(path), url.QueryEscape(ref))
+	return doRaw(t.Client, u, t.headers())
+}
+
+// OwnIssues implements Tracker
+func (t *GitLabTracker) OwnIssues(owner, repo string, labels []string) ([]*FoundIssue, error) {
+	var issues []struct {
+		IID         int    `json:"iid"`
+		WebURL      string `json:"web_url"`
+		Description string `json:"description"`
+	}
+	u := t.issuesURL(owner, repo) + "?scope=created_by_me&per_page=100"
+	if len(labels) > 0 {
+		u += "&labels=" + url.QueryEscape(strings.Join(labels, ","))
+	}
+	if err := doJSON(t.Client, "GET", u, t.headers(), nil, &issues); err != nil {
+		return nil, err
+	}
+	var found []*FoundIssue
+	for _, i := range issues {
+		found = append(found, &FoundIssue{Issue: Issue{Number: i.IID, URL: i.WebURL}, Body: i.Description})
+	}
+	return found, nil
+}
+
+// UpdateIssue implements Tracker
+func (t *GitLabTracker) UpdateIssue(owner, repo string, number int, title, body string) error {
+	u := fmt.Sprintf("%s/%d", t.issuesURL(owner, repo), number)
+	return doJSON(t.Client, "PUT", u, t.headers(), map[string]string{"title": title, "description": body}, &struct{}{})
+}
+
+func (t *GitLabTracker) projectURL(owner, repo string) string {
+	return t.BaseURL + "/api/v4/projects/" + url.PathEscape(owner+"/"+repo)
+}
+
+func (t *GitLabTracker) issuesURL(owner, repo string) string {
+	return t.projectURL(owner, repo) + "/issues"
+}
+
+func (t *GitLabTracker) headers() map[string]string {
+	return map[string]string{"PRIVATE-TOKEN": t.Token}
+}
+
+// BitbucketTracker creates Bitbucket Cloud issues
+type BitbucketTracker struct {
+	// BaseURL is the API URL, such as https://api.bitbucket.org
+	BaseURL string
+	// Token is an access token, or a username:app-password pair
+	Token  string
+	Client *http.Client
+}
+
+// CreateIssue implements Tracker. Bitbucket issues have no labels and
+// their assignee is an account identifier, so only the milestone is set.
+func (t *BitbucketTracker) CreateIssue(owner, repo string, issue *NewIssue) (*Issue, error) {
+	var created struct {
+		ID    int `json:"id"`
+		Links struct {
+			HTML struct {
+				Href string `json:"href"`
+			} `json:"html"`
+		} `json:"links"`
+	}
+	params := map[string]interface{}{
+		"title":   issue.Title,
+		"content": map[string]string{"raw": issue.Body},
+	}
+	if issue.Milestone != "" {
+		params["milestone"] = map[string]string{"name": issue.Milestone}
+	}
+	if err := doJSON(t.Client, "POST", t.issuesURL(owner, repo), t.headers(), params, &created); err != nil {
+		return nil, err
+	}
+	return &Issue{Number: created.ID, URL: created.Links.HTML.Href}, nil
+}
+
+// bitbucketOpenStates are the Bitbucket issue states still to be handled
+var bitbucketOpenStates = map[string]bool{"new": true, "open": true, "on hold": true, "submitted": true}
+
+// IssueState implements Tracker
+func (t *BitbucketTracker) IssueState(owner, repo string, number int) (string, error) {
+	var issue struct {
+		State string `json:"state"`
+	}
+	u := fmt.Sprintf("%s/%d", t.issuesURL(owner, repo), number)
+	if err := doJSON(t.Client, "GET", u, t.headers(), nil, &issue); err != nil {
+		return "", err
+	}
+	if bitbucketOpenStates[issue.State] {
+		return IssueOpen, nil
+	}
+	return IssueClosed, nil
+}
+
+// Comment implements Tracker
+func (t *BitbucketTracker) Comment(owner, repo string, number int, body string) error {
+	u := fmt.Sprintf("%s/%d/comments", t.issuesURL(owner, repo), number)
+	comment := map[string]interface{}{"content": map[string]string{"raw": body}}
+	return doJSON(t.Client, "POST", u, t.headers(), comment, &struct{}{})
+}
+
+// RepositoryInfo implements Tracker. Bitbucket repositories can not be
+// archived.
+func (t *BitbucketTracker) RepositoryInfo(owner, repo string) (*RepositoryInfo, error) {
+	var r struct {
+		HasIssues  bool      `json:"has_issues"`
+		UpdatedOn  time.Time `json:"updated_on"`
+		MainBranch struct {
+			Name string `json:"name"`
+		} `json:"mainbranch"`
+	}
+	if err := doJSON(t.Client, "GET", t.repositoryURL(owner, repo), t.headers(), nil, &r); err != nil {
+		return nil, err
+	}
+	return &RepositoryInfo{HasIssues: r.HasIssues, PushedAt: r.UpdatedOn, DefaultBranch: r.MainBranch.Name}, nil
+}
+
+// FileContent implements Tracker
+func (t *BitbucketTracker) FileContent(owner, repo, ref, path string) ([]byte, error) {
+	u := fmt.Sprintf("%s/src/%s/%s", t.repositoryURL(owner, repo), url.PathEscape(ref), escapePath(path))
+	return doRaw(t.Client, u, t.headers())
+}
+
+// OwnIssues implements Tracker. Bitbucket issues have no labels.
+func (t *BitbucketTracker) OwnIssues(owner, repo string, labels []string) ([]*FoundIssue, error) {
+	var user struct {
+		UUID string `json:"uuid"`
+	}
+	if err := doJSON(t.Client, "GET", t.BaseURL+"/2.0/user", t.headers(), nil, &user); err != nil {
+		return nil, err
+	}
+	var page struct {
+		Values []struct {
+			ID      int `json:"id"`
+			Content struct {
+				Raw string `json:"raw"`
+			} `json:"content"`
+			Links struct {
+				HTML struct {
+					Href string `json:"href"`
+				} `json:"html"`
+			} `json:"links"`
+		} `json:"values"`
+	}
+	q := fmt.Sprintf("reporter.uuid = %q", user.UUID)
+	u := fmt.Sprintf("%s?pagelen=100&sort=-created_on&q=%s", t.issuesURL(owner, repo), url.QueryEscape(q))
+	if err := doJSON(t.Client, "GET", u, t.headers(), nil, &page); err != nil {
+		return nil, err
+	}
+	var found []*FoundIssue
+	for _, i := range page.Values {
+		found = append(found, &FoundIssue{Issue: Issue{Number: i.ID, URL: i.Links.HTML.Href}, Body: i.Content.Raw})
+	}
+	return found, nil
+}
+
+// UpdateIssue implements Tracker
+func (t *BitbucketTracker) UpdateIssue(owner, repo string, number int, title, body string) error {
+	u := fmt.Sprintf("%s/%d", t.issuesURL(owner, repo), number)
+	issue := map[string]interface{}{"title": title, "content": map[string]string{"raw": body}}
+	return doJSON(t.Client, "PUT", u, t.headers(), issue, &struct{}{})
+}
+
+func (t *BitbucketTracker) repositoryURL(owner, repo string) string {
+	return fmt.Sprintf("%s/2.0/repositories/%s/%s", t.BaseURL, url.PathEscape(owner), url.PathEscape(repo))
+}
+
+func (t *BitbucketTracker) issuesURL(owner, repo string) string {
+	return t.repositoryURL(owner, repo) + "/issues"
+}
+
+func (t *BitbucketTracker) headers() map[string]string {
+	headers := map[string]string{}
+	if user, password, ok := splitCredentials(t.Token); ok {
+		req := &http.Request{Header: http.Header{}}
+		req.SetBasicAuth(user, password)
+		headers["Authorization"] = req.Header.Get("Authorization")
+	} else if t.Token != "" {
+		headers["Authorization"] = "Bearer " + t.Token
+	}
+	return headers
+}
+
+// escapePath escapes the segments of a slash separated path
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for n, s := range segments {
+		segments[n] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// splitCredentials splits a user:password pair
+func splitCredentials(token string) (string, string, bool) {
+	parts := strings.SplitN(token, ":", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// GiteaTracker creates Gitea, and Forgejo, issues
+type GiteaTracker struct {
+	// BaseURL is the Gitea instance URL, such as https://codeberg.org
+	BaseURL string
+	Token   string
+	Client  *http.Client
+}
+
+// CreateIssue implements Tracker
+func (t *GiteaTracker) CreateIssue(owner, repo string, issue *NewIssue) (*Issue, error) {
+	params := map[string]interface{}{"title": issue.Title, "body": issue.Body}
+	if len(issue.Labels) > 0 {
+		ids, err := t.labelIDs(owner, repo, issue.Labels)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) > 0 {
+			params["labels"] = ids
+		}
+	}
+	if issue.Milestone != "" {
+		var milestones []struct {
+			ID    int64  `json:"id"`
+			Title string `json:"title"`
+		}
+		u := fmt.Sprintf("%s/milestones?state=open&name=%s", t.repositoryURL(owner, repo), url.QueryEscape(issue.Milestone))
+		if err := doJSON(t.Client, "GET", u, t.headers(), nil, &milestones); err != nil {
+			return nil, err
+		}
+		for _, m := range milestones {
+			if m.Title == issue.Milestone {
+				params["milestone"] = m.ID
+				break
+			}
+		}
+	}
+	if len(issue.Assignees) > 0 {
+		params["assignees"] = issue.Assignees
+	}
+
+	var created struct {
+		Number  int    `json:"number"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := doJSON(t.Client, "POST", t.issuesURL(owner, repo), t.headers(), params, &created); err != nil {
+		return nil, err
+	}
+	return &Issue{Number: created.Number, URL: created.HTMLURL}, nil
+}
+
+// labelIDs returns the identifiers of labels, creating the missing ones.
+// The labels the user is not allowed to create are left out.
+func (t *GiteaTracker) labelIDs(owner, repo string, labels []string) ([]int64, error) {
+	var existing []struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	}
+	u := t.repositoryURL(owner, repo) + "/labels"
+	if err := doJSON(t.Client, "GET", u+"?limit=50", t.headers(), nil, &existing); err != nil {
+		return nil, err
+	}
+	ids := make(map[string]int64)
+	for _, l := range existing {
+		ids[strings.ToLower(l.Name)] = l.ID
+	}
+	var found []int64
+	for _, name := range labels {
+		id, ok := ids[strings.ToLower(name)]
+		if !ok {
+			var created struct {
+				ID int64 `json:"id"`
+			}
+			err := doJSON(t.Client, "POST", u, t.headers(), map[string]string{"name": name, "color": "#" + labelColor}, &created)
+			if labelRefused(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			id = created.ID
+		}
+		found = append(found, id)
+	}
+	return found, nil
+}
+
+// IssueState implements Tracker
+func (t *GiteaTracker) IssueState(owner, repo string, number int) (string, error) {
+	var issue struct {
+		State string `json:"state"`
+	}
+	u := fmt.Sprintf("%s/%d", t.issuesURL(owner, repo), number)
+	if err := doJSON(t.Client, "GET", u, t.headers(), nil, &issue); err != nil {
+		return "", err
+	}
+	if issue.State == "closed" {
+		return IssueClosed, nil
+	}
+	return IssueOpen, nil
+}
+
+// Comment implements Tracker
+func (t *GiteaTracker) Comment(owner, repo string, number int, body string) error {
+	u := fmt.Sprintf("%s/%d/comments", t.issuesURL(owner, repo), number)
+	return doJSON(t.Client, "POST", u, t.headers(), map[string]string{"body": body}, &struct{}{})
+}
+
+// RepositoryInfo implements Tracker
+func (t *GiteaTracker) RepositoryInfo(owner, repo string) (*RepositoryInfo, error) {
+	var r struct {
+		Archived      bool      `json:"archived"`
+		HasIssues     bool      `json:"has_issues"`
+		UpdatedAt     time.Time `json:"updated_at"`
+		DefaultBranch string    `json:"default_branch"`
+	}
+	if err := doJSON(t.Client, "GET", t.repositoryURL(owner, repo), t.headers(), nil, &r); err != nil {
+		return nil, err
+	}
+	return &RepositoryInfo{Archived: r.Archived, HasIssues: r.HasIssues, PushedAt: r.UpdatedAt, DefaultBranch: r.DefaultBranch}, nil
+}
+
+// FileContent implements Tracker
+func (t *GiteaTracker) FileContent(owner, repo, ref, path string) ([]byte, error) {
+	u := fmt.Sprintf("%s/raw/%s?ref=%s", t.repositoryURL(owner, repo), escapePath(path), url.QueryEscape(ref))
+	return doRaw(t.Client, u, t.headers())
+}
+
+// OwnIssues implements Tracker. The labels the user is not allowed to
+// create are left out of its issues, so they are only filtered by creator.
+func (t *GiteaTracker) OwnIssues(owner, repo string, labels []string) ([]*FoundIssue, error) {
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := doJSON(t.Client, "GET", t.BaseURL+"/api/v1/user", t.headers(), nil, &user); err != nil {
+		return nil, err
+	}
+	var issues []struct {
+		Number  int    `json:"number"`
+		HTMLURL string `json:"html_url"`
+		Body    string `json:"body"`
+	}
+	u := fmt.Sprintf("%s?type=issues&state=all&limit=50&created_by=%s", t.issuesURL(owner, repo), url.QueryEscape(user.Login))
+	if err := doJSON(t.Client, "GET", u, t.headers(), nil, &issues); err != nil {
+		return nil, err
+	}
+	var found []*FoundIssue
+	for _, i := range issues {
+		found = append(found, &FoundIssue{Issue: Issue{Number: i.Number, URL: i.HTMLURL}, Body: i.Body})
+	}
+	return found, nil
+}
+
+// UpdateIssue implements Tracker
+func (t *GiteaTracker) UpdateIssue(owner, repo string, number int, title, body string) error {
+	u := fmt.Sprintf("%s/%d", t.issuesURL(owner, repo), number)
+	return doJSON(t.Client, "PATCH", u, t.headers(), map[string]string{"title": title, "body": body}, &struct{}{})
+}
+
+func (t *GiteaTracker) repositoryURL(owner, repo string) string {
+	return fmt.Sprintf("%s/api/v1/repos/%s/%s", t.BaseURL, url.PathEscape(owner), url.PathEscape(repo))
+}
+
+func (t *GiteaTracker) issuesURL(owner, repo string) string {
+	return t.repositoryURL(owner, repo) + "/issues"
+}
+
+func (t *GiteaTracker) headers() map[string]string {
+	headers := map[string]string{}
+	if t.Token != "" {
+		headers["Authorization"] = "token " + t.Token
+	}
+	return headers
+}
+
+// doJSON sends a request, with a JSON document when in is not nil, and
+// decodes the JSON response
+func doJSON(client *http.Client, method, u string, headers map[string]string, in interface{}, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	data, err := doRequest(client, req, headers)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// doRaw returns the content of a raw file URL, or nil when it does not
+// exist
+func doRaw(client *http.Client, u string, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	data, err := doRequest(client, req, headers)
+	if e, ok := err.(*TrackerError); ok && e.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	return data, err
+}
+
+// doRequest sends a request and returns the response body, a
+// *TrackerError being returned for unsuccessful statuses
+func doRequest(client *http.Client, req *http.Request, headers map[string]string) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req.Header.Set("User-Agent", "npm-blame")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, newTrackerError(resp, fmt.Sprintf("%s %s: %s", req.Method, req.URL, strings.TrimSpace(string(data))))
+	}
+	return data, nil
+}
+
+// TrackerError is an error response of a tracker API
+type TrackerError struct {
+	StatusCode int
+	Message    string
+	// RetryAt is the time the Retry-After or rate limit headers of the
+	// response allow the next request at, zero without them
+	RetryAt time.Time
+}
+
+func (e *TrackerError) Error() string {
+	return fmt.Sprintf("%d %s", e.StatusCode, e.Message)
+}
+
+// Temporary reports whether the request may succeed when retried:
+// rate limited requests and server errors
+func (e *TrackerError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500 || !e.RetryAt.IsZero()
+}
+
+// newTrackerError returns the error of a tracker response, reading its
+// Retry-After header, or its exhausted X-RateLimit-* or RateLimit-*
+// headers as sent by GitLab
+func newTrackerError(resp *http.Response, message string) *TrackerError {
+	e := &TrackerError{Message: message}
+	if resp == nil {
+		return e
+	}
+	e.StatusCode = resp.StatusCode
+	h := resp.Header
+	if after := h.Get("Retry-After"); after != "" {
+		if seconds, err := strconv.Atoi(after); err == nil {
+			e.RetryAt = time.Now().Add(time.Duration(seconds) * time.Second)
+		} else if date, err := http.ParseTime(after); err == nil {
+			e.RetryAt = date
+		}
+		return e
+	}
+	for _, prefix := range []string{"X-RateLimit-", "RateLimit-"} {
+		if h.Get(prefix+"Remaining") != "0" {
+			continue
+		}
+		if reset, err := strconv.ParseInt(h.Get(prefix+"Reset"), 10, 64); err == nil {
+			e.RetryAt = time.Unix(reset, 0)
+			return e
+		}
+	}
+	return e
+}
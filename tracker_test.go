@@ -0,0 +1,617 @@
+package npmblame
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// trackerServer answers a single issue creation, checking its request
+func trackerServer(t *testing.T, path string, header string, want map[string]interface{}, response string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.EscapedPath() != path {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.EscapedPath())
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.Header.Get("Authorization") + r.Header.Get("PRIVATE-TOKEN"); got != header {
+			t.Errorf("Authentication = %q, want %q", got, header)
+		}
+		body := make(map[string]interface{})
+		json.NewDecoder(r.Body).Decode(&body)
+		if !reflect.DeepEqual(body, want) {
+			t.Errorf("Request body = %v, want %v", body, want)
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, response)
+	}))
+}
+
+func TestTrackers(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		path     string
+		header   string
+		body     map[string]interface{}
+		response string
+		tracker  func(url string) Tracker
+	}{
+		{
+			name:     "GitLab",
+			path:     "/api/v4/projects/group%2Fsub%2Frepo/issues",
+			header:   "secret",
+			body:     map[string]interface{}{"title": "Title", "description": "Body"},
+			response: `{"iid": 3, "web_url": "https://gitlab.com/group/sub/repo/-/issues/3"}`,
+			tracker: func(url string) Tracker {
+				return &GitLabTracker{BaseURL: url, Token: "secret"}
+			},
+		},
+		{
+			name:     "Bitbucket",
+			path:     "/2.0/repositories/group/sub%2Frepo/issues",
+			header:   "Basic dXNlcjpzZWNyZXQ=",
+			body:     map[string]interface{}{"title": "Title", "content": map[string]interface{}{"raw": "Body"}},
+			response: `{"id": 3, "links": {"html": {"href": "https://bitbucket.org/group/repo/issues/3"}}}`,
+			tracker: func(url string) Tracker {
+				return &BitbucketTracker{BaseURL: url, Token: "user:secret"}
+			},
+		},
+		{
+			name:     "Gitea",
+			path:     "/api/v1/repos/group/sub%2Frepo/issues",
+			header:   "token secret",
+			body:     map[string]interface{}{"title": "Title", "body": "Body"},
+			response: `{"number": 3, "html_url": "https://codeberg.org/group/repo/issues/3"}`,
+			tracker: func(url string) Tracker {
+				return &GiteaTracker{BaseURL: url, Token: "secret"}
+			},
+		},
+		{
+			name:     "GitHub",
+			path:     "/repos/group/sub/repo/issues",
+			body:     map[string]interface{}{"title": "Title", "body": "Body"},
+			response: `{"number": 3, "html_url": "https://github.com/group/repo/issues/3"}`,
+			tracker: func(u string) Tracker {
+				client := github.NewClient(nil)
+				client.BaseURL, _ = url.Parse(u + "/")
+				return NewGitHubTracker(client)
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := trackerServer(t, tc.path, tc.header, tc.body, tc.response)
+			defer server.Close()
+
+			r := &Report{Title: "Title", Body: "Body", Owner: "group", Repository: "sub/repo"}
+			issue, err := r.Send(tc.tracker(server.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if issue.Number != 3 || issue.URL == "" {
+				t.Errorf("Wrong issue %+v", issue)
+			}
+		})
+	}
+}
+
+func TestTrackerLifecycle(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		issue       string
+		state       string
+		comments    string
+		commentBody map[string]interface{}
+		tracker     func(url string) Tracker
+	}{
+		{
+			name:        "GitLab",
+			issue:       "/api/v4/projects/group%2Frepo/issues/3",
+			state:       `{"state": "closed"}`,
+			comments:    "/api/v4/projects/group%2Frepo/issues/3/notes",
+			commentBody: map[string]interface{}{"body": "Thanks"},
+			tracker:     func(url string) Tracker { return &GitLabTracker{BaseURL: url} },
+		},
+		{
+			name:        "Bitbucket",
+			issue:       "/2.0/repositories/group/repo/issues/3",
+			state:       `{"state": "resolved"}`,
+			comments:    "/2.0/repositories/group/repo/issues/3/comments",
+			commentBody: map[string]interface{}{"content": map[string]interface{}{"raw": "Thanks"}},
+			tracker:     func(url string) Tracker { return &BitbucketTracker{BaseURL: url} },
+		},
+		{
+			name:        "Gitea",
+			issue:       "/api/v1/repos/group/repo/issues/3",
+			state:       `{"state": "closed"}`,
+			comments:    "/api/v1/repos/group/repo/issues/3/comments",
+			commentBody: map[string]interface{}{"body": "Thanks"},
+			tracker:     func(url string) Tracker { return &GiteaTracker{BaseURL: url} },
+		},
+		{
+			name:        "GitHub",
+			issue:       "/repos/group/repo/issues/3",
+			state:       `{"state": "closed"}`,
+			comments:    "/repos/group/repo/issues/3/comments",
+			commentBody: map[string]interface{}{"body": "Thanks"},
+			tracker: func(u string) Tracker {
+				client := github.NewClient(nil)
+				client.BaseURL, _ = url.Parse(u + "/")
+				return NewGitHubTracker(client)
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var commented bool
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == "GET" && r.URL.EscapedPath() == tc.issue:
+					fmt.Fprint(w, tc.state)
+				case r.Method == "POST" && r.URL.EscapedPath() == tc.comments:
+					body := make(map[string]interface{})
+					json.NewDecoder(r.Body).Decode(&body)
+					if !reflect.DeepEqual(body, tc.commentBody) {
+						t.Errorf("Comment body = %v, want %v", body, tc.commentBody)
+					}
+					commented = true
+					w.WriteHeader(http.StatusCreated)
+					fmt.Fprint(w, `{}`)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			tracker := tc.tracker(server.URL)
+			state, err := tracker.IssueState("group", "repo", 3)
+			if err != nil || state != IssueClosed {
+				t.Errorf("Expected a closed issue got %q %v", state, err)
+			}
+			if err := tracker.Comment("group", "repo", 3, "Thanks"); err != nil || !commented {
+				t.Errorf("Expected a comment got %v", err)
+			}
+			if _, err := tracker.IssueState("group", "repo", 4); err == nil {
+				t.Error("Expected an error for a missing issue")
+			}
+		})
+	}
+}
+
+func TestTrackerRepositoryInfo(t *testing.T) {
+	pushed := time.Date(2019, 5, 1, 10, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name     string
+		path     string
+		response string
+		expected RepositoryInfo
+		tracker  func(url string) Tracker
+	}{
+		{
+			name:     "GitLab",
+			path:     "/api/v4/projects/group%2Frepo",
+			response: `{"archived": true, "issues_enabled": true, "last_activity_at": "2019-05-01T10:00:00Z", "default_branch": "main"}`,
+			expected: RepositoryInfo{Archived: true, HasIssues: true, PushedAt: pushed, DefaultBranch: "main"},
+			tracker:  func(url string) Tracker { return &GitLabTracker{BaseURL: url} },
+		},
+		{
+			name:     "Bitbucket",
+			path:     "/2.0/repositories/group/repo",
+			response: `{"has_issues": false, "updated_on": "2019-05-01T10:00:00Z", "mainbranch": {"name": "main"}}`,
+			expected: RepositoryInfo{PushedAt: pushed, DefaultBranch: "main"},
+			tracker:  func(url string) Tracker { return &BitbucketTracker{BaseURL: url} },
+		},
+		{
+			name:     "Gitea",
+			path:     "/api/v1/repos/group/repo",
+			response: `{"archived": false, "has_issues": true, "updated_at": "2019-05-01T10:00:00Z", "default_branch": "main"}`,
+			expected: RepositoryInfo{HasIssues: true, PushedAt: pushed, DefaultBranch: "main"},
+			tracker:  func(url string) Tracker { return &GiteaTracker{BaseURL: url} },
+		},
+		{
+			name:     "GitHub",
+			path:     "/repos/group/repo",
+			response: `{"archived": true, "disabled": true, "has_issues": true, "pushed_at": "2019-05-01T10:00:00Z", "default_branch": "main"}`,
+			expected: RepositoryInfo{Archived: true, Disabled: true, HasIssues: true, PushedAt: pushed, DefaultBranch: "main"},
+			tracker: func(u string) Tracker {
+				client := github.NewClient(nil)
+				client.BaseURL, _ = url.Parse(u + "/")
+				return NewGitHubTracker(client)
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != "GET" || r.URL.EscapedPath() != tc.path {
+					http.NotFound(w, r)
+					return
+				}
+				fmt.Fprint(w, tc.response)
+			}))
+			defer server.Close()
+
+			tracker := tc.tracker(server.URL)
+			info, err := tracker.RepositoryInfo("group", "repo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.PushedAt.Equal(tc.expected.PushedAt) || info.Archived != tc.expected.Archived ||
+				info.Disabled != tc.expected.Disabled || info.HasIssues != tc.expected.HasIssues ||
+				info.DefaultBranch != tc.expected.DefaultBranch {
+				t.Errorf("Expected %+v got %+v", tc.expected, info)
+			}
+			_, err = tracker.RepositoryInfo("group", "missing")
+			if e, ok := err.(*TrackerError); !ok || e.StatusCode != http.StatusNotFound {
+				t.Errorf("Expected a not found error got %v", err)
+			}
+		})
+	}
+}
+
+func TestTrackerFileContent(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		path     string
+		query    string
+		response string
+		tracker  func(url string) Tracker
+	}{
+		{
+			name:     "GitLab",
+			path:     "/api/v4/projects/group%2Frepo/repository/files/packages%2Fa%2Fpackage.json/raw",
+			query:    "ref=main",
+			response: `{"name": "a"}`,
+			tracker:  func(url string) Tracker { return &GitLabTracker{BaseURL: url} },
+		},
+		{
+			name:     "Bitbucket",
+			path:     "/2.0/repositories/group/repo/src/main/packages/a/package.json",
+			response: `{"name": "a"}`,
+			tracker:  func(url string) Tracker { return &BitbucketTracker{BaseURL: url} },
+		},
+		{
+			name:     "Gitea",
+			path:     "/api/v1/repos/group/repo/raw/packages/a/package.json",
+			query:    "ref=main",
+			response: `{"name": "a"}`,
+			tracker:  func(url string) Tracker { return &GiteaTracker{BaseURL: url} },
+		},
+		{
+			name:     "GitHub",
+			path:     "/repos/group/repo/contents/packages/a/package.json",
+			query:    "ref=main",
+			response: `{"type": "file", "encoding": "base64", "content": "eyJuYW1lIjogImEifQ=="}`,
+			tracker: func(u string) Tracker {
+				client := github.NewClient(nil)
+				client.BaseURL, _ = url.Parse(u + "/")
+				return NewGitHubTracker(client)
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.EscapedPath() != tc.path || r.URL.RawQuery != tc.query {
+					http.NotFound(w, r)
+					return
+				}
+				fmt.Fprint(w, tc.response)
+			}))
+			defer server.Close()
+
+			tracker := tc.tracker(server.URL)
+			content, err := tracker.FileContent("group", "repo", "main", "packages/a/package.json")
+			if err != nil || string(content) != `{"name": "a"}` {
+				t.Errorf("Wrong content %q %v", content, err)
+			}
+			content, err = tracker.FileContent("group", "repo", "main", "packages/a/.npmignore")
+			if err != nil || content != nil {
+				t.Errorf("Expected no content got %q %v", content, err)
+			}
+		})
+	}
+}
+
+func TestTrackerOwnIssues(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// user is the path and response of the authenticated user
+		user, userResponse string
+		list, query        string
+		listResponse       string
+		update, method     string
+		body               map[string]interface{}
+		tracker            func(url string) Tracker
+	}{
+		{
+			name:         "GitLab",
+			list:         "/api/v4/projects/group%2Frepo/issues",
+			query:        "scope=created_by_me&per_page=100&labels=npm-blame%2Cbloat",
+			listResponse: `[{"iid": 3, "web_url": "https://gitlab.com/group/repo/-/issues/3", "description": "Body"}]`,
+			update:       "/api/v4/projects/group%2Frepo/issues/3",
+			method:       "PUT",
+			body:         map[string]interface{}{"title": "Title", "description": "New body"},
+			tracker:      func(url string) Tracker { return &GitLabTracker{BaseURL: url} },
+		},
+		{
+			name:         "Bitbucket",
+			user:         "/2.0/user",
+			userResponse: `{"uuid": "{me}"}`,
+			list:         "/2.0/repositories/group/repo/issues",
+			query:        "pagelen=100&sort=-created_on&q=" + url.QueryEscape(`reporter.uuid = "{me}"`),
+			listResponse: `{"values": [{"id": 3, "content": {"raw": "Body"}, "links": {"html": {"href": "https://bitbucket.org/group/repo/issues/3"}}}]}`,
+			update:       "/2.0/repositories/group/repo/issues/3",
+			method:       "PUT",
+			body:         map[string]interface{}{"title": "Title", "content": map[string]interface{}{"raw": "New body"}},
+			tracker:      func(url string) Tracker { return &BitbucketTracker{BaseURL: url} },
+		},
+		{
+			name:         "Gitea",
+			user:         "/api/v1/user",
+			userResponse: `{"login": "me"}`,
+			list:         "/api/v1/repos/group/repo/issues",
+			query:        "type=issues&state=all&limit=50&created_by=me",
+			listResponse: `[{"number": 3, "html_url": "https://codeberg.org/group/repo/issues/3", "body": "Body"}]`,
+			update:       "/api/v1/repos/group/repo/issues/3",
+			method:       "PATCH",
+			body:         map[string]interface{}{"title": "Title", "body": "New body"},
+			tracker:      func(url string) Tracker { return &GiteaTracker{BaseURL: url} },
+		},
+		{
+			name:         "GitHub",
+			user:         "/user",
+			userResponse: `{"login": "me"}`,
+			list:         "/repos/group/repo/issues",
+			query:        "creator=me&direction=desc&per_page=100&sort=created&state=all",
+			listResponse: `[{"number": 3, "html_url": "https://github.com/group/repo/issues/3", "body": "Body"},
+				{"number": 2, "body": "Pull request", "pull_request": {"url": "https://github.com/group/repo/pull/2"}}]`,
+			update: "/repos/group/repo/issues/3",
+			method: "PATCH",
+			body:   map[string]interface{}{"title": "Title", "body": "New body"},
+			tracker: func(u string) Tracker {
+				client := github.NewClient(nil)
+				client.BaseURL, _ = url.Parse(u + "/")
+				return NewGitHubTracker(client)
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == "GET" && r.URL.EscapedPath() == tc.user:
+					fmt.Fprint(w, tc.userResponse)
+				case r.Method == "GET" && r.URL.EscapedPath() == tc.list:
+					if r.URL.RawQuery != tc.query {
+						t.Errorf("Query = %s, want %s", r.URL.RawQuery, tc.query)
+					}
+					fmt.Fprint(w, tc.listResponse)
+				case r.Method == tc.method && r.URL.EscapedPath() == tc.update:
+					body := make(map[string]interface{})
+					json.NewDecoder(r.Body).Decode(&body)
+					if !reflect.DeepEqual(body, tc.body) {
+						t.Errorf("Request body = %v, want %v", body, tc.body)
+					}
+					fmt.Fprint(w, `{}`)
+				default:
+					t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			tracker := tc.tracker(server.URL)
+			found, err := tracker.OwnIssues("group", "repo", []string{"npm-blame", "bloat"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(found) != 1 || found[0].Number != 3 || found[0].URL == "" || found[0].Body != "Body" {
+				t.Errorf("Wrong issues %+v", found)
+			}
+			if err := tracker.UpdateIssue("group", "repo", 3, "Title", "New body"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestTrackerIssueMetadata(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		responses map[string]string
+		issue     string
+		expected  map[string]interface{}
+		tracker   func(url string) Tracker
+	}{
+		{
+			name: "GitHub",
+			responses: map[string]string{
+				"GET /repos/group/repo/labels":     `[{"name": "Bug"}]`,
+				"POST /repos/group/repo/labels":    "403",
+				"GET /repos/group/repo/milestones": `[{"number": 1, "title": "v1"}, {"number": 2, "title": "v2"}]`,
+			},
+			issue: "/repos/group/repo/issues",
+			expected: map[string]interface{}{
+				"title": "Title", "body": "Body", "labels": []interface{}{"bug", "npm-blame"},
+				"milestone": 2.0, "assignees": []interface{}{"me"},
+			},
+			tracker: func(u string) Tracker {
+				client := github.NewClient(nil)
+				client.BaseURL, _ = url.Parse(u + "/")
+				return NewGitHubTracker(client)
+			},
+		},
+		{
+			name: "GitLab",
+			responses: map[string]string{
+				"GET /api/v4/projects/group%2Frepo/milestones": `[{"id": 12}]`,
+				"GET /api/v4/users":                            `[{"id": 7}]`,
+			},
+			issue: "/api/v4/projects/group%2Frepo/issues",
+			expected: map[string]interface{}{
+				"title": "Title", "description": "Body", "labels": "bug,npm-blame",
+				"milestone_id": 12.0, "assignee_ids": []interface{}{7.0},
+			},
+			tracker: func(url string) Tracker { return &GitLabTracker{BaseURL: url} },
+		},
+		{
+			name:  "Bitbucket",
+			issue: "/2.0/repositories/group/repo/issues",
+			expected: map[string]interface{}{
+				"title": "Title", "content": map[string]interface{}{"raw": "Body"},
+				"milestone": map[string]interface{}{"name": "v2"},
+			},
+			tracker: func(url string) Tracker { return &BitbucketTracker{BaseURL: url} },
+		},
+		{
+			name: "Gitea",
+			responses: map[string]string{
+				"GET /api/v1/repos/group/repo/labels":     `[{"id": 3, "name": "Bug"}]`,
+				"POST /api/v1/repos/group/repo/labels":    `{"id": 4}`,
+				"GET /api/v1/repos/group/repo/milestones": `[{"id": 5, "title": "v2"}]`,
+			},
+			issue: "/api/v1/repos/group/repo/issues",
+			expected: map[string]interface{}{
+				"title": "Title", "body": "Body", "labels": []interface{}{3.0, 4.0},
+				"milestone": 5.0, "assignees": []interface{}{"me"},
+			},
+			tracker: func(url string) Tracker { return &GiteaTracker{BaseURL: url} },
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == "POST" && r.URL.EscapedPath() == tc.issue {
+					body := make(map[string]interface{})
+					json.NewDecoder(r.Body).Decode(&body)
+					if !reflect.DeepEqual(body, tc.expected) {
+						t.Errorf("Issue = %v, want %v", body, tc.expected)
+					}
+					w.WriteHeader(http.StatusCreated)
+					fmt.Fprint(w, `{}`)
+					return
+				}
+				response, ok := tc.responses[r.Method+" "+r.URL.EscapedPath()]
+				if !ok {
+					t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+					http.NotFound(w, r)
+					return
+				}
+				if status, err := strconv.Atoi(response); err == nil {
+					w.WriteHeader(status)
+					fmt.Fprint(w, `{"message": "Forbidden"}`)
+					return
+				}
+				fmt.Fprint(w, response)
+			}))
+			defer server.Close()
+
+			_, err := tc.tracker(server.URL).CreateIssue("group", "repo", &NewIssue{
+				Title:     "Title",
+				Body:      "Body",
+				Labels:    []string{"bug", "npm-blame"},
+				Milestone: "v2",
+				Assignees: []string{"me"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestTrackerErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "401 Unauthorized"}`, http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	tracker := &GiteaTracker{BaseURL: server.URL}
+	if _, err := tracker.CreateIssue("owner", "repo", &NewIssue{Title: "Title", Body: "Body"}); err == nil {
+		t.Error("Expected an authentication error")
+	}
+}
+
+func TestTrackerFor(t *testing.T) {
+	opts := TrackerOptions{
+		Hosts:  map[string]string{"git.example.com": Gitea, "github.example.com": GitHub},
+		Tokens: map[string]string{"gitlab.com": "secret"},
+	}
+	for _, tc := range []struct {
+		url, owner, repo string
+		tracker          Tracker
+	}{
+		{"https://github.com/owner/repo.git", "owner", "repo", &GitHubTracker{}},
+		{"https://gitlab.com/group/sub/repo/-/issues", "group/sub", "repo", &GitLabTracker{}},
+		{"https://bitbucket.org/owner/repo/issues", "owner", "repo", &BitbucketTracker{}},
+		{"https://codeberg.org/owner/repo", "owner", "repo", &GiteaTracker{}},
+		{"https://git.example.com/owner/repo", "owner", "repo", &GiteaTracker{}},
+		{"https://github.example.com/owner/repo", "owner", "repo", &GitHubTracker{}},
+		{"owner/repo", "owner", "repo", &GitHubTracker{}},
+		{"git+ssh://git@gitlab.com/group/repo.git", "group", "repo", &GitLabTracker{}},
+	} {
+		tracker, owner, repo, err := TrackerFor(tc.url, opts)
+		if err != nil {
+			t.Errorf("%s: %v", tc.url, err)
+			continue
+		}
+		if reflect.TypeOf(tracker) != reflect.TypeOf(tc.tracker) || owner != tc.owner || repo != tc.repo {
+			t.Errorf("%s: got %T %s/%s", tc.url, tracker, owner, repo)
+		}
+	}
+
+	if tracker, _, _, _ := TrackerFor("https://gitlab.com/group/repo", opts); tracker.(*GitLabTracker).Token != "secret" {
+		t.Error("The host token should be used")
+	}
+	if tracker, _, _, _ := TrackerFor("https://github.example.com/owner/repo", opts); tracker.(*GitHubTracker).Client.BaseURL.String() != "https://github.example.com/api/v3/" {
+		t.Error("GitHub Enterprise should use its own API URL")
+	}
+	for _, invalid := range []string{"https://unknown.org/owner/repo", "https://github.com/repo", "gist:1234"} {
+		if _, _, _, err := TrackerFor(invalid, opts); err == nil {
+			t.Errorf("Expected an error for %s", invalid)
+		}
+	}
+}
+
+func TestNewTrackerError(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	for _, tc := range []struct {
+		name      string
+		status    int
+		header    http.Header
+		retry     bool
+		temporary bool
+	}{
+		{"Retry-After", http.StatusForbidden, http.Header{"Retry-After": {"60"}}, true, true},
+		{"GitHub rate limit", http.StatusForbidden, http.Header{
+			"X-Ratelimit-Remaining": {"0"},
+			"X-Ratelimit-Reset":     {strconv.FormatInt(reset.Unix(), 10)},
+		}, true, true},
+		{"GitLab rate limit", http.StatusTooManyRequests, http.Header{
+			"Ratelimit-Remaining": {"0"},
+			"Ratelimit-Reset":     {strconv.FormatInt(reset.Unix(), 10)},
+		}, true, true},
+		{"Remaining requests", http.StatusForbidden, http.Header{
+			"X-Ratelimit-Remaining": {"10"},
+			"X-Ratelimit-Reset":     {strconv.FormatInt(reset.Unix(), 10)},
+		}, false, false},
+		{"Server error", http.StatusBadGateway, http.Header{}, false, true},
+		{"Not found", http.StatusNotFound, http.Header{}, false, false},
+	} {
+		e := newTrackerError(&http.Response{StatusCode: tc.status, Header: tc.header}, tc.name)
+		if !e.RetryAt.IsZero() != tc.retry || e.Temporary() != tc.temporary {
+			t.Errorf("%s: got retry at %s, temporary %t", tc.name, e.RetryAt, e.Temporary())
+		}
+	}
+
+	e := newTrackerError(&http.Response{StatusCode: http.StatusForbidden, Header: http.Header{
+		"X-Ratelimit-Remaining": {"0"},
+		"X-Ratelimit-Reset":     {strconv.FormatInt(reset.Unix(), 10)},
+	}}, "API rate limit exceeded")
+	if !e.RetryAt.Equal(reset) || e.Error() != "403 API rate limit exceeded" {
+		t.Errorf("Wrong error %s retrying at %s", e, e.RetryAt)
+	}
+}
@@ -0,0 +1,174 @@
+package npmblame
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Upgrade is a newer version of a blamed package, blamed from its
+// registry tarball
+type Upgrade struct {
+	Package   string `json:"package"`
+	Installed string `json:"installed"`
+	// Version is empty when no newer version is published
+	Version string `json:"version,omitempty"`
+	// Major is set for the upgrades to another major version
+	Major bool `json:"major,omitempty"`
+	// BlamedBytes are the blamed bytes of the installed version, and
+	// UpgradeBlamedBytes those of the upgrade
+	BlamedBytes        int64 `json:"blamed_bytes"`
+	UpgradeBlamedBytes int64 `json:"upgrade_blamed_bytes"`
+	// Removed is the waste removed by upgrading, negative when the
+	// upgrade adds waste
+	Removed int64                `json:"removed"`
+	Errors  map[PackageError]int `json:"errors,omitempty"`
+	// Error is the registry error of the package
+	Error string `json:"error,omitempty"`
+}
+
+// Upgrades are the upgrades of the blamed packages, the most useful first
+type Upgrades []*Upgrade
+
+// upgradeCandidates returns the newest version of the installed major
+// version and the latest version, when newer than the installed one.
+// Prereleases are left out.
+func upgradeCandidates(p *Packument, installed string) []*PackageVersion {
+	current, err := parseVersion(installed)
+	if err != nil {
+		return nil
+	}
+	var sameMajor *PackageVersion
+	var sameMajorVersion version
+	for s, pv := range p.Versions {
+		v, err := parseVersion(s)
+		if err != nil || v.pre != "" || v.major != current.major || v.compare(current) <= 0 {
+			continue
+		}
+		if sameMajor == nil || v.compare(sameMajorVersion) > 0 {
+			sameMajor, sameMajorVersion = pv, v
+		}
+	}
+
+	var candidates []*PackageVersion
+	if sameMajor != nil {
+		candidates = append(candidates, sameMajor)
+	}
+	if latest, ok := p.Versions[p.DistTags["latest"]]; ok && latest != sameMajor {
+		if v, err := parseVersion(latest.Version); err == nil && v.compare(current) > 0 {
+			candidates = append(candidates, latest)
+		}
+	}
+	return candidates
+}
+
+// Advise blames the newer versions of every blamed package of a result:
+// the newest version of its installed major version, and its latest
+// version. Each installed version is advised once, and registry errors
+// are kept in the upgrades of their package. The suppressions applied to
+// the result, if any, are applied to the tarballs too.
+func (r *Registry) Advise(result *Result, suppressions *Suppressions) Upgrades {
+	var upgrades Upgrades
+	packuments := make(map[string]*Packument)
+	seen := make(map[string]bool)
+	for _, i := range result.Instances {
+		key := i.Name + "@" + i.Version
+		if len(i.Errors) == 0 || seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		p, ok := packuments[i.Name]
+		if !ok {
+			var err error
+			if p, err = r.Packument(i.Name); err != nil {
+				upgrades = append(upgrades, &Upgrade{Package: i.Name, Installed: i.Version, BlamedBytes: i.BlamedBytes(), Error: err.Error()})
+				continue
+			}
+			packuments[i.Name] = p
+		}
+
+		candidates := upgradeCandidates(p, i.Version)
+		if len(candidates) == 0 {
+			upgrades = append(upgrades, &Upgrade{Package: i.Name, Installed: i.Version, BlamedBytes: i.BlamedBytes()})
+			continue
+		}
+		current, _ := parseVersion(i.Version)
+		for _, pv := range candidates {
+			u := &Upgrade{Package: i.Name, Installed: i.Version, Version: pv.Version, BlamedBytes: i.BlamedBytes()}
+			v, _ := parseVersion(pv.Version)
+			u.Major = v.major != current.major
+			blamed, err := r.BlameTarball(pv)
+			if err != nil {
+				u.Error = err.Error()
+			} else {
+				if suppressions != nil {
+					suppressions.Apply(&Result{Packages: NewNpmPackages(), Instances: []*Instance{blamed}}, time.Now())
+				}
+				u.UpgradeBlamedBytes = blamed.BlamedBytes()
+				u.Removed = u.BlamedBytes - u.UpgradeBlamedBytes
+				u.Errors = blamed.Errors
+			}
+			upgrades = append(upgrades, u)
+		}
+	}
+
+	sort.SliceStable(upgrades, func(a, b int) bool {
+		return upgrades[a].Removed > upgrades[b].Removed
+	})
+	return upgrades
+}
+
+// WriteJSON writes the upgrades as indented JSON
+func (u Upgrades) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(u)
+}
+
+// String returns the printable representation of the Upgrades
+func (u Upgrades) String() string {
+	buf := &bytes.Buffer{}
+	if len(u) == 0 {
+		fmt.Fprintln(buf, "No blamed package.")
+		return buf.String()
+	}
+	for _, up := range u {
+		fmt.Fprintf(buf, "%s@%s: ", up.Package, up.Installed)
+		major := ""
+		if up.Major {
+			major = " (major)"
+		}
+		switch {
+		case up.Error != "" && up.Version == "":
+			fmt.Fprintf(buf, "registry error. %s\n", up.Error)
+		case up.Error != "":
+			fmt.Fprintf(buf, "upgrade to %s%s can not be checked. %s\n", up.Version, major, up.Error)
+		case up.Version == "":
+			fmt.Fprintf(buf, "no newer version, %s of waste\n", formatBytes(up.BlamedBytes))
+		case up.Removed > 0:
+			fmt.Fprintf(buf, "upgrade to %s%s removes %s of waste\n", up.Version, major, formatBytes(up.Removed))
+		case up.Removed < 0:
+			fmt.Fprintf(buf, "upgrade to %s%s adds %s of waste\n", up.Version, major, formatBytes(-up.Removed))
+		default:
+			fmt.Fprintf(buf, "upgrade to %s%s keeps the %s of waste\n", up.Version, major, formatBytes(up.BlamedBytes))
+		}
+	}
+	// The best upgrade of each installed version counts
+	best := make(map[string]int64)
+	for _, up := range u {
+		key := up.Package + "@" + up.Installed
+		if up.Error == "" && up.Removed > best[key] {
+			best[key] = up.Removed
+		}
+	}
+	var removable int64
+	for _, removed := range best {
+		removable += removed
+	}
+	fmt.Fprintf(buf, "\nUpgrading removes up to %s of waste.\n", formatBytes(removable))
+	return buf.String()
+}
@@ -0,0 +1,112 @@
+package npmblame
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUpgradeCandidates(t *testing.T) {
+	p := &Packument{DistTags: map[string]string{"latest": "2.1.0"}, Versions: make(map[string]*PackageVersion)}
+	for _, v := range []string{"1.0.0", "1.2.0", "1.10.0", "1.11.0-beta.1", "2.0.0", "2.1.0", "3.0.0-rc.1"} {
+		p.Versions[v] = &PackageVersion{Version: v}
+	}
+	for _, tc := range []struct {
+		installed string
+		expected  []string
+	}{
+		{"1.2.0", []string{"1.10.0", "2.1.0"}},
+		{"2.0.0", []string{"2.1.0"}},
+		{"2.1.0", nil},
+		{"not a version", nil},
+	} {
+		var got []string
+		for _, v := range upgradeCandidates(p, tc.installed) {
+			got = append(got, v.Version)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.expected) {
+			t.Errorf("%s: expected %v got %v", tc.installed, tc.expected, got)
+		}
+	}
+}
+
+func TestAdvise(t *testing.T) {
+	packument := func(name string, versions ...string) string {
+		p := map[string]interface{}{"name": name, "dist-tags": map[string]string{"latest": versions[len(versions)-1]}}
+		vs := make(map[string]interface{})
+		for _, v := range versions {
+			vs[v] = map[string]interface{}{"name": name, "version": v, "dist": map[string]string{"tarball": "{{server}}/" + name + "-" + v + ".tgz"}}
+		}
+		p["versions"] = vs
+		data, _ := json.Marshal(p)
+		return string(data)
+	}
+	packuments := map[string]string{
+		"/bloated": packument("bloated", "1.0.0", "1.1.0", "2.0.0"),
+		"/stale":   packument("stale", "1.0.0"),
+		"/icons":   packument("icons", "1.0.0", "1.0.1"),
+	}
+	tarballs := map[string][]byte{
+		"/bloated-1.1.0.tgz": testTarball(map[string]string{"index.js": "1", "test/a.js": strings.Repeat("t", 1000)}),
+		"/bloated-2.0.0.tgz": testTarball(map[string]string{"index.js": "2"}),
+		"/icons-1.0.1.tgz":   testTarball(map[string]string{"index.js": "1", "logo.png": strings.Repeat("i", 1000), "a.test.js": "t"}),
+	}
+	server := registryServer(t, "", packuments, tarballs)
+	defer server.Close()
+	for k, p := range packuments {
+		packuments[k] = strings.Replace(p, "{{server}}", server.URL, -1)
+	}
+
+	blamed := func(name, version string, size int64) *Instance {
+		return &Instance{Name: name, Version: version, Errors: map[PackageError]int{TestError: 1},
+			Files: []BlamedFile{{Path: "test/a.js", Size: size, Errors: []PackageError{TestError}}}}
+	}
+	result := NewResult()
+	result.Instances = []*Instance{
+		blamed("bloated", "1.0.0", 3000000),
+		blamed("stale", "1.0.0", 10),
+		blamed("missing", "1.0.0", 10),
+		{Name: "clean", Version: "1.0.0"},
+		// The suppressed image of the installed version is left out
+		{Name: "icons", Version: "1.0.0", Errors: map[PackageError]int{TestError: 1},
+			Files: []BlamedFile{{Path: "a.test.js", Size: 1, Errors: []PackageError{TestError}}}},
+	}
+	image := ImageError
+	suppressions := &Suppressions{Suppressions: []*Suppression{{Package: "icons", Category: &image, Justification: "Icons"}}}
+	upgrades := NewRegistry(server.URL).Advise(result, suppressions)
+	if len(upgrades) != 5 {
+		t.Fatalf("Expected 5 upgrades got %d: %s", len(upgrades), upgrades)
+	}
+	for _, u := range upgrades {
+		if u.Package == "icons" && (u.Removed != 0 || u.UpgradeBlamedBytes != 1 || u.Errors[ImageError] != 0) {
+			t.Errorf("The tarball should be suppressed as the installed version %+v", u)
+		}
+	}
+	major, minor := upgrades[0], upgrades[1]
+	if major.Version != "2.0.0" || !major.Major || major.Removed != 3000000 || major.UpgradeBlamedBytes != 0 {
+		t.Errorf("Wrong major upgrade %+v", major)
+	}
+	if minor.Version != "1.1.0" || minor.Major || minor.Removed != 2999000 || minor.Errors[TestError] != 2 {
+		t.Errorf("Wrong minor upgrade %+v", minor)
+	}
+
+	out := upgrades.String()
+	for _, expected := range []string{
+		"bloated@1.0.0: upgrade to 2.0.0 (major) removes 3.0 MB of waste\n",
+		"bloated@1.0.0: upgrade to 1.1.0 removes 3.0 MB of waste\n",
+		"stale@1.0.0: no newer version, 10 B of waste\n",
+		"missing@1.0.0: registry error. 404",
+		"\nUpgrading removes up to 3.0 MB of waste.\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected %q in:\n%s", expected, out)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := upgrades.WriteJSON(buf); err != nil || !strings.Contains(buf.String(), `"removed": 3000000`) {
+		t.Errorf("Wrong JSON %s %v", buf, err)
+	}
+}
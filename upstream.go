@@ -0,0 +1,104 @@
+package npmblame
+
+import (
+	"fmt"
+	"path"
+)
+
+// FixedUpstreamLabel labels the findings fixed on the default branch of
+// the package repository, but not published yet
+const FixedUpstreamLabel = "fixed upstream, unreleased"
+
+// UpstreamStatus tells which findings of an installed package are fixed
+// on the default branch of its repository
+type UpstreamStatus struct {
+	Branch string
+	// Fixed are the package errors whose blamed files are no longer
+	// published by the default branch
+	Fixed map[PackageError]bool
+}
+
+// CheckUpstream reads the package.json and .npmignore, or .gitignore, of
+// the package folder on the default branch of the target repository, and
+// checks whether the blamed files of every finding would still be
+// published. The repository metadata is only read when the target has
+// none.
+func CheckUpstream(target *Target, i *Instance) (*UpstreamStatus, error) {
+	t, repo, info := target.Tracker, target.Repository, target.Info
+	if info == nil {
+		var err error
+		if info, err = t.RepositoryInfo(repo.Owner, repo.Name); err != nil {
+			return nil, err
+		}
+	}
+	if info.DefaultBranch == "" {
+		return nil, fmt.Errorf("%s has no default branch", repo)
+	}
+	manifestPath := path.Join(repo.Directory, "package.json")
+	manifest, err := t.FileContent(repo.Owner, repo.Name, info.DefaultBranch, manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("%s has no %s on %s", repo, manifestPath, info.DefaultBranch)
+	}
+	var ignore []byte
+	for _, name := range []string{".npmignore", ".gitignore"} {
+		if ignore, err = t.FileContent(repo.Owner, repo.Name, info.DefaultBranch, path.Join(repo.Directory, name)); err != nil {
+			return nil, err
+		}
+		if ignore != nil {
+			break
+		}
+	}
+	packlist, err := NewPacklist(manifest, ignore)
+	if err != nil {
+		return nil, fmt.Errorf("%s on %s: %v", repo, info.DefaultBranch, err)
+	}
+
+	s := &UpstreamStatus{Branch: info.DefaultBranch, Fixed: make(map[PackageError]bool)}
+	for err, count := range i.Errors {
+		if count == 0 {
+			continue
+		}
+		fixed := true
+		for _, f := range i.Files {
+			if hasError(f.Errors, err) && packlist.Published(f.Path) {
+				fixed = false
+				break
+			}
+		}
+		if fixed {
+			s.Fixed[err] = true
+		}
+	}
+	return s, nil
+}
+
+// hasError reports whether a package error is in a list
+func hasError(errs []PackageError, err PackageError) bool {
+	for _, e := range errs {
+		if e == err {
+			return true
+		}
+	}
+	return false
+}
+
+// AllFixed reports whether every finding of the package is fixed upstream
+func (s *UpstreamStatus) AllFixed(i *Instance) bool {
+	for err, count := range i.Errors {
+		if count > 0 && !s.Fixed[err] {
+			return false
+		}
+	}
+	return true
+}
+
+// Label labels the findings of report data fixed upstream
+func (s *UpstreamStatus) Label(data *ReportData) {
+	data.UpstreamBranch = s.Branch
+	for n := range data.Findings {
+		data.Findings[n].FixedUpstream = s.Fixed[data.Findings[n].Error]
+	}
+}
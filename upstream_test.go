@@ -0,0 +1,98 @@
+package npmblame
+
+import (
+	"strings"
+	"testing"
+)
+
+func upstreamTracker(files map[string]string) *fakeTracker {
+	return &fakeTracker{
+		repositories: map[string]*RepositoryInfo{"owner/mono": {HasIssues: true, DefaultBranch: "main"}},
+		files:        files,
+	}
+}
+
+func TestCheckUpstream(t *testing.T) {
+	repo := &Repository{Host: "github.com", Owner: "owner", Name: "mono", Directory: "packages/pkg"}
+	for _, tc := range []struct {
+		name     string
+		files    map[string]string
+		fixed    []PackageError
+		allFixed bool
+	}{
+		{
+			name:  "Unchanged",
+			files: map[string]string{"owner/mono/packages/pkg/package.json": `{"name": "pkg"}`},
+		},
+		{
+			name: "Files field",
+			files: map[string]string{
+				"owner/mono/packages/pkg/package.json": `{"name": "pkg", "files": ["index.js"]}`,
+				"owner/mono/packages/pkg/.npmignore":   "test/\n",
+			},
+			fixed:    []PackageError{TestError, SecretError},
+			allFixed: true,
+		},
+		{
+			name: "npmignore",
+			files: map[string]string{
+				"owner/mono/packages/pkg/package.json": `{"name": "pkg"}`,
+				"owner/mono/packages/pkg/.npmignore":   "test/\n",
+				"owner/mono/packages/pkg/.gitignore":   ".env\n",
+			},
+			fixed: []PackageError{TestError},
+		},
+		{
+			name: "gitignore",
+			files: map[string]string{
+				"owner/mono/packages/pkg/package.json": `{"name": "pkg"}`,
+				"owner/mono/packages/pkg/.gitignore":   ".env\n",
+			},
+			fixed: []PackageError{SecretError},
+		},
+	} {
+		i := templateInstance()
+		s, err := CheckUpstream(&Target{Tracker: upstreamTracker(tc.files), Repository: repo}, i)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if s.Branch != "main" || len(s.Fixed) != len(tc.fixed) || s.AllFixed(i) != tc.allFixed {
+			t.Errorf("%s: expected %v got %+v", tc.name, tc.fixed, s)
+		}
+		for _, err := range tc.fixed {
+			if !s.Fixed[err] {
+				t.Errorf("%s: expected %s to be fixed", tc.name, err)
+			}
+		}
+	}
+
+	// The metadata checked by ReportTarget is not read again
+	tracker := &fakeTracker{files: map[string]string{"owner/mono/packages/pkg/package.json": `{"name": "pkg"}`}}
+	target := &Target{Tracker: tracker, Repository: repo, Info: &RepositoryInfo{HasIssues: true, DefaultBranch: "develop"}}
+	if s, err := CheckUpstream(target, templateInstance()); err != nil || s.Branch != "develop" {
+		t.Errorf("Expected the target metadata to be used got %+v %v", s, err)
+	}
+
+	if _, err := CheckUpstream(&Target{Tracker: upstreamTracker(nil), Repository: repo}, templateInstance()); err == nil || !strings.Contains(err.Error(), "no packages/pkg/package.json on main") {
+		t.Errorf("Expected a missing package.json error got %v", err)
+	}
+}
+
+func TestUpstreamStatusLabel(t *testing.T) {
+	repo := &Repository{Host: "github.com", Owner: "owner", Name: "pkg"}
+	data := NewReportData(templateInstance(), repo)
+	s := &UpstreamStatus{Branch: "main", Fixed: map[PackageError]bool{TestError: true}}
+	s.Label(data)
+	if data.UpstreamBranch != "main" || !data.Findings[0].FixedUpstream || data.Findings[1].FixedUpstream {
+		t.Fatalf("Wrong labels %+v", data.Findings)
+	}
+	r, err := DefaultReportTemplate().RenderData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(r.Body, "### Tests: 12 files, 12.0 kB (fixed upstream, unreleased on `main`)") ||
+		!strings.Contains(r.Body, "### Credentials and private keys: 1 file, 100 B\n") {
+		t.Errorf("Wrong labels in:\n%s", r.Body)
+	}
+}
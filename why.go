@@ -0,0 +1,181 @@
+package npmblame
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// MaxExplainedPaths is the maximum number of dependency paths listed
+// for an installed instance
+const MaxExplainedPaths = 50
+
+// Explanation lists why an installed instance of a package is there
+type Explanation struct {
+	Instance *Instance `json:"instance"`
+	// Paths are the chains of packages, as name@version, going from the
+	// project down to the instance
+	Paths [][]string `json:"paths"`
+	// Truncated is set when the instance has more than MaxExplainedPaths
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Explanations are the explanations of all the instances of a package
+type Explanations []*Explanation
+
+// Why returns the dependency paths from the project to every installed
+// instance of a package. The dependencies are resolved from the
+// package.json files the way node does, the project being the folder
+// containing the scanned node_modules folder root.
+func Why(fs afero.Fs, root string, r *Result, name string) (Explanations, error) {
+	instances := make(map[string]*Instance)
+	for _, i := range r.Instances {
+		instances[i.Path] = i
+	}
+
+	dependents := make(map[string][]string)
+	for _, i := range r.Instances {
+		m, err := ReadManifest(fs, filepath.Join(root, filepath.FromSlash(i.Path)))
+		if err != nil {
+			// Without manifest a package has no dependencies
+			continue
+		}
+		for _, deps := range []map[string]string{m.Dependencies, m.OptionalDependencies} {
+			for dep := range deps {
+				if p := resolveInstance(instances, i.Path, dep); p != "" {
+					dependents[p] = append(dependents[p], i.Path)
+				}
+			}
+		}
+	}
+	for _, d := range dependents {
+		sort.Strings(d)
+	}
+
+	direct := make(map[string]bool)
+	project, err := ReadManifest(fs, filepath.Join(root, ".."))
+	switch {
+	case err == nil:
+		for dep := range project.DirectDependencies() {
+			if p := resolveInstance(instances, "", dep); p != "" {
+				direct[p] = true
+			}
+		}
+	case os.IsNotExist(err):
+		// The top level packages nothing depends on
+		for p := range instances {
+			if strings.Count(p, "/node_modules/") == 0 && len(dependents[p]) == 0 {
+				direct[p] = true
+			}
+		}
+	default:
+		return nil, err
+	}
+
+	var explanations Explanations
+	for _, i := range r.Instances {
+		if i.Name != name {
+			continue
+		}
+		e := &Explanation{Instance: i}
+		e.explain(instances, dependents, direct, []string{i.Path}, map[string]bool{i.Path: true})
+		explanations = append(explanations, e)
+	}
+	if len(explanations) == 0 {
+		return nil, fmt.Errorf("%s is not installed", name)
+	}
+	return explanations, nil
+}
+
+// explain walks up the dependents of the last package of a chain,
+// recording the chains reaching a direct dependency of the project
+func (e *Explanation) explain(instances map[string]*Instance, dependents map[string][]string, direct map[string]bool, chain []string, seen map[string]bool) {
+	p := chain[len(chain)-1]
+	if direct[p] {
+		if len(e.Paths) == MaxExplainedPaths {
+			e.Truncated = true
+			return
+		}
+		path := make([]string, 0, len(chain))
+		for n := len(chain) - 1; n >= 0; n-- {
+			i := instances[chain[n]]
+			path = append(path, i.Name+"@"+i.Version)
+		}
+		e.Paths = append(e.Paths, path)
+	}
+	for _, dependent := range dependents[p] {
+		if e.Truncated {
+			return
+		}
+		if seen[dependent] {
+			continue
+		}
+		seen[dependent] = true
+		e.explain(instances, dependents, direct, append(chain, dependent), seen)
+		delete(seen, dependent)
+	}
+}
+
+// resolveInstance returns the path of the instance a package requiring
+// name loads, looking up the node_modules folders to the scan root
+func resolveInstance(instances map[string]*Instance, from, name string) string {
+	for dir := from; ; {
+		p := "/" + name
+		if dir != "" {
+			p = dir + "/node_modules/" + name
+		}
+		if _, ok := instances[p]; ok {
+			return p
+		}
+		if dir == "" {
+			return ""
+		}
+		if i := strings.LastIndex(dir, "/node_modules/"); i != -1 {
+			dir = dir[:i]
+		} else {
+			dir = ""
+		}
+	}
+}
+
+// String returns the printable dependency paths of the instances
+func (explanations Explanations) String() string {
+	buf := &bytes.Buffer{}
+	for n, e := range explanations {
+		if n > 0 {
+			fmt.Fprintln(buf)
+		}
+		i := e.Instance
+		fmt.Fprintf(buf, "%s@%s in %s: %s\n", i.Name, i.Version, i.Path, formatBlame(i))
+		if len(e.Paths) == 0 {
+			fmt.Fprintln(buf, "  no dependency path from the project")
+		}
+		for _, p := range e.Paths {
+			fmt.Fprintf(buf, "  project > %s\n", strings.Join(p, " > "))
+		}
+		if e.Truncated {
+			fmt.Fprintf(buf, "  more than %d paths, the others are not listed\n", MaxExplainedPaths)
+		}
+	}
+	return buf.String()
+}
+
+// formatBlame returns the error counts and sizes of an instance
+func formatBlame(i *Instance) string {
+	var errs []string
+	sizes := i.Bytes()
+	for _, err := range PackageErrors {
+		if count := i.Errors[err]; count > 0 {
+			errs = append(errs, fmt.Sprintf("%d %s (%s)", count, err, formatBytes(sizes[err])))
+		}
+	}
+	if len(errs) == 0 {
+		return fmt.Sprintf("no errors, %s", formatBytes(i.Size))
+	}
+	return fmt.Sprintf("%s, %s blamed of %s", strings.Join(errs, ", "), formatBytes(i.BlamedBytes()), formatBytes(i.Size))
+}
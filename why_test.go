@@ -0,0 +1,80 @@
+package npmblame
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func whyProject(t *testing.T) (afero.Fs, *Result) {
+	fs := afero.NewMemMapFs()
+	for p, data := range map[string]string{
+		"/project/package.json":                               `{"dependencies": {"a": "^1.0.0", "b": "^1.0.0"}}`,
+		"/project/node_modules/a/package.json":                `{"name": "a", "version": "1.0.0", "dependencies": {"c": "^1.0.0", "d": "^1.0.0"}}`,
+		"/project/node_modules/b/package.json":                `{"name": "b", "version": "1.0.0", "dependencies": {"c": "^2.0.0"}}`,
+		"/project/node_modules/b/node_modules/c/package.json": `{"name": "c", "version": "2.0.0"}`,
+		"/project/node_modules/b/node_modules/c/test/c.js":    "test",
+		"/project/node_modules/c/package.json":                `{"name": "c", "version": "1.0.0", "dependencies": {"a": "^1.0.0"}}`,
+		"/project/node_modules/d/package.json":                `{"name": "d", "version": "1.0.0", "optionalDependencies": {"c": "^1.0.0"}}`,
+	} {
+		afero.WriteFile(fs, p, []byte(data), 0644)
+	}
+	r, err := NewScanner(fs, "/project/node_modules", DefaultScanOptions()).Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs, r
+}
+
+func TestWhy(t *testing.T) {
+	fs, r := whyProject(t)
+	explanations, err := Why(fs, "/project/node_modules", r, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(explanations) != 2 {
+		t.Fatalf("Expected 2 instances of c got %d", len(explanations))
+	}
+
+	nested := explanations[0]
+	if nested.Instance.Path != "/b/node_modules/c" ||
+		!reflect.DeepEqual(nested.Paths, [][]string{{"b@1.0.0", "c@2.0.0"}}) {
+		t.Errorf("Wrong explanation of the nested c: %+v", nested)
+	}
+	top := explanations[1]
+	want := [][]string{{"a@1.0.0", "c@1.0.0"}, {"a@1.0.0", "d@1.0.0", "c@1.0.0"}}
+	if top.Instance.Path != "/c" || !reflect.DeepEqual(top.Paths, want) {
+		t.Errorf("Paths of c = %v, want %v", top.Paths, want)
+	}
+
+	s := explanations.String()
+	for _, line := range []string{
+		"c@2.0.0 in /b/node_modules/c: 2 test (4 B), 4 B blamed of",
+		"  project > b@1.0.0 > c@2.0.0\n",
+		"c@1.0.0 in /c: no errors",
+		"  project > a@1.0.0 > d@1.0.0 > c@1.0.0\n",
+	} {
+		if !strings.Contains(s, line) {
+			t.Errorf("Missing %q in:\n%s", line, s)
+		}
+	}
+
+	if _, err := Why(fs, "/project/node_modules", r, "missing"); err == nil {
+		t.Error("Expected an error for a package that is not installed")
+	}
+}
+
+func TestWhyWithoutProjectManifest(t *testing.T) {
+	fs, r := whyProject(t)
+	fs.Remove("/project/package.json")
+	explanations, err := Why(fs, "/project/node_modules", r, "d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a and c depend on each other, only b has no dependents
+	if len(explanations) != 1 || len(explanations[0].Paths) != 0 {
+		t.Errorf("Expected d to be unreachable from b: %+v", explanations[0])
+	}
+}
@@ -0,0 +1,104 @@
+package npmblame
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxYAMLValues bounds the values of a decoded document, aliases
+// included, so that nested aliases can not expand without end
+const maxYAMLValues = 1000000
+
+// parseYAML decodes a YAML document such as a lockfile. Scalars are
+// always decoded as strings, nulls as empty strings, mappings as
+// map[string]interface{} and sequences as []interface{}. Aliases and
+// merge keys are resolved.
+func parseYAML(data []byte) (interface{}, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return map[string]interface{}{}, nil
+	}
+	d := &yamlDecoder{}
+	return d.value(doc.Content[0])
+}
+
+// yamlDecoder converts YAML nodes, counting the decoded values
+type yamlDecoder struct {
+	values int
+}
+
+func (d *yamlDecoder) value(n *yaml.Node) (interface{}, error) {
+	d.values++
+	if d.values > maxYAMLValues {
+		return nil, fmt.Errorf("line %d: document too large", n.Line)
+	}
+	switch n.Kind {
+	case yaml.AliasNode:
+		return d.value(n.Alias)
+	case yaml.ScalarNode:
+		if n.Tag == "!!null" {
+			return "", nil
+		}
+		return n.Value, nil
+	case yaml.SequenceNode:
+		s := make([]interface{}, 0, len(n.Content))
+		for _, item := range n.Content {
+			v, err := d.value(item)
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, v)
+		}
+		return s, nil
+	case yaml.MappingNode:
+		return d.mapping(n)
+	}
+	return nil, fmt.Errorf("line %d: unexpected YAML node", n.Line)
+}
+
+// mapping decodes a mapping, its own keys taking precedence over the
+// merged ones
+func (d *yamlDecoder) mapping(n *yaml.Node) (map[string]interface{}, error) {
+	m := make(map[string]interface{}, len(n.Content)/2)
+	var merged []map[string]interface{}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+		for key.Kind == yaml.AliasNode {
+			key = key.Alias
+		}
+		if key.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("line %d: mapping keys must be scalars", key.Line)
+		}
+		v, err := d.value(value)
+		if err != nil {
+			return nil, err
+		}
+		if key.Tag == "!!merge" {
+			sources, ok := v.([]interface{})
+			if !ok {
+				sources = []interface{}{v}
+			}
+			for _, source := range sources {
+				sm, ok := source.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("line %d: merge keys must merge mappings", key.Line)
+				}
+				merged = append(merged, sm)
+			}
+			continue
+		}
+		m[key.Value] = v
+	}
+	for _, sm := range merged {
+		for k, v := range sm {
+			if _, ok := m[k]; !ok {
+				m[k] = v
+			}
+		}
+	}
+	return m, nil
+}
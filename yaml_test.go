@@ -0,0 +1,87 @@
+package npmblame
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	data := []byte(`# comment
+lockfileVersion: '6.0'
+
+packages:
+  /@scope/name@1.0.0(react@18.0.0):
+    resolution: {integrity: sha512-abc, tarball: "x y"}
+    os: [darwin, linux] # trailing comment
+    dependencies:
+      "quoted key": 'it''s'
+  list:
+  - a
+  - name: b
+    version: 1.10
+  empty:
+defaults: &defaults
+  engine: node
+  cpu: x64
+override:
+  <<: *defaults
+  cpu: arm64
+alias: *defaults
+text: |
+  line one
+  line two
+folded: >-
+  one
+  two
+`)
+	v, err := parseYAML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaults := map[string]interface{}{"engine": "node", "cpu": "x64"}
+	want := map[string]interface{}{
+		"lockfileVersion": "6.0",
+		"packages": map[string]interface{}{
+			"/@scope/name@1.0.0(react@18.0.0)": map[string]interface{}{
+				"resolution":   map[string]interface{}{"integrity": "sha512-abc", "tarball": "x y"},
+				"os":           []interface{}{"darwin", "linux"},
+				"dependencies": map[string]interface{}{"quoted key": "it's"},
+			},
+			"list": []interface{}{
+				"a",
+				map[string]interface{}{"name": "b", "version": "1.10"},
+			},
+			"empty": "",
+		},
+		"defaults": defaults,
+		"override": map[string]interface{}{"engine": "node", "cpu": "arm64"},
+		"alias":    defaults,
+		"text":     "line one\nline two\n",
+		"folded":   "one two",
+	}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("parseYAML = %#v\nwant %#v", v, want)
+	}
+
+	if v, err := parseYAML([]byte("# only a comment\n")); err != nil || !reflect.DeepEqual(v, map[string]interface{}{}) {
+		t.Errorf("Expected an empty mapping got %#v %v", v, err)
+	}
+
+	for _, invalid := range []string{"a: 1\n   b: 2\n", "a: [1, 2\n", "a: *missing\n", "? [a, b]\n: c\n", "a:\n  <<: [x]\n"} {
+		if _, err := parseYAML([]byte(invalid)); err == nil {
+			t.Errorf("Expected an error parsing %q", invalid)
+		}
+	}
+
+	// Nested aliases must not expand without end
+	laughs := "a: &a [x, x, x, x, x, x, x, x, x, x]\n"
+	for _, name := range strings.Split("bcdefghij", "") {
+		prev := string(rune(name[0] - 1))
+		laughs += name + ": &" + name + " [*" + prev + ", *" + prev + ", *" + prev + ", *" + prev + ", *" + prev +
+			", *" + prev + ", *" + prev + ", *" + prev + ", *" + prev + ", *" + prev + "]\n"
+	}
+	if _, err := parseYAML([]byte(laughs)); err == nil {
+		t.Error("Expected an error expanding nested aliases")
+	}
+}